@@ -4,9 +4,12 @@ import (
 	"fmt"
 )
 
-type Expression interface{}
+type Expression interface {
+	Node
+}
 
 type IfExpression struct {
+	Span
 	Condition  Expression
 	Value      Expression
 	ElseBranch *IfExpression
@@ -33,7 +36,38 @@ const (
 	BinaryOperatorLor
 )
 
+func (o BinaryOperator) String() string {
+	switch o {
+	case BinaryOperatorEq:
+		return "=="
+	case BinaryOperatorNe:
+		return "!="
+	case BinaryOperatorLt:
+		return "<"
+	case BinaryOperatorLe:
+		return "<="
+	case BinaryOperatorGt:
+		return ">"
+	case BinaryOperatorGe:
+		return ">="
+	case BinaryOperatorAdd:
+		return "+"
+	case BinaryOperatorSub:
+		return "-"
+	case BinaryOperatorMul:
+		return "*"
+	case BinaryOperatorDiv:
+		return "/"
+	case BinaryOperatorLand:
+		return "&&"
+	case BinaryOperatorLor:
+		return "||"
+	}
+	return "?"
+}
+
 type BinaryOperationExpression struct {
+	Span
 	Operator BinaryOperator
 	A        Expression
 	B        Expression
@@ -51,7 +85,20 @@ const (
 	UnaryOperatorNeg
 )
 
+func (o UnaryOperator) String() string {
+	switch o {
+	case UnaryOperatorLnot:
+		return "!"
+	case UnaryOperatorPos:
+		return "+"
+	case UnaryOperatorNeg:
+		return "-"
+	}
+	return "?"
+}
+
 type UnaryOperationExpression struct {
+	Span
 	Operator UnaryOperator
 	A        Expression
 }
@@ -60,16 +107,21 @@ func (n *UnaryOperationExpression) String() string {
 	return fmt.Sprintf("UnaryOperationExpression{Operator: %d, A: %s}", n.Operator, n.A)
 }
 
+// LookupExpression reads the variable Identifier. ScopeIndex and Slot are
+// set by the semantic analysis.
 type LookupExpression struct {
+	Span
 	Identifier string
 	ScopeIndex int
+	Slot       int
 }
 
 func (n *LookupExpression) String() string {
-	return fmt.Sprintf("LookupExpression{Identifier: %s, ScopeIndex: %d}", n.Identifier, n.ScopeIndex)
+	return fmt.Sprintf("LookupExpression{Identifier: %s, ScopeIndex: %d, Slot: %d}", n.Identifier, n.ScopeIndex, n.Slot)
 }
 
 type CallExpression struct {
+	Span
 	Callee     Expression
 	Parameters []Expression
 }
@@ -79,6 +131,7 @@ func (n *CallExpression) String() string {
 }
 
 type SubscriptExpression struct {
+	Span
 	Target Expression
 	Index  Expression
 }
@@ -87,7 +140,34 @@ func (n *SubscriptExpression) String() string {
 	return fmt.Sprintf("SubscriptExpression{Target: %s, Index: %s}", n.Target, n.Index)
 }
 
+// MemberExpression accesses the member Name of Target.
+type MemberExpression struct {
+	Span
+	Target Expression
+	Name   string
+}
+
+func (n *MemberExpression) String() string {
+	return fmt.Sprintf("MemberExpression{Target: %s, Name: %s}", n.Target, n.Name)
+}
+
+// MapEntry is a single key value pair of a MapExpression.
+type MapEntry struct {
+	Key   Expression
+	Value Expression
+}
+
+type MapExpression struct {
+	Span
+	Entries []MapEntry
+}
+
+func (n *MapExpression) String() string {
+	return fmt.Sprintf("MapExpression{Entries: %v}", n.Entries)
+}
+
 type ArrayExpression struct {
+	Span
 	Items []Expression
 }
 
@@ -0,0 +1,32 @@
+package ast
+
+import "fmt"
+
+// Span is the range of source code a node was parsed from. Line and Column
+// denote the first character, EndLine and EndColumn the last character of
+// the node.
+type Span struct {
+	File               string
+	Line, Column       int
+	EndLine, EndColumn int
+}
+
+// Location returns the span itself, so every node embedding a Span
+// implements Node.
+func (s Span) Location() Span {
+	return s
+}
+
+// Position formats the start of the span as file:line:column, as commonly
+// used as prefix of error messages.
+func (s Span) Position() string {
+	if s.File == "" {
+		return fmt.Sprintf("%d:%d", s.Line, s.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", s.File, s.Line, s.Column)
+}
+
+// Node is implemented by all statements and expressions.
+type Node interface {
+	Location() Span
+}
@@ -4,9 +4,12 @@ import (
 	"fmt"
 )
 
-type Statement interface{}
+type Statement interface {
+	Node
+}
 
 type IfStatement struct {
+	Span
 	Condition  Expression
 	Statements []Statement
 	ElseBranch *IfStatement
@@ -17,6 +20,7 @@ func (n *IfStatement) String() string {
 }
 
 type WhileStatement struct {
+	Span
 	Condition  Expression
 	Statements []Statement
 }
@@ -25,7 +29,76 @@ func (n *WhileStatement) String() string {
 	return fmt.Sprintf("WhileStatement{Condition: %s, Statements: %s}", n.Condition, n.Statements)
 }
 
+// ForStatement iterates over Iterable, declaring ValueIdentifier and, if set,
+// IndexIdentifier in the scope of each iteration.
+type ForStatement struct {
+	Span
+	IndexIdentifier string
+	IndexSlot       int
+	ValueIdentifier string
+	ValueSlot       int
+	Iterable        Expression
+	Statements      []Statement
+}
+
+func (n *ForStatement) String() string {
+	return fmt.Sprintf("ForStatement{IndexIdentifier: %s, IndexSlot: %d, ValueIdentifier: %s, ValueSlot: %d, Iterable: %s, Statements: %s}", n.IndexIdentifier, n.IndexSlot, n.ValueIdentifier, n.ValueSlot, n.Iterable, n.Statements)
+}
+
+// StructDeclaration declares a record type Name with the given Fields.
+type StructDeclaration struct {
+	Span
+	Name   string
+	Slot   int
+	Fields []string
+}
+
+func (n *StructDeclaration) String() string {
+	return fmt.Sprintf("StructDeclaration{Name: %s, Slot: %d, Fields: %s}", n.Name, n.Slot, n.Fields)
+}
+
+// ClassDeclaration declares a class Name. Superclass is nil if the class
+// does not inherit from another class. Each method has its Name set.
+type ClassDeclaration struct {
+	Span
+	Name       string
+	Slot       int
+	Superclass *LookupExpression
+	Methods    []*Function
+}
+
+func (n *ClassDeclaration) String() string {
+	return fmt.Sprintf("ClassDeclaration{Name: %s, Slot: %d, Superclass: %s, Methods: %s}", n.Name, n.Slot, n.Superclass, n.Methods)
+}
+
+// TryStatement evaluates Statements. Catch is nil if errors are not caught
+// and Finally is nil if there is no finally block.
+type TryStatement struct {
+	Span
+	Statements []Statement
+	Catch      *CatchClause
+	Finally    []Statement
+}
+
+func (n *TryStatement) String() string {
+	return fmt.Sprintf("TryStatement{Statements: %s, Catch: %s, Finally: %s}", n.Statements, n.Catch, n.Finally)
+}
+
+// CatchClause declares Identifier as the caught error in the scope of its
+// Statements.
+type CatchClause struct {
+	Span
+	Identifier string
+	Slot       int
+	Statements []Statement
+}
+
+func (n *CatchClause) String() string {
+	return fmt.Sprintf("CatchClause{Identifier: %s, Slot: %d, Statements: %s}", n.Identifier, n.Slot, n.Statements)
+}
+
 type ExpressionStatement struct {
+	Span
 	Expression Expression
 }
 
@@ -34,25 +107,54 @@ func (n *ExpressionStatement) String() string {
 }
 
 type DeclarationStatement struct {
+	Span
 	Identifier string
+	Slot       int
 	Value      Expression
 }
 
 func (n *DeclarationStatement) String() string {
-	return fmt.Sprintf("DeclarationStatement{Identifier: %s, Value: %s}", n.Identifier, n.Value)
+	return fmt.Sprintf("DeclarationStatement{Identifier: %s, Slot: %d, Value: %s}", n.Identifier, n.Slot, n.Value)
 }
 
 type AssignmentStatement struct {
+	Span
 	Identifier string
 	ScopeIndex int
+	Slot       int
 	Value      Expression
 }
 
 func (n *AssignmentStatement) String() string {
-	return fmt.Sprintf("AssignmentStatement{Identifier: %s, ScopeIndex: %d, Value: %s}", n.Identifier, n.ScopeIndex, n.Value)
+	return fmt.Sprintf("AssignmentStatement{Identifier: %s, ScopeIndex: %d, Slot: %d, Value: %s}", n.Identifier, n.ScopeIndex, n.Slot, n.Value)
+}
+
+// SubscriptAssignmentStatement assigns Value to Target[Index].
+type SubscriptAssignmentStatement struct {
+	Span
+	Target Expression
+	Index  Expression
+	Value  Expression
+}
+
+func (n *SubscriptAssignmentStatement) String() string {
+	return fmt.Sprintf("SubscriptAssignmentStatement{Target: %s, Index: %s, Value: %s}", n.Target, n.Index, n.Value)
+}
+
+// MemberAssignmentStatement assigns Value to the member Name of Target.
+type MemberAssignmentStatement struct {
+	Span
+	Target Expression
+	Name   string
+	Value  Expression
+}
+
+func (n *MemberAssignmentStatement) String() string {
+	return fmt.Sprintf("MemberAssignmentStatement{Target: %s, Name: %s, Value: %s}", n.Target, n.Name, n.Value)
 }
 
 type ReturnStatement struct {
+	Span
 	Expression Expression
 }
 
@@ -60,13 +162,26 @@ func (n *ReturnStatement) String() string {
 	return fmt.Sprintf("ReturnStatement{Expression: %s}", n.Expression)
 }
 
-type ContinueStatement struct{}
+type ThrowStatement struct {
+	Span
+	Expression Expression
+}
+
+func (n *ThrowStatement) String() string {
+	return fmt.Sprintf("ThrowStatement{Expression: %s}", n.Expression)
+}
+
+type ContinueStatement struct {
+	Span
+}
 
 func (n *ContinueStatement) String() string {
 	return "ContinueStatement"
 }
 
-type BreakStatement struct{}
+type BreakStatement struct {
+	Span
+}
 
 func (n *BreakStatement) String() string {
 	return "BreakStatement"
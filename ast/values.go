@@ -7,15 +7,39 @@ type ValueExpression interface {
 }
 
 type Function struct {
+	Span
+	// Name is set if the function is directly bound by a declaration
+	Name       string
 	Parameters []string
 	Statements []Statement
+	// Captures are set by the semantic analysis and list the variables of
+	// enclosing scopes used by the function, in order of first use. They
+	// occupy the slots of the scope above the parameter scope in this order,
+	// like the parameters do in the parameter scope.
+	Captures []Capture
 }
 
 func (n *Function) String() string {
-	return fmt.Sprintf("Function{Parameters: %s, Statements: %s}", n.Parameters, n.Statements)
+	return fmt.Sprintf("Function{Name: %s, Parameters: %s, Statements: %s, Captures: %s}", n.Name, n.Parameters, n.Statements, n.Captures)
+}
+
+// Capture is a variable a function closes over. The function shares the
+// variable with the scope it is declared in, so assignments on either side
+// are visible to the other.
+type Capture struct {
+	Identifier string
+	// ScopeIndex and Slot of the variable, relative to the scope the
+	// function is created in
+	ScopeIndex int
+	Slot       int
+}
+
+func (c Capture) String() string {
+	return fmt.Sprintf("Capture{Identifier: %s, ScopeIndex: %d, Slot: %d}", c.Identifier, c.ScopeIndex, c.Slot)
 }
 
 type Integer struct {
+	Span
 	Value int64
 }
 
@@ -24,6 +48,7 @@ func (n *Integer) String() string {
 }
 
 type Float struct {
+	Span
 	Value float64
 }
 
@@ -32,6 +57,7 @@ func (n *Float) String() string {
 }
 
 type String struct {
+	Span
 	Value string
 }
 
@@ -39,7 +65,19 @@ func (n *String) String() string {
 	return fmt.Sprintf("String{Value: %s}", n.Value)
 }
 
+// InterpolatedString is a string literal with embedded expressions. Parts
+// alternates between literal *String segments and interpolated expressions.
+type InterpolatedString struct {
+	Span
+	Parts []Expression
+}
+
+func (n *InterpolatedString) String() string {
+	return fmt.Sprintf("InterpolatedString{Parts: %v}", n.Parts)
+}
+
 type Boolean struct {
+	Span
 	Value bool
 }
 
@@ -47,7 +85,9 @@ func (n *Boolean) String() string {
 	return fmt.Sprintf("Boolean{Value: %t}", n.Value)
 }
 
-type Nil struct{}
+type Nil struct {
+	Span
+}
 
 func (n *Nil) String() string {
 	return "Nil"
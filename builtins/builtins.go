@@ -0,0 +1,157 @@
+// Package builtins implements the predefined functions available to all
+// nklang programs, whichever way they are run.
+package builtins
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/niklaskorz/nklang/evaluator"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+	"github.com/niklaskorz/nklang/semantics"
+)
+
+// Builtin is a predefined function together with the name it is declared
+// as.
+type Builtin struct {
+	Name     string
+	Function *evaluator.PredefinedFunction
+}
+
+// Predefined lists the builtins, reading from and writing to the standard
+// input and output of the process. They are declared in this order
+// everywhere, so they get the same slots in all scopes.
+var Predefined = New(os.Stdout, os.Stdin)
+
+// New returns the builtins in the order of Predefined, with print and
+// println writing to stdout and input reading lines from stdin.
+func New(stdout io.Writer, stdin io.Reader) []Builtin {
+	c := &console{out: stdout, in: bufio.NewReader(stdin)}
+	return []Builtin{
+		{"println", evaluator.WrapFunction(c.println)},
+		{"print", evaluator.WrapFunction(c.print)},
+		{"input", evaluator.WrapFunction(c.input)},
+		{"eval", evaluator.WrapFunction(pfEval)},
+		{"range", evaluator.WrapFunction(pfRange)},
+		{"Error", evaluator.WrapFunction(pfError)},
+	}
+}
+
+// Names returns the names of the builtins in order of declaration.
+func Names() []string {
+	names := make([]string, len(Predefined))
+	for i, b := range Predefined {
+		names[i] = b.Name
+	}
+	return names
+}
+
+func paramsToString(params []evaluator.Object) string {
+	return evaluator.FormatObjects(params)
+}
+
+// console is the output and input of print, println and input.
+type console struct {
+	out io.Writer
+	// Kept between calls of input, as it may have read ahead
+	in *bufio.Reader
+}
+
+func (c *console) println(params []evaluator.Object) (evaluator.Object, error) {
+	s := paramsToString(params)
+	fmt.Fprintln(c.out, s)
+	return evaluator.NilObject, nil
+}
+
+func (c *console) print(params []evaluator.Object) (evaluator.Object, error) {
+	s := paramsToString(params)
+	fmt.Fprint(c.out, s)
+	return evaluator.NilObject, nil
+}
+
+func (c *console) input(params []evaluator.Object) (evaluator.Object, error) {
+	c.print(params)
+
+	text, err := c.in.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	return &evaluator.String{Value: text[:len(text)-1]}, nil
+}
+
+func pfEval(params []evaluator.Object) (evaluator.Object, error) {
+	src := paramsToString(params)
+
+	s := lexer.NewScanner(strings.NewReader(src))
+	s.File = "<eval>"
+	if err := s.ReadNext(); err != nil {
+		return evaluator.NilObject, errors.Wrap(err, "Scanning eval string failed")
+	}
+
+	expr, err := parser.ParseExpression(s)
+	if err != nil {
+		return evaluator.NilObject, errors.Wrap(err, "Parsing eval string failed")
+	}
+
+	if err := semantics.AnalyzeExpression(semantics.NewScope(), expr); err != nil {
+		return evaluator.NilObject, errors.Wrap(err, "Analyzing eval string failed")
+	}
+
+	result, err := evaluator.EvaluateExpression(expr, evaluator.NewScope())
+	if err != nil {
+		return evaluator.NilObject, errors.Wrap(err, "Evaluating eval string failed")
+	}
+
+	return result, nil
+}
+
+func pfRange(params []evaluator.Object) (evaluator.Object, error) {
+	if len(params) < 1 || len(params) > 3 {
+		return nil, fmt.Errorf("range expects 1 to 3 arguments, got %d", len(params))
+	}
+
+	bounds := []int64{}
+	for _, p := range params {
+		i, ok := p.(*evaluator.Integer)
+		if !ok {
+			return nil, fmt.Errorf("range expects Integer arguments, got %s", p.TypeName())
+		}
+		bounds = append(bounds, i.Value)
+	}
+
+	switch len(bounds) {
+	case 1:
+		return evaluator.NewRange(0, bounds[0], 1)
+	case 2:
+		return evaluator.NewRange(bounds[0], bounds[1], 1)
+	default:
+		return evaluator.NewRange(bounds[0], bounds[1], bounds[2])
+	}
+}
+
+func pfError(params []evaluator.Object) (evaluator.Object, error) {
+	if len(params) < 1 || len(params) > 2 {
+		return nil, fmt.Errorf("Error expects 1 or 2 arguments, got %d", len(params))
+	}
+
+	strs := []string{}
+	for _, p := range params {
+		s, ok := p.(*evaluator.String)
+		if !ok {
+			return nil, fmt.Errorf("Error expects String arguments, got %s", p.TypeName())
+		}
+		strs = append(strs, s.Value)
+	}
+
+	if len(strs) == 1 {
+		return evaluator.NewError(strs[0], "Error"), nil
+	}
+	return evaluator.NewError(strs[0], strs[1]), nil
+}
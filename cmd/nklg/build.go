@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/niklaskorz/nklang/builtins"
+	"github.com/niklaskorz/nklang/codegen"
+)
+
+// build implements `nklg build file.nk -o out`, compiling a program to a
+// native executable through LLVM. The IR is translated by llc and linked by
+// the C compiler in $CC, clang by default. If out ends in .ll, only the IR
+// is written. With -target=wat, a WebAssembly module in text format is
+// written instead.
+func build(args []string) error {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	output := flags.String("o", "", "name of the output file")
+	target := flags.String("target", "native", "native or wat")
+	files, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("Usage: nklg build file.nk [-o output] [-target native|wat]")
+	}
+	if *target != "native" && *target != "wat" {
+		return fmt.Errorf("Unknown target %s", *target)
+	}
+
+	path := files[0]
+	if *output == "" {
+		*output = strings.TrimSuffix(filepath.Base(path), ".nk")
+		if *target == "wat" {
+			*output += ".wat"
+		}
+	}
+
+	p, err := parseFile(path, newDefinitionScope())
+	if err != nil {
+		return err
+	}
+
+	if *target == "wat" {
+		wat, err := codegen.GenerateWAT(p, builtins.Names())
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(*output, []byte(wat), 0644)
+	}
+
+	ir, err := codegen.Generate(p, builtins.Names())
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(*output, ".ll") {
+		return ioutil.WriteFile(*output, []byte(ir), 0644)
+	}
+
+	dir, err := ioutil.TempDir("", "nklg")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	llPath := filepath.Join(dir, "main.ll")
+	asmPath := filepath.Join(dir, "main.s")
+	if err := ioutil.WriteFile(llPath, []byte(ir), 0644); err != nil {
+		return err
+	}
+	if err := runTool("llc", "-relocation-model=pic", "-o", asmPath, llPath); err != nil {
+		return err
+	}
+	cc := os.Getenv("CC")
+	if cc == "" {
+		cc = "clang"
+	}
+	return runTool(cc, "-o", *output, asmPath)
+}
+
+// parseArgs parses flags that may appear before or after the positional
+// arguments and returns the positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func runTool(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "Running %s failed", name)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+
+	"github.com/niklaskorz/nklang/builtins"
+	"github.com/niklaskorz/nklang/dap"
+)
+
+// serveDAP implements `nklg dap`, running a debug adapter that speaks the
+// Debug Adapter Protocol over stdin and stdout.
+func serveDAP(args []string) error {
+	return dap.NewServer(builtins.Predefined).Serve(os.Stdin, os.Stdout)
+}
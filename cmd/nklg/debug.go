@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/niklaskorz/nklang/builtins"
+	"github.com/niklaskorz/nklang/debugger"
+	"github.com/niklaskorz/nklang/evaluator"
+)
+
+const debugHelp = `Commands:
+  b, break LINE...    set breakpoints
+  d, delete LINE...   remove breakpoints, all without lines
+  c, continue         run up to the next breakpoint
+  s, step             step to the next statement, into function calls
+  n, next             step to the next statement of the current function
+  o, out              step out of the current function
+  p, print [NAME]     print the variables of all scopes or NAME
+  bt, backtrace       print the active function calls
+  f, frame N          select frame N of the backtrace for print and list
+  l, list             print the source around the current statement
+  q, quit             end the program
+An empty line repeats the previous command.`
+
+// debug implements `nklg debug file.nk`, running a program on the evaluator
+// under control of a command line debugger.
+func debug(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: nklg debug file.nk")
+	}
+	path := args[0]
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p, err := parseFile(path, newDefinitionScope())
+	if err != nil {
+		return err
+	}
+
+	d := debugger.New()
+	c := &debugCLI{
+		d:      d,
+		file:   path,
+		lines:  strings.Split(string(src), "\n"),
+		in:     bufio.NewReader(os.Stdin),
+		global: evaluator.NewScope(),
+	}
+	d.Stopped = c.stopped
+	for _, b := range builtins.Predefined {
+		c.global.Declare(b.Name, b.Function)
+	}
+	c.global.SetHooks(d)
+
+	fmt.Println("Type h for help")
+	err = evaluator.EvaluateWithScope(p, c.global)
+	if err == debugger.ErrTerminated {
+		return nil
+	}
+	return err
+}
+
+// debugCLI reads debugger commands from stdin whenever the program pauses.
+type debugCLI struct {
+	d      *debugger.Debugger
+	file   string
+	lines  []string
+	in     *bufio.Reader
+	global *evaluator.DefinitionScope
+	// Selected frame, 0 being the innermost
+	frame   int
+	command []string
+}
+
+func (c *debugCLI) stopped(reason debugger.Reason) {
+	c.frame = 0
+	if reason == debugger.Breakpoint {
+		fmt.Println("Breakpoint reached")
+	}
+	c.printLocation()
+	for {
+		fmt.Print("(debug) ")
+		line, err := c.in.ReadString('\n')
+		if err != nil {
+			c.d.Terminate()
+			return
+		}
+		if fields := strings.Fields(line); len(fields) > 0 {
+			c.command = fields
+		}
+		if c.execute(c.command) {
+			return
+		}
+	}
+}
+
+// execute runs the command given by fields and reports whether the program
+// resumes.
+func (c *debugCLI) execute(fields []string) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	switch fields[0] {
+	case "c", "continue":
+		c.d.Continue()
+		return true
+	case "s", "step":
+		c.d.StepInto()
+		return true
+	case "n", "next":
+		c.d.StepOver()
+		return true
+	case "o", "out":
+		c.d.StepOut()
+		return true
+	case "q", "quit":
+		c.d.Terminate()
+		return true
+	case "b", "break":
+		c.setBreakpoints(fields[1:], true)
+	case "d", "delete":
+		if len(fields) == 1 {
+			c.d.SetBreakpoints(c.file, nil)
+		} else {
+			c.setBreakpoints(fields[1:], false)
+		}
+	case "p", "print":
+		if len(fields) > 1 {
+			c.printVariable(fields[1])
+		} else {
+			c.printScopes()
+		}
+	case "bt", "backtrace":
+		for i, f := range c.d.Frames() {
+			marker := " "
+			if i == c.frame {
+				marker = "*"
+			}
+			fmt.Printf("%s %d %s at %s\n", marker, i, f.Name, f.Statement.Location().Position())
+		}
+	case "f", "frame":
+		n, err := strconv.Atoi(strings.Join(fields[1:], ""))
+		if err != nil || n < 0 || n >= len(c.d.Frames()) {
+			fmt.Println("No such frame")
+			return false
+		}
+		c.frame = n
+		c.printLocation()
+	case "l", "list":
+		c.list()
+	case "h", "help":
+		fmt.Println(debugHelp)
+	default:
+		fmt.Printf("Unknown command %s, type h for help\n", fields[0])
+	}
+	return false
+}
+
+func (c *debugCLI) setBreakpoints(args []string, set bool) {
+	lines := make(map[int]bool)
+	for _, l := range c.d.Breakpoints(c.file) {
+		lines[l] = true
+	}
+	for _, a := range args {
+		l, err := strconv.Atoi(a)
+		if err != nil || l < 1 || l > len(c.lines) {
+			fmt.Printf("Invalid line %s\n", a)
+			continue
+		}
+		lines[l] = set
+	}
+	var list []int
+	for l, ok := range lines {
+		if ok {
+			list = append(list, l)
+		}
+	}
+	sort.Ints(list)
+	c.d.SetBreakpoints(c.file, list)
+	fmt.Printf("Breakpoints at lines %v\n", list)
+}
+
+func (c *debugCLI) selected() *debugger.Frame {
+	return c.d.Frames()[c.frame]
+}
+
+func (c *debugCLI) printLocation() {
+	f := c.selected()
+	s := f.Statement.Location()
+	fmt.Printf("%s in %s\n", s.Position(), f.Name)
+	if s.File == c.file && s.Line <= len(c.lines) {
+		fmt.Printf("%4d  %s\n", s.Line, strings.TrimRight(c.lines[s.Line-1], "\r"))
+	}
+}
+
+func (c *debugCLI) list() {
+	s := c.selected().Statement.Location()
+	if s.File != c.file {
+		fmt.Println("No source available")
+		return
+	}
+	breakpoints := make(map[int]bool)
+	for _, l := range c.d.Breakpoints(c.file) {
+		breakpoints[l] = true
+	}
+	for l := s.Line - 5; l <= s.Line+5; l++ {
+		if l < 1 || l > len(c.lines) {
+			continue
+		}
+		marker := " "
+		if breakpoints[l] {
+			marker = "*"
+		}
+		if l == s.Line {
+			marker += ">"
+		} else {
+			marker += " "
+		}
+		fmt.Printf("%s%4d  %s\n", marker, l, strings.TrimRight(c.lines[l-1], "\r"))
+	}
+}
+
+// printScopes prints the variables of each scope of the selected frame,
+// innermost first. Predefined functions are left out.
+func (c *debugCLI) printScopes() {
+	depth := 0
+	for scope := c.selected().Scope; scope != nil; scope = scope.Parent() {
+		var vars []string
+		for _, v := range scope.Variables() {
+			if _, ok := v.Value.(*evaluator.PredefinedFunction); ok {
+				continue
+			}
+			vars = append(vars, fmt.Sprintf("  %s = %s", v.Name, formatValue(v.Value)))
+		}
+		if len(vars) > 0 {
+			fmt.Printf("Scope %d:\n%s\n", depth, strings.Join(vars, "\n"))
+		}
+		depth++
+	}
+}
+
+func (c *debugCLI) printVariable(name string) {
+	for scope := c.selected().Scope; scope != nil; scope = scope.Parent() {
+		vars := scope.Variables()
+		// Later slots may shadow earlier ones of the same name in loops
+		for i := len(vars) - 1; i >= 0; i-- {
+			if vars[i].Name == name {
+				fmt.Printf("%s = %s\n", name, formatValue(vars[i].Value))
+				return
+			}
+		}
+	}
+	fmt.Printf("%s is not defined here\n", name)
+}
+
+// formatValue formats v like the REPL does, quoting strings.
+func formatValue(v evaluator.Object) string {
+	if s, ok := v.(*evaluator.String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return evaluator.FormatObject(v)
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+
+	"github.com/niklaskorz/nklang/builtins"
+	"github.com/niklaskorz/nklang/lsp"
+)
+
+// serveLSP implements `nklg lsp`, running a language server that speaks
+// the Language Server Protocol over stdin and stdout.
+func serveLSP(args []string) error {
+	return lsp.NewServer(builtins.Names()).Serve(os.Stdin, os.Stdout)
+}
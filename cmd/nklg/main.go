@@ -1,195 +1,167 @@
 package main
 
 import (
-	"bufio"
-	"fmt"
+	"flag"
 	"os"
-	"strconv"
-	"strings"
-
-	"github.com/pkg/errors"
 
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/builtins"
+	"github.com/niklaskorz/nklang/compiler"
 	"github.com/niklaskorz/nklang/evaluator"
 	"github.com/niklaskorz/nklang/lexer"
 	"github.com/niklaskorz/nklang/parser"
 	"github.com/niklaskorz/nklang/semantics"
+	"github.com/niklaskorz/nklang/vm"
 )
 
-func paramsToString(params []evaluator.Object) string {
-	s := ""
-	for i, p := range params {
-		if i != 0 {
-			s += " "
-		}
-		switch p := p.(type) {
-		case *evaluator.String:
-			s += p.Value
-		case *evaluator.Integer:
-			s += strconv.FormatInt(p.Value, 10)
-		case *evaluator.Float:
-			s += strconv.FormatFloat(p.Value, 'f', -1, 64)
-		case *evaluator.Boolean:
-			if p.Value {
-				s += "true"
-			} else {
-				s += "false"
-			}
-		case *evaluator.Nil:
-			s += "nil"
-		case *evaluator.Array:
-			s += "[" + paramsToString(p.Items) + "]"
-		case *evaluator.Function:
-			s += "func("
-			for j, param := range p.Function.Parameters {
-				if j != 0 {
-					s += ", "
-				}
-				s += param
-			}
-			s += ")"
-		case *evaluator.PredefinedFunction:
-			s += "[PredefinedFunction]"
-		default:
-			s += "[Object]"
-		}
-	}
-	return s
+// session holds the global scopes programs are run in, keeping them
+// between runs.
+type session struct {
+	ds    *semantics.DefinitionScope
+	scope *evaluator.DefinitionScope
+	useVM bool
 }
 
-func pfPrintln(params []evaluator.Object) (evaluator.Object, error) {
-	s := paramsToString(params)
-	fmt.Println(s)
-	return evaluator.NilObject, nil
-}
-
-func pfPrint(params []evaluator.Object) (evaluator.Object, error) {
-	s := paramsToString(params)
-	fmt.Print(s)
-	return evaluator.NilObject, nil
-}
-
-func pfInput(params []evaluator.Object) (evaluator.Object, error) {
-	pfPrint(params)
-
-	reader := bufio.NewReader(os.Stdin)
-	text, err := reader.ReadString('\n')
-	if err != nil {
-		return nil, err
+// newSession returns a session declaring the builtins, running programs on
+// the virtual machine if useVM is set and on the evaluator otherwise.
+func newSession(useVM bool) *session {
+	s := &session{ds: semantics.NewScope(), scope: evaluator.NewScope(), useVM: useVM}
+	for _, b := range builtins.Predefined {
+		s.declare(b.Name, b.Function)
 	}
-
-	return &evaluator.String{Value: text[:len(text)-1]}, nil
+	return s
 }
 
-func pfEval(params []evaluator.Object) (evaluator.Object, error) {
-	src := paramsToString(params)
-
-	s := lexer.NewScanner(strings.NewReader(src))
-	if err := s.ReadNext(); err != nil {
-		return evaluator.NilObject, errors.Wrap(err, "Scanning eval string failed")
-	}
-
-	expr, err := parser.ParseExpression(s)
-	if err != nil {
-		return evaluator.NilObject, errors.Wrap(err, "Parsing eval string failed")
-	}
-
-	if err := semantics.AnalyzeExpression(semantics.NewScope(), expr); err != nil {
-		return evaluator.NilObject, errors.Wrap(err, "Analyzing eval string failed")
-	}
-
-	result, err := evaluator.EvaluateExpression(expr, evaluator.NewScope())
-	if err != nil {
-		return evaluator.NilObject, errors.Wrap(err, "Evaluating eval string failed")
-	}
-
-	return result, nil
+// declare declares a predefined name in all scopes of s.
+func (s *session) declare(name string, value evaluator.Object) {
+	s.ds.Declare(name)
+	s.scope.Declare(name, value)
 }
 
-func runString(src string, ds *semantics.DefinitionScope, scope *evaluator.DefinitionScope) error {
-	s := lexer.NewScanner(strings.NewReader(src))
-	p, err := parser.Parse(s)
-	if err != nil {
+// run analyzes and executes p. If p fails at runtime, the declarations of
+// p that didn't run are undone, so later programs can't refer to their
+// variables.
+func (s *session) run(p *ast.Program, options ...semantics.Option) error {
+	saved := s.ds.Snapshot()
+	if err := semantics.AnalyzeLookupsWithScope(p, s.ds, options...); err != nil {
 		return err
 	}
-
-	if err := semantics.AnalyzeLookupsWithScope(p, ds); err != nil {
+	if err := s.execute(p); err != nil {
+		s.ds.Rollback(saved, s.scope.Declared)
 		return err
 	}
-
-	if err := evaluator.EvaluateWithScope(p, scope); err != nil {
-		return err
-	}
-
 	return nil
 }
 
-func runRepl(ds *semantics.DefinitionScope, scope *evaluator.DefinitionScope) error {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Println("-- nklang repl --")
-	for {
-		fmt.Print("> ")
-		text, err := reader.ReadString('\n')
+// execute executes the analyzed program p.
+func (s *session) execute(p *ast.Program) error {
+	if s.useVM {
+		program, err := compiler.Compile(p)
 		if err != nil {
 			return err
 		}
+		return vm.Run(program, s.scope)
+	}
+	return evaluator.EvaluateWithScope(p, s.scope)
+}
 
-		src := text[:len(text)-1]
-		if err := runString(src, ds, scope); err != nil {
-			fmt.Println(err)
+// variables returns the global variables of s, including the predefined
+// ones. Variables shadowed by later declarations of their name are left
+// out.
+func (s *session) variables() []evaluator.Variable {
+	vars := s.scope.Variables()
+
+	last := make(map[string]int)
+	for i, v := range vars {
+		last[v.Name] = i
+	}
+	var visible []evaluator.Variable
+	for i, v := range vars {
+		if last[v.Name] == i {
+			visible = append(visible, v)
 		}
 	}
+	return visible
 }
 
-func runFile(path string, ds *semantics.DefinitionScope, scope *evaluator.DefinitionScope) error {
-	f, err := os.Open(os.Args[1])
+// readFile parses the program at path.
+func readFile(path string) (*ast.Program, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer f.Close()
 
 	s := lexer.NewScanner(f)
-	p, err := parser.Parse(s)
+	s.File = path
+	return parser.Parse(s)
+}
+
+// parseFile parses and analyzes the program at path.
+func parseFile(path string, ds *semantics.DefinitionScope) (*ast.Program, error) {
+	p, err := readFile(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if err := semantics.AnalyzeLookupsWithScope(p, ds); err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := evaluator.EvaluateWithScope(p, scope); err != nil {
+	return p, nil
+}
+
+// runFile runs the program at path in s, analyzing it with options.
+func runFile(path string, s *session, options ...semantics.Option) error {
+	p, err := readFile(path)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return s.run(p, options...)
 }
 
-func main() {
+// newDefinitionScope returns a semantic scope declaring the builtins.
+func newDefinitionScope() *semantics.DefinitionScope {
 	ds := semantics.NewScope()
-	ds.Declare("println")
-	ds.Declare("print")
-	ds.Declare("input")
-	ds.Declare("eval")
-
-	pfPrintln := evaluator.WrapFunction(pfPrintln)
-	pfPrint := evaluator.WrapFunction(pfPrint)
-	pfInput := evaluator.WrapFunction(pfInput)
-	pfEval := evaluator.WrapFunction(pfEval)
-	scope := evaluator.NewScope()
-	scope.Declare("println", pfPrintln)
-	scope.Declare("print", pfPrint)
-	scope.Declare("input", pfInput)
-	scope.Declare("eval", pfEval)
+	for _, b := range builtins.Predefined {
+		ds.Declare(b.Name)
+	}
+	return ds
+}
+
+func main() {
+	commands := map[string]func(args []string) error{
+		"build":     build,
+		"dap":       serveDAP,
+		"debug":     debug,
+		"fmt":       nkfmt,
+		"lsp":       serveLSP,
+		"transpile": transpile,
+	}
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				evaluator.PrintError(os.Stdout, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	useVM := flag.Bool("vm", false, "run programs on the bytecode virtual machine")
+	flag.Parse()
 
 	var err error
-	if len(os.Args) < 2 {
+	if flag.NArg() < 1 {
 		// REPL mode
-		err = runRepl(ds, scope)
+		err = runRepl(*useVM)
 	} else {
 		// File mode
-		err = runFile(os.Args[1], ds, scope)
+		err = runFile(flag.Arg(0), newSession(*useVM))
 	}
 
 	if err != nil {
-		fmt.Println(err)
+		evaluator.PrintError(os.Stdout, err)
 	}
 }
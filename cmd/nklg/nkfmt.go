@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/niklaskorz/nklang/format"
+	"github.com/pkg/errors"
+)
+
+// nkfmt implements `nklg fmt file.nk...`, rewriting the files in canonical
+// formatting. Without files, the program read from stdin is printed
+// formatted. With --check, files are left unchanged and the names of those
+// that aren't formatted are listed.
+func nkfmt(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "list files whose formatting differs and fail if there are any")
+	files, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		res, err := format.Source(src)
+		if err != nil {
+			return err
+		}
+		if *check {
+			if !bytes.Equal(src, res) {
+				return fmt.Errorf("<stdin> is not formatted")
+			}
+			return nil
+		}
+		_, err = os.Stdout.Write(res)
+		return err
+	}
+
+	unformatted := 0
+	for _, path := range files {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		res, err := format.Source(src)
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+		if bytes.Equal(src, res) {
+			continue
+		}
+		if *check {
+			fmt.Println(path)
+			unformatted++
+			continue
+		}
+		if err := ioutil.WriteFile(path, res, 0644); err != nil {
+			return err
+		}
+	}
+	if unformatted > 0 {
+		return fmt.Errorf("%d of %d files are not formatted", unformatted, len(files))
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFmtCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nkfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	formatted := filepath.Join(dir, "formatted.nk")
+	unformatted := filepath.Join(dir, "unformatted.nk")
+	files := map[string]string{
+		formatted:   "x := 1 + 2;\nif x > 2 {\n    println(x);\n}\n",
+		unformatted: "x:=1+2;if x>2{println(x);}",
+	}
+	for path, src := range files {
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = nkfmt([]string{"--check", formatted, unformatted})
+	if err == nil || err.Error() != "1 of 2 files are not formatted" {
+		t.Errorf("Expected the check to fail for one file, got %v", err)
+	}
+	for path, src := range files {
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != src {
+			t.Errorf("Expected --check to leave %s unchanged, got %q", path, b)
+		}
+	}
+
+	if err := nkfmt([]string{unformatted}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(unformatted); string(b) != files[formatted] {
+		t.Errorf("Expected %s to be formatted, got %q", unformatted, b)
+	}
+	if err := nkfmt([]string{"--check", formatted, unformatted}); err != nil {
+		t.Errorf("Expected the check to pass after formatting, got %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/evaluator"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/lineedit"
+	"github.com/niklaskorz/nklang/parser"
+	"github.com/niklaskorz/nklang/semantics"
+)
+
+const replHelp = `Enter statements to run them, the values of expressions are printed.
+Input continues on lines prompted with ... until it is complete, Ctrl-C
+discards it. A missing semicolon at the end is added.
+
+Commands:
+  :help        show this help
+  :env         list the variables declared so far
+  :vars        list all variables with their types, including predefined ones
+  :load FILE   run FILE, keeping its declarations
+  :reset       remove all declarations
+  :quit        leave the REPL, as does Ctrl-D`
+
+// echoName is the name of the predefined function the REPL prints the
+// values of expression statements with. It can't be written in programs,
+// so it never clashes with their names.
+const echoName = "<echo>"
+
+// historyFile is the file in the home directory the REPL history is kept
+// in.
+const historyFile = ".nklg_history"
+
+type repl struct {
+	useVM  bool
+	s      *session
+	editor *lineedit.Editor
+	// Output of commands, errors and the values of expression statements
+	out io.Writer
+}
+
+func runRepl(useVM bool) error {
+	r := &repl{useVM: useVM, editor: lineedit.New(os.Stdin, os.Stdout), out: os.Stdout}
+	r.editor.Complete = r.complete
+	r.reset()
+	if home, err := os.UserHomeDir(); err == nil {
+		if err := r.editor.LoadHistory(filepath.Join(home, historyFile)); err != nil {
+			fmt.Fprintln(r.out, "Loading history failed:", err)
+		}
+	}
+
+	fmt.Fprintln(r.out, "-- nklang repl --")
+	for {
+		src, err := r.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if command := strings.TrimSpace(src); strings.HasPrefix(command, ":") {
+			if r.command(strings.Fields(command[1:])) {
+				return nil
+			}
+			continue
+		}
+		if err := r.runString(src); err != nil {
+			evaluator.PrintError(r.out, err)
+		}
+	}
+}
+
+// reset starts over with a new session.
+func (r *repl) reset() {
+	r.s = newSession(r.useVM)
+	r.s.declare(echoName, evaluator.WrapFunction(r.echo))
+}
+
+func (r *repl) echo(params []evaluator.Object) (evaluator.Object, error) {
+	if _, ok := params[0].(*evaluator.Nil); !ok {
+		fmt.Fprintln(r.out, formatValue(params[0]))
+	}
+	return evaluator.NilObject, nil
+}
+
+// complete returns the start of the identifier before pos in line and the
+// declared names and keywords it may be completed to.
+func (r *repl) complete(line string, pos int) (int, []string) {
+	runes := []rune(line)
+	start := pos
+	for start > 0 && isIdentifierRune(runes[start-1]) {
+		start--
+	}
+	if start > 0 && runes[start-1] == '.' || start < pos && unicode.IsDigit(runes[start]) {
+		// Members and numbers aren't completed
+		return start, nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(line), ":") {
+		return start, nil
+	}
+
+	prefix := string(runes[start:pos])
+	var words []string
+	for _, name := range r.s.ds.Names() {
+		if strings.HasPrefix(name, prefix) && name != echoName {
+			words = append(words, name)
+		}
+	}
+	for keyword := range lexer.Keywords {
+		if strings.HasPrefix(keyword, prefix) {
+			words = append(words, keyword)
+		}
+	}
+	return start, words
+}
+
+func isIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// read reads lines up to the end of a complete program or a command.
+func (r *repl) read() (string, error) {
+	src := ""
+	prompt := "> "
+	for {
+		line, err := r.editor.ReadLine(prompt)
+		if err == lineedit.ErrInterrupted {
+			src, prompt = "", "> "
+			continue
+		}
+		if err == io.EOF && src != "" {
+			// Run the incomplete input to report its error
+			return src, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := r.editor.AddHistory(line); err != nil {
+			fmt.Fprintln(r.out, "Saving history failed:", err)
+		}
+
+		src += line + "\n"
+		if strings.HasPrefix(strings.TrimSpace(src), ":") {
+			return src, nil
+		}
+		if _, incomplete, _ := parseInput(src); !incomplete {
+			return src, nil
+		}
+		prompt = "... "
+	}
+}
+
+// parseInput parses src, adding a missing semicolon at its end. It reports
+// whether src is incomplete, that is it ends too early but could continue
+// on further lines.
+func parseInput(src string) (*ast.Program, bool, error) {
+	p, err := parseString(src)
+	if !endsEarly(err) {
+		return p, false, err
+	}
+	if p, err := parseString(src + ";"); err == nil {
+		return p, false, nil
+	}
+	return nil, true, err
+}
+
+func parseString(src string) (*ast.Program, error) {
+	s := lexer.NewScanner(strings.NewReader(src))
+	s.File = "<repl>"
+	return parser.Parse(s)
+}
+
+// endsEarly reports whether err was caused by the end of the input.
+func endsEarly(err error) bool {
+	switch err := err.(type) {
+	case parser.UnexpectedTokenError:
+		return err.Token.Type == lexer.EOF
+	case lexer.UnterminatedStringError, lexer.UnterminatedCommentError:
+		return true
+	}
+	return false
+}
+
+func (r *repl) runString(src string) error {
+	p, _, err := parseInput(src)
+	if err != nil {
+		return err
+	}
+
+	for i, n := range p.Statements {
+		if n, ok := n.(*ast.ExpressionStatement); ok {
+			p.Statements[i] = &ast.ExpressionStatement{
+				Span: n.Span,
+				Expression: &ast.CallExpression{
+					Span:       n.Span,
+					Callee:     &ast.LookupExpression{Span: n.Span, Identifier: echoName},
+					Parameters: []ast.Expression{n.Expression},
+				},
+			}
+		}
+	}
+
+	return r.s.run(p, semantics.ShadowRedeclarations)
+}
+
+// command runs the REPL command given by fields and reports whether the
+// REPL should quit.
+func (r *repl) command(fields []string) bool {
+	if len(fields) == 0 {
+		fmt.Fprintln(r.out, replHelp)
+		return false
+	}
+	switch fields[0] {
+	case "help", "h":
+		fmt.Fprintln(r.out, replHelp)
+	case "env":
+		for _, v := range r.s.variables() {
+			if _, ok := v.Value.(*evaluator.PredefinedFunction); !ok {
+				fmt.Fprintf(r.out, "%s = %s\n", v.Name, formatValue(v.Value))
+			}
+		}
+	case "vars":
+		w := tabwriter.NewWriter(r.out, 0, 4, 2, ' ', 0)
+		for _, v := range r.s.variables() {
+			if v.Name != echoName {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", v.Name, v.Value.TypeName(), shorten(formatValue(v.Value), 50))
+			}
+		}
+		w.Flush()
+	case "load":
+		if len(fields) != 2 {
+			fmt.Fprintln(r.out, "Usage: :load FILE")
+			break
+		}
+		// Like typed input, loaded files may redeclare earlier variables
+		if err := runFile(fields[1], r.s, semantics.ShadowRedeclarations); err != nil {
+			evaluator.PrintError(r.out, err)
+		}
+	case "reset":
+		r.reset()
+	case "quit", "q":
+		return true
+	default:
+		fmt.Fprintf(r.out, "Unknown command :%s, type :help for help\n", fields[0])
+	}
+	return false
+}
+
+// shorten cuts s to at most n runes, marking a cut with "...".
+func shorten(s string, n int) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i] + "..."
+	}
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n-3]) + "..."
+	}
+	return s
+}
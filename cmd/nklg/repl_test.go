@@ -0,0 +1,202 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newTestRepl returns a REPL whose output is collected in the returned
+// builder.
+func newTestRepl(useVM bool) (*repl, *strings.Builder) {
+	out := &strings.Builder{}
+	r := &repl{useVM: useVM, out: out}
+	r.reset()
+	return r, out
+}
+
+// runAll runs the inputs in r, failing if any of them fails.
+func runAll(t *testing.T, r *repl, inputs ...string) {
+	t.Helper()
+	for _, src := range inputs {
+		if err := r.runString(src); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", src, err)
+		}
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	tests := []struct {
+		src        string
+		incomplete bool
+		err        bool
+	}{
+		{src: "x := 1;\n"},
+		{src: "1 + 2\n"},
+		{src: "f := func(a) {\n", incomplete: true},
+		{src: "while true {\nprintln(1);\n", incomplete: true},
+		{src: "println(1,\n", incomplete: true},
+		{src: "s := \"abc\n", incomplete: true},
+		{src: "/* comment\n", incomplete: true},
+		{src: "f := func(a) {\nreturn a;\n}\n"},
+		{src: "1 +* 2;\n", err: true},
+		{src: ")\n", err: true},
+	}
+	for _, test := range tests {
+		p, incomplete, err := parseInput(test.src)
+		if incomplete != test.incomplete {
+			t.Errorf("Expected %q to be incomplete: %t, got %t", test.src, test.incomplete, incomplete)
+		}
+		if (err != nil) != (test.err || test.incomplete) {
+			t.Errorf("Unexpected error for %q: %v", test.src, err)
+		}
+		if err == nil && p == nil {
+			t.Errorf("Expected %q to be parsed", test.src)
+		}
+		if incomplete && !endsEarly(err) {
+			t.Errorf("Expected the error of %q to end early, got %v", test.src, err)
+		}
+	}
+}
+
+func TestFailedDeclarationsAreUndone(t *testing.T) {
+	for _, useVM := range []bool{false, true} {
+		r, _ := newTestRepl(useVM)
+		expectRun := func(src, expectedErr string) {
+			t.Helper()
+			err := r.runString(src)
+			if expectedErr == "" && err != nil {
+				t.Errorf("vm %t: Unexpected error for %q: %v", useVM, src, err)
+			}
+			if expectedErr != "" && (err == nil || !strings.Contains(err.Error(), expectedErr)) {
+				t.Errorf("vm %t: Expected error %q for %q, got %v", useVM, expectedErr, src, err)
+			}
+		}
+
+		expectRun("z := [1][9];", "Index 9 out of bounds")
+		expectRun("y := z;", "z must be declared before usage")
+
+		expectRun("a := 1; b := a + nil;", "cannot apply '+'")
+		expectRun("c := a;", "")
+		expectRun("d := b;", "b must be declared before usage")
+
+		// A redeclaration that fails leaves the previous variable visible
+		expectRun("a := [][0];", "Index 0 out of bounds")
+		expectRun("a = a + 1;", "")
+
+		var names []string
+		for _, v := range r.s.variables() {
+			names = append(names, v.Name+"="+formatValue(v.Value))
+		}
+		if vars := strings.Join(names, " "); !strings.HasSuffix(vars, " a=2 c=1") || strings.Contains(vars, "z=") || strings.Contains(vars, "b=") {
+			t.Errorf("vm %t: Unexpected variables %s", useVM, vars)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	r, _ := newTestRepl(false)
+	runAll(t, r, "counter := 1; count2 := 2;", "ä := 3;")
+
+	tests := []struct {
+		line  string
+		pos   int
+		start int
+		words []string
+	}{
+		{line: "x := cou", pos: 8, start: 5, words: []string{"count2", "counter"}},
+		{line: "r", pos: 1, words: []string{"range", "return"}},
+		{line: "whi", pos: 3, words: []string{"while"}},
+		{line: "println(cou)", pos: 11, start: 8, words: []string{"count2", "counter"}},
+		{line: "x := ä", pos: 6, start: 5, words: []string{"ä"}},
+		{line: "x.cou", pos: 5, start: 2},
+		{line: "12", pos: 2},
+		{line: ":lo", pos: 3, start: 1},
+		{line: "xyz", pos: 3},
+	}
+	for _, test := range tests {
+		start, words := r.complete(test.line, test.pos)
+		sort.Strings(words)
+		if start != test.start || strings.Join(words, " ") != strings.Join(test.words, " ") {
+			t.Errorf("Expected %q to complete from %d to %v, got %d and %v", test.line, test.start, test.words, start, words)
+		}
+	}
+
+	_, words := r.complete("", 0)
+	for _, w := range words {
+		if w == echoName {
+			t.Errorf("Expected %s not to be completed", echoName)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	for _, useVM := range []bool{false, true} {
+		r, out := newTestRepl(useVM)
+		runAll(t, r,
+			"n := 42;",
+			"n := [1, 2];",
+			"s := \"a long string that doesn't fit into the column of values\";",
+			"m := {\"a\": \"x\\ny\"};",
+			"struct P { x }",
+			"f := func(a) { return P(a); };",
+			"f(1)",
+		)
+		if echoed := out.String(); echoed != "P{x: 1}\n" {
+			t.Errorf("vm %t: Expected the value of f(1) to be echoed, got %q", useVM, echoed)
+		}
+
+		out.Reset()
+		r.command([]string{"vars"})
+		expected := `println  Function  [PredefinedFunction]
+print    Function  [PredefinedFunction]
+input    Function  [PredefinedFunction]
+eval     Function  [PredefinedFunction]
+range    Function  [PredefinedFunction]
+Error    Function  [PredefinedFunction]
+n        Array     [1 2]
+s        String    "a long string that doesn't fit into the column...
+m        Map       {a: x...
+P        Struct    struct P
+f        Function  func(a)
+`
+		if out.String() != expected {
+			t.Errorf("vm %t: Expected :vars to print\n%s\ngot\n%s", useVM, expected, out.String())
+		}
+
+		out.Reset()
+		r.command([]string{"env"})
+		expected = `n = [1 2]
+s = "a long string that doesn't fit into the column of values"
+m = {a: x
+y}
+P = struct P
+f = func(a)
+`
+		if out.String() != expected {
+			t.Errorf("vm %t: Expected :env to print\n%s\ngot\n%s", useVM, expected, out.String())
+		}
+	}
+}
+
+func TestRedeclarationsKeepClosuresOfShadowedVariables(t *testing.T) {
+	for _, useVM := range []bool{false, true} {
+		r, out := newTestRepl(useVM)
+		runAll(t, r,
+			"x := 1;",
+			"get := func() { return x; };",
+			"set := func(v) { x = v; };",
+			"class C { old() { return x; } }",
+			"x := \"new\";",
+			"set(2);",
+			"get()",
+			"C().old()",
+			"x",
+			"x = \"assigned\";",
+			"get()",
+		)
+		if expected := "2\n2\n\"new\"\n2\n"; out.String() != expected {
+			t.Errorf("vm %t: Expected output %q, got %q", useVM, expected, out.String())
+		}
+	}
+}
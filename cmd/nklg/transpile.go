@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/niklaskorz/nklang/builtins"
+	"github.com/niklaskorz/nklang/transpiler"
+)
+
+// transpile implements `nklg transpile file.nk`, printing the program as
+// Go source code or writing it to the file given with -o.
+func transpile(args []string) error {
+	flags := flag.NewFlagSet("transpile", flag.ExitOnError)
+	output := flags.String("o", "", "name of the output file, stdout if empty")
+	files, err := parseArgs(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("Usage: nklg transpile file.nk [-o output.go]")
+	}
+
+	p, err := parseFile(files[0], newDefinitionScope())
+	if err != nil {
+		return err
+	}
+	src, err := transpiler.Transpile(p, builtins.Names())
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err := os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(*output, src, 0644)
+}
@@ -0,0 +1,466 @@
+package codegen
+
+import (
+	"github.com/niklaskorz/nklang/ast"
+)
+
+type entityKind int
+
+const (
+	variableEntity entityKind = iota
+	functionEntity
+	predefinedEntity
+)
+
+// entity is what a slot of a scope refers to.
+type entity struct {
+	kind entityKind
+	name string
+	// Type of variables
+	typ *typeVar
+	// Set for top level variables, which become LLVM globals
+	global bool
+	// Set for functions
+	function *function
+	// LLVM pointer of the variable's storage, assigned during generation
+	ptr string
+}
+
+// function is a top level function declaration compiled to an LLVM function.
+type function struct {
+	*ast.Function
+	parameters []*entity
+	result     *typeVar
+	returns    bool
+}
+
+// scope mirrors the definition scopes of the semantic analysis, so slots
+// resolve to the same entities.
+type scope struct {
+	parent *scope
+	slots  []*entity
+}
+
+func (s *scope) newScope() *scope {
+	return &scope{parent: s}
+}
+
+func (s *scope) declare(slot int, e *entity) {
+	for len(s.slots) <= slot {
+		s.slots = append(s.slots, nil)
+	}
+	s.slots[slot] = e
+}
+
+func (s *scope) lookup(index, slot int) *entity {
+	for ; index > 0; index-- {
+		s = s.parent
+	}
+	return s.slots[slot]
+}
+
+// valueUse is an expression whose value is used, so its type must not be
+// void once all types are known.
+type valueUse struct {
+	node ast.Node
+	typ  *typeVar
+}
+
+// checker infers the static types of a program and reports anything outside
+// of the natively compiled subset.
+type checker struct {
+	globals   *scope
+	functions []*function
+	// Function whose body is being checked, nil at the top level
+	current *function
+	loops   int
+
+	entities map[ast.Node]*entity
+	types    map[ast.Expression]*typeVar
+	uses     []valueUse
+	// Operands of arithmetic, which must not turn out to be Boolean
+	numbers []valueUse
+	// Variables of each function, including the main function at nil
+	variables map[*function][]*entity
+}
+
+func newChecker(predefined []string) *checker {
+	c := &checker{
+		globals:   &scope{},
+		entities:  make(map[ast.Node]*entity),
+		types:     make(map[ast.Expression]*typeVar),
+		variables: make(map[*function][]*entity),
+	}
+	for i, name := range predefined {
+		c.globals.declare(i, &entity{kind: predefinedEntity, name: name})
+	}
+	return c
+}
+
+func (c *checker) checkProgram(p *ast.Program) error {
+	for _, s := range p.Statements {
+		if err := c.checkStatement(c.globals, s); err != nil {
+			return err
+		}
+	}
+
+	for _, u := range c.uses {
+		if u.typ.get() == void {
+			return newError(u.node, "Expression has no value")
+		}
+	}
+	for _, u := range c.numbers {
+		if u.typ.get() == boolean {
+			return newError(u.node, "Expected a number, got Boolean")
+		}
+	}
+	// Types that are still unknown belong to values that are never used in
+	// a way that would determine them
+	for _, t := range c.types {
+		if t.get() == unknown {
+			unify(t, newType(integer))
+		}
+	}
+	for _, vars := range c.variables {
+		for _, v := range vars {
+			if v.typ.get() == unknown {
+				unify(v.typ, newType(integer))
+			}
+		}
+	}
+	for _, f := range c.functions {
+		for _, p := range f.parameters {
+			if p.typ.get() == unknown {
+				unify(p.typ, newType(integer))
+			}
+		}
+		if f.result.get() == unknown {
+			unify(f.result, newType(integer))
+		}
+	}
+	return nil
+}
+
+func (c *checker) checkStatements(s *scope, statements []ast.Statement) error {
+	for _, n := range statements {
+		if err := c.checkStatement(s, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *checker) checkStatement(s *scope, n ast.Statement) error {
+	switch n := n.(type) {
+	case *ast.IfStatement:
+		if n.Condition != nil {
+			if err := c.checkCondition(s, n.Condition); err != nil {
+				return err
+			}
+		}
+		if err := c.checkStatements(s.newScope(), n.Statements); err != nil {
+			return err
+		}
+		if n.ElseBranch != nil {
+			return c.checkStatement(s, n.ElseBranch)
+		}
+	case *ast.WhileStatement:
+		if err := c.checkCondition(s, n.Condition); err != nil {
+			return err
+		}
+		c.loops++
+		err := c.checkStatements(s.newScope(), n.Statements)
+		c.loops--
+		return err
+	case *ast.DeclarationStatement:
+		if f, ok := n.Value.(*ast.Function); ok {
+			return c.checkFunction(s, n, f)
+		}
+		e := &entity{kind: variableEntity, name: n.Identifier, typ: newType(unknown), global: s == c.globals}
+		s.declare(n.Slot, e)
+		c.entities[n] = e
+		c.variables[c.current] = append(c.variables[c.current], e)
+		t, err := c.checkValue(s, n.Value)
+		if err != nil {
+			return err
+		}
+		if !unify(e.typ, t) {
+			return newError(n, "%s is declared with a value of type %s", n.Identifier, t.get())
+		}
+	case *ast.AssignmentStatement:
+		e := s.lookup(n.ScopeIndex, n.Slot)
+		if e == nil || e.kind != variableEntity {
+			return unsupported(n, "Assignments to functions are")
+		}
+		c.entities[n] = e
+		t, err := c.checkValue(s, n.Value)
+		if err != nil {
+			return err
+		}
+		if !unify(e.typ, t) {
+			return newError(n, "Can't assign %s to %s of type %s", t.get(), n.Identifier, e.typ.get())
+		}
+	case *ast.ReturnStatement:
+		if c.current == nil {
+			return newError(n, "Return outside of function")
+		}
+		t, err := c.checkValue(s, n.Expression)
+		if err != nil {
+			return err
+		}
+		c.current.returns = true
+		if !unify(c.current.result, t) {
+			return newError(n, "Function %s returns both %s and %s", c.current.Name, c.current.result.get(), t.get())
+		}
+	case *ast.ContinueStatement, *ast.BreakStatement:
+		if c.loops == 0 {
+			return newError(n, "Continue or break outside of loop")
+		}
+	case *ast.ExpressionStatement:
+		_, err := c.checkExpression(s, n.Expression)
+		return err
+	case *ast.ForStatement:
+		return unsupported(n, "For loops are")
+	case *ast.StructDeclaration:
+		return unsupported(n, "Structs are")
+	case *ast.ClassDeclaration:
+		return unsupported(n, "Classes are")
+	case *ast.TryStatement, *ast.ThrowStatement:
+		return unsupported(n, "Exceptions are")
+	case *ast.SubscriptAssignmentStatement:
+		return unsupported(n, "Subscripts are")
+	case *ast.MemberAssignmentStatement:
+		return unsupported(n, "Members are")
+	}
+	return nil
+}
+
+// checkFunction checks the declaration n of the function f. Only top level
+// functions that don't capture local variables are supported, so they can
+// be compiled to plain LLVM functions.
+func (c *checker) checkFunction(s *scope, n *ast.DeclarationStatement, f *ast.Function) error {
+	if s != c.globals {
+		return unsupported(f, "Functions declared outside of the top level are")
+	}
+	for _, capture := range f.Captures {
+		if capture.ScopeIndex != 0 {
+			return unsupported(f, "Closures are")
+		}
+	}
+
+	fn := &function{Function: f, result: newType(unknown)}
+	c.functions = append(c.functions, fn)
+	e := &entity{kind: functionEntity, name: n.Identifier, function: fn}
+	s.declare(n.Slot, e)
+	c.entities[n] = e
+
+	captures := &scope{}
+	for i, capture := range f.Captures {
+		captures.declare(i, c.globals.lookup(0, capture.Slot))
+	}
+	parameters := captures.newScope()
+	for i, name := range f.Parameters {
+		p := &entity{kind: variableEntity, name: name, typ: newType(unknown)}
+		fn.parameters = append(fn.parameters, p)
+		parameters.declare(i, p)
+	}
+
+	current, loops := c.current, c.loops
+	c.current, c.loops = fn, 0
+	err := c.checkStatements(parameters.newScope(), f.Statements)
+	c.current, c.loops = current, loops
+	if err != nil {
+		return err
+	}
+	if !fn.returns {
+		unify(fn.result, newType(void))
+	}
+	return nil
+}
+
+// checkCondition checks a condition, which may be of any type with a value.
+func (c *checker) checkCondition(s *scope, n ast.Expression) error {
+	_, err := c.checkValue(s, n)
+	return err
+}
+
+// checkValue checks an expression whose value is used.
+func (c *checker) checkValue(s *scope, n ast.Expression) (*typeVar, error) {
+	t, err := c.checkExpression(s, n)
+	if err != nil {
+		return nil, err
+	}
+	c.uses = append(c.uses, valueUse{node: n, typ: t})
+	return t, nil
+}
+
+func (c *checker) checkExpression(s *scope, n ast.Expression) (*typeVar, error) {
+	t, err := c.inferExpression(s, n)
+	if err != nil {
+		return nil, err
+	}
+	c.types[n] = t
+	return t, nil
+}
+
+func (c *checker) inferExpression(s *scope, n ast.Expression) (*typeVar, error) {
+	switch n := n.(type) {
+	case *ast.Integer:
+		return newType(integer), nil
+	case *ast.Float:
+		return newType(float), nil
+	case *ast.Boolean:
+		return newType(boolean), nil
+	case *ast.LookupExpression:
+		e := s.lookup(n.ScopeIndex, n.Slot)
+		if e.kind != variableEntity {
+			return nil, unsupported(n, "Functions as values are")
+		}
+		c.entities[n] = e
+		return e.typ, nil
+	case *ast.IfExpression:
+		return c.checkIfExpression(s, n)
+	case *ast.BinaryOperationExpression:
+		return c.checkBinaryOperation(s, n)
+	case *ast.UnaryOperationExpression:
+		t, err := c.checkValue(s, n.A)
+		if err != nil {
+			return nil, err
+		}
+		if n.Operator == ast.UnaryOperatorLnot {
+			return newType(boolean), nil
+		}
+		c.numbers = append(c.numbers, valueUse{node: n.A, typ: t})
+		return t, nil
+	case *ast.CallExpression:
+		return c.checkCall(s, n)
+	case *ast.String, *ast.InterpolatedString:
+		return nil, unsupported(n, "Strings outside of print and println are")
+	case *ast.Nil:
+		return nil, unsupported(n, "Nil is")
+	case *ast.Function:
+		return nil, unsupported(n, "Functions as values are")
+	case *ast.ArrayExpression:
+		return nil, unsupported(n, "Arrays are")
+	case *ast.MapExpression:
+		return nil, unsupported(n, "Maps are")
+	case *ast.SubscriptExpression:
+		return nil, unsupported(n, "Subscripts are")
+	case *ast.MemberExpression:
+		return nil, unsupported(n, "Members are")
+	}
+	return nil, unsupported(n, "Expression is")
+}
+
+func (c *checker) checkIfExpression(s *scope, n *ast.IfExpression) (*typeVar, error) {
+	if n.Condition != nil {
+		if err := c.checkCondition(s, n.Condition); err != nil {
+			return nil, err
+		}
+	}
+	t, err := c.checkValue(s, n.Value)
+	if err != nil {
+		return nil, err
+	}
+	if n.ElseBranch == nil {
+		return t, nil
+	}
+	e, err := c.checkExpression(s, n.ElseBranch)
+	if err != nil {
+		return nil, err
+	}
+	if !unify(t, e) {
+		return nil, newError(n, "Branches have different types %s and %s", t.get(), e.get())
+	}
+	return t, nil
+}
+
+func (c *checker) checkBinaryOperation(s *scope, n *ast.BinaryOperationExpression) (*typeVar, error) {
+	a, err := c.checkValue(s, n.A)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.checkValue(s, n.B)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Operator {
+	case ast.BinaryOperatorLand, ast.BinaryOperatorLor:
+		if !unify(a, newType(boolean)) || !unify(b, newType(boolean)) {
+			return nil, newError(n, "Operator %s expects Boolean operands", n.Operator)
+		}
+		return a, nil
+	case ast.BinaryOperatorEq, ast.BinaryOperatorNe:
+		if isNumeric(a, b) {
+			return newType(boolean), nil
+		}
+		if !unify(a, b) {
+			return nil, newError(n, "Can't compare %s and %s", a.get(), b.get())
+		}
+		return newType(boolean), nil
+	}
+
+	c.numbers = append(c.numbers, valueUse{node: n.A, typ: a}, valueUse{node: n.B, typ: b})
+	result := a
+	if !isNumeric(a, b) && !unify(a, b) {
+		return nil, newError(n, "Operator %s not supported for %s and %s", n.Operator, a.get(), b.get())
+	}
+	if a.get() != b.get() {
+		// Mixed Integer and Float operands are converted to Float
+		result = newType(float)
+	}
+	switch n.Operator {
+	case ast.BinaryOperatorLt, ast.BinaryOperatorLe, ast.BinaryOperatorGt, ast.BinaryOperatorGe:
+		return newType(boolean), nil
+	}
+	return result, nil
+}
+
+// isNumeric reports whether a and b are both known to be numbers.
+func isNumeric(a, b *typeVar) bool {
+	ka, kb := a.get(), b.get()
+	return (ka == integer || ka == float) && (kb == integer || kb == float)
+}
+
+func (c *checker) checkCall(s *scope, n *ast.CallExpression) (*typeVar, error) {
+	l, ok := n.Callee.(*ast.LookupExpression)
+	if !ok {
+		return nil, unsupported(n, "Calls of computed functions are")
+	}
+	e := s.lookup(l.ScopeIndex, l.Slot)
+	switch e.kind {
+	case variableEntity:
+		return nil, unsupported(n, "Calls of variables are")
+	case predefinedEntity:
+		if e.name != "print" && e.name != "println" {
+			return nil, unsupported(n, "Predefined function "+e.name+" is")
+		}
+		c.entities[n] = e
+		for _, p := range n.Parameters {
+			if _, ok := p.(*ast.String); ok {
+				continue
+			}
+			if _, err := c.checkValue(s, p); err != nil {
+				return nil, err
+			}
+		}
+		return newType(void), nil
+	}
+
+	c.entities[n] = e
+	f := e.function
+	if len(n.Parameters) != len(f.Parameters) {
+		return nil, newError(n, "Expected %d arguments, got %d", len(f.Parameters), len(n.Parameters))
+	}
+	for i, p := range n.Parameters {
+		t, err := c.checkValue(s, p)
+		if err != nil {
+			return nil, err
+		}
+		if !unify(f.parameters[i].typ, t) {
+			return nil, newError(p, "Parameter %s of %s has type %s, got %s", f.Parameters[i], f.Name, f.parameters[i].typ.get(), t.get())
+		}
+	}
+	return f.result, nil
+}
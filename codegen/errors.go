@@ -0,0 +1,26 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// Error reports a construct at Span that can't be compiled natively,
+// usually because it relies on dynamic typing.
+type Error struct {
+	Span    ast.Span
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span.Position(), e.Message)
+}
+
+func newError(n ast.Node, format string, a ...interface{}) *Error {
+	return &Error{Span: n.Location(), Message: fmt.Sprintf(format, a...)}
+}
+
+func unsupported(n ast.Node, feature string) *Error {
+	return newError(n, "%s not supported by native compilation", feature)
+}
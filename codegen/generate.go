@@ -0,0 +1,459 @@
+// Package codegen compiles a statically typed subset of nklang to LLVM IR
+// and to WebAssembly text. The LLVM IR is written as text by hand instead of
+// being built with github.com/llir/llvm, which llvm-tests experiments with,
+// so the module doesn't depend on it; llc reads the text all the same.
+package codegen
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// Generate compiles p to a textual LLVM IR module with a main function
+// running the top level statements. predefined lists the names declared in
+// the global scope of the semantic analysis, in order of declaration. Only
+// a statically typed subset of nklang is supported: Integer, Float and
+// Boolean values, top level functions, if and while. Anything else is
+// reported as an *Error.
+func Generate(p *ast.Program, predefined []string) (string, error) {
+	c := newChecker(predefined)
+	if err := c.checkProgram(p); err != nil {
+		return "", err
+	}
+
+	g := &generator{checker: c}
+	main := g.generateMain(p)
+	var functions []string
+	for _, f := range c.functions {
+		functions = append(functions, g.generateFunction(f))
+	}
+
+	var b strings.Builder
+	b.WriteString(runtime)
+	b.WriteString("\n")
+	b.WriteString(g.constants.String())
+	b.WriteString("\n")
+	for _, f := range functions {
+		b.WriteString(f)
+		b.WriteString("\n")
+	}
+	b.WriteString(main)
+	return b.String(), nil
+}
+
+type loop struct {
+	continueLabel string
+	breakLabel    string
+}
+
+type generator struct {
+	*checker
+	// Globals and string constants of the module
+	constants strings.Builder
+	strings   int
+
+	// State of the function being generated
+	allocas    strings.Builder
+	code       strings.Builder
+	temporary  int
+	label      int
+	block      string
+	terminated bool
+	loops      []loop
+	current    *function
+}
+
+// quote returns name as quoted LLVM identifier with the given prefix.
+func quote(prefix, name string) string {
+	return prefix + `"` + strings.Replace(name, `"`, `\22`, -1) + `"`
+}
+
+func (g *generator) reset(f *function) {
+	g.allocas.Reset()
+	g.code.Reset()
+	g.temporary = 0
+	g.label = 0
+	g.block = "entry"
+	g.terminated = false
+	g.loops = nil
+	g.current = f
+}
+
+func (g *generator) generateMain(p *ast.Program) string {
+	g.reset(nil)
+	g.generateStatements(p.Statements)
+	g.terminate("ret i32 0")
+	return "define i32 @main() {\nentry:\n" + g.allocas.String() + g.code.String() + "}\n"
+}
+
+func (g *generator) generateFunction(f *function) string {
+	g.reset(f)
+	var parameters []string
+	for _, p := range f.parameters {
+		t := p.typ.get().llvm()
+		arg := quote("%", "arg."+p.name)
+		parameters = append(parameters, t+" "+arg)
+		g.declareLocal(p)
+		g.emit("store %s %s, %s* %s", t, arg, t, p.ptr)
+	}
+	g.generateStatements(f.Statements)
+
+	result := f.result.get()
+	if !g.terminated {
+		if result == void {
+			g.terminate("ret void")
+		} else {
+			g.fail(f, fmt.Sprintf("Function %s ended without returning a value", f.Name))
+		}
+	}
+	return fmt.Sprintf("define internal %s %s(%s) {\nentry:\n%s%s}\n",
+		result.llvm(), quote("@", "nk."+f.Name), strings.Join(parameters, ", "), g.allocas.String(), g.code.String())
+}
+
+// emit appends an instruction to the current block. Instructions following
+// a terminator are unreachable and get a block of their own.
+func (g *generator) emit(format string, a ...interface{}) {
+	if g.terminated {
+		g.startBlock(g.newLabel("dead"))
+	}
+	g.code.WriteString("  ")
+	fmt.Fprintf(&g.code, format, a...)
+	g.code.WriteString("\n")
+}
+
+// temp emits an instruction whose result is assigned to a new temporary
+// and returns the temporary.
+func (g *generator) temp(format string, a ...interface{}) string {
+	g.temporary++
+	t := fmt.Sprintf("%%t%d", g.temporary)
+	g.emit("%s = "+format, append([]interface{}{t}, a...)...)
+	return t
+}
+
+func (g *generator) newLabel(name string) string {
+	g.label++
+	return fmt.Sprintf("%s.%d", name, g.label)
+}
+
+// terminate ends the current block with the terminator instruction, unless
+// it has been terminated already.
+func (g *generator) terminate(format string, a ...interface{}) {
+	if !g.terminated {
+		g.emit(format, a...)
+		g.terminated = true
+	}
+}
+
+func (g *generator) branch(label string) {
+	g.terminate("br label %%%s", label)
+}
+
+// startBlock starts the block label, falling through from the current
+// block.
+func (g *generator) startBlock(label string) {
+	g.branch(label)
+	fmt.Fprintf(&g.code, "%s:\n", label)
+	g.block = label
+	g.terminated = false
+}
+
+// fail ends the current block with a runtime error at n.
+func (g *generator) fail(n ast.Node, message string) {
+	s := g.stringConstant(fmt.Sprintf("%s: %s", n.Location().Position(), message))
+	g.emit("call void @nkrt.fail(i8* %s)", s)
+	g.terminate("unreachable")
+}
+
+// stringConstant adds s as null terminated constant to the module and
+// returns a pointer to its first character.
+func (g *generator) stringConstant(s string) string {
+	g.strings++
+	name := fmt.Sprintf("@.str.%d", g.strings)
+	t := fmt.Sprintf("[%d x i8]", len(s)+1)
+	var value strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= ' ' && c <= '~' && c != '"' && c != '\\' {
+			value.WriteByte(c)
+		} else {
+			fmt.Fprintf(&value, "\\%02X", c)
+		}
+	}
+	fmt.Fprintf(&g.constants, "%s = private unnamed_addr constant %s c\"%s\\00\"\n", name, t, value.String())
+	return fmt.Sprintf("getelementptr inbounds (%s, %s* %s, i64 0, i64 0)", t, t, name)
+}
+
+// declareLocal allocates the storage of a local variable in the entry block.
+func (g *generator) declareLocal(e *entity) {
+	g.temporary++
+	e.ptr = quote("%", fmt.Sprintf("%s.%d", e.name, g.temporary))
+	fmt.Fprintf(&g.allocas, "  %s = alloca %s\n", e.ptr, e.typ.get().llvm())
+}
+
+func (g *generator) declareGlobal(e *entity) {
+	e.ptr = quote("@", "nk."+e.name)
+	zero := "0"
+	switch e.typ.get() {
+	case float:
+		zero = "0.0"
+	case boolean:
+		zero = "false"
+	}
+	fmt.Fprintf(&g.constants, "%s = internal global %s %s\n", e.ptr, e.typ.get().llvm(), zero)
+}
+
+func (g *generator) generateStatements(statements []ast.Statement) {
+	for _, n := range statements {
+		g.generateStatement(n)
+	}
+}
+
+func (g *generator) generateStatement(n ast.Statement) {
+	switch n := n.(type) {
+	case *ast.IfStatement:
+		end := g.newLabel("if.end")
+		g.generateIfStatement(n, end)
+		g.startBlock(end)
+	case *ast.WhileStatement:
+		l := loop{continueLabel: g.newLabel("while.cond"), breakLabel: g.newLabel("while.end")}
+		body := g.newLabel("while.body")
+		g.startBlock(l.continueLabel)
+		cond := g.generateCondition(n.Condition)
+		g.terminate("br i1 %s, label %%%s, label %%%s", cond, body, l.breakLabel)
+		g.startBlock(body)
+		g.loops = append(g.loops, l)
+		g.generateStatements(n.Statements)
+		g.loops = g.loops[:len(g.loops)-1]
+		g.branch(l.continueLabel)
+		g.startBlock(l.breakLabel)
+	case *ast.ContinueStatement:
+		g.branch(g.loops[len(g.loops)-1].continueLabel)
+	case *ast.BreakStatement:
+		g.branch(g.loops[len(g.loops)-1].breakLabel)
+	case *ast.DeclarationStatement:
+		e := g.entities[n]
+		if e.kind == functionEntity {
+			return
+		}
+		if e.global {
+			g.declareGlobal(e)
+		} else {
+			g.declareLocal(e)
+		}
+		g.store(e, g.generateExpression(n.Value))
+	case *ast.AssignmentStatement:
+		g.store(g.entities[n], g.generateExpression(n.Value))
+	case *ast.ReturnStatement:
+		v := g.generateExpression(n.Expression)
+		g.terminate("ret %s %s", g.current.result.get().llvm(), v)
+	case *ast.ExpressionStatement:
+		g.generateExpression(n.Expression)
+	}
+}
+
+func (g *generator) store(e *entity, v string) {
+	t := e.typ.get().llvm()
+	g.emit("store %s %s, %s* %s", t, v, t, e.ptr)
+}
+
+// generateIfStatement generates n and its else branches, continuing at end.
+func (g *generator) generateIfStatement(n *ast.IfStatement, end string) {
+	if n.Condition == nil {
+		g.generateStatements(n.Statements)
+		g.branch(end)
+		return
+	}
+
+	then := g.newLabel("if.then")
+	next := end
+	if n.ElseBranch != nil {
+		next = g.newLabel("if.else")
+	}
+	cond := g.generateCondition(n.Condition)
+	g.terminate("br i1 %s, label %%%s, label %%%s", cond, then, next)
+	g.startBlock(then)
+	g.generateStatements(n.Statements)
+	g.branch(end)
+	if n.ElseBranch != nil {
+		g.startBlock(next)
+		g.generateIfStatement(n.ElseBranch, end)
+	}
+}
+
+// generateCondition converts the value of n to i1 the way IsTrue does.
+func (g *generator) generateCondition(n ast.Expression) string {
+	v := g.generateExpression(n)
+	switch g.kindOf(n) {
+	case float:
+		return g.temp("fcmp une double %s, 0.0", v)
+	case integer:
+		return g.temp("icmp ne i64 %s, 0", v)
+	}
+	return v
+}
+
+func (g *generator) kindOf(n ast.Expression) kind {
+	return g.types[n].get()
+}
+
+// generateExpression returns the value of n, which is empty for calls of
+// functions without return value.
+func (g *generator) generateExpression(n ast.Expression) string {
+	switch n := n.(type) {
+	case *ast.Integer:
+		return fmt.Sprint(n.Value)
+	case *ast.Float:
+		return fmt.Sprintf("0x%016X", math.Float64bits(n.Value))
+	case *ast.Boolean:
+		return fmt.Sprint(n.Value)
+	case *ast.LookupExpression:
+		e := g.entities[n]
+		t := e.typ.get().llvm()
+		return g.temp("load %s, %s* %s", t, t, e.ptr)
+	case *ast.IfExpression:
+		return g.generateIfExpression(n)
+	case *ast.BinaryOperationExpression:
+		return g.generateBinaryOperation(n)
+	case *ast.UnaryOperationExpression:
+		if n.Operator == ast.UnaryOperatorLnot {
+			return g.temp("xor i1 %s, true", g.generateCondition(n.A))
+		}
+		v := g.generateExpression(n.A)
+		if n.Operator == ast.UnaryOperatorPos {
+			return v
+		}
+		if g.kindOf(n.A) == float {
+			return g.temp("fneg double %s", v)
+		}
+		return g.temp("sub i64 0, %s", v)
+	case *ast.CallExpression:
+		return g.generateCall(n)
+	}
+	return ""
+}
+
+func (g *generator) generateIfExpression(n *ast.IfExpression) string {
+	if n.Condition == nil {
+		return g.generateExpression(n.Value)
+	}
+
+	then, next, end := g.newLabel("if.then"), g.newLabel("if.else"), g.newLabel("if.end")
+	cond := g.generateCondition(n.Condition)
+	g.terminate("br i1 %s, label %%%s, label %%%s", cond, then, next)
+	g.startBlock(then)
+	a := g.generateExpression(n.Value)
+	aBlock := g.block
+	g.branch(end)
+	g.startBlock(next)
+	b := g.generateIfExpression(n.ElseBranch)
+	bBlock := g.block
+	g.startBlock(end)
+	return g.temp("phi %s [ %s, %%%s ], [ %s, %%%s ]", g.kindOf(n).llvm(), a, aBlock, b, bBlock)
+}
+
+var integerOperations = map[ast.BinaryOperator]string{
+	ast.BinaryOperatorEq:  "icmp eq",
+	ast.BinaryOperatorNe:  "icmp ne",
+	ast.BinaryOperatorLt:  "icmp slt",
+	ast.BinaryOperatorLe:  "icmp sle",
+	ast.BinaryOperatorGt:  "icmp sgt",
+	ast.BinaryOperatorGe:  "icmp sge",
+	ast.BinaryOperatorAdd: "add",
+	ast.BinaryOperatorSub: "sub",
+	ast.BinaryOperatorMul: "mul",
+	ast.BinaryOperatorDiv: "sdiv",
+}
+
+var floatOperations = map[ast.BinaryOperator]string{
+	ast.BinaryOperatorEq:  "fcmp oeq",
+	ast.BinaryOperatorNe:  "fcmp une",
+	ast.BinaryOperatorLt:  "fcmp olt",
+	ast.BinaryOperatorLe:  "fcmp ole",
+	ast.BinaryOperatorGt:  "fcmp ogt",
+	ast.BinaryOperatorGe:  "fcmp oge",
+	ast.BinaryOperatorAdd: "fadd",
+	ast.BinaryOperatorSub: "fsub",
+	ast.BinaryOperatorMul: "fmul",
+	ast.BinaryOperatorDiv: "fdiv",
+}
+
+func (g *generator) generateBinaryOperation(n *ast.BinaryOperationExpression) string {
+	a := g.generateExpression(n.A)
+	b := g.generateExpression(n.B)
+	switch n.Operator {
+	case ast.BinaryOperatorLand:
+		return g.temp("and i1 %s, %s", a, b)
+	case ast.BinaryOperatorLor:
+		return g.temp("or i1 %s, %s", a, b)
+	}
+
+	ka, kb := g.kindOf(n.A), g.kindOf(n.B)
+	if ka != kb {
+		// Mixed Integer and Float operands are converted to Float
+		if ka == integer {
+			a = g.temp("sitofp i64 %s to double", a)
+		} else {
+			b = g.temp("sitofp i64 %s to double", b)
+		}
+		ka = float
+	}
+
+	switch ka {
+	case float:
+		return g.temp("%s double %s, %s", floatOperations[n.Operator], a, b)
+	case boolean:
+		return g.temp("%s i1 %s, %s", integerOperations[n.Operator], a, b)
+	}
+	if n.Operator == ast.BinaryOperatorDiv {
+		zero, ok := g.newLabel("div.zero"), g.newLabel("div.ok")
+		isZero := g.temp("icmp eq i64 %s, 0", b)
+		g.terminate("br i1 %s, label %%%s, label %%%s", isZero, zero, ok)
+		g.startBlock(zero)
+		g.fail(n, "Division by zero")
+		g.startBlock(ok)
+	}
+	return g.temp("%s i64 %s, %s", integerOperations[n.Operator], a, b)
+}
+
+func (g *generator) generateCall(n *ast.CallExpression) string {
+	e := g.entities[n]
+	if e.kind == predefinedEntity {
+		for i, p := range n.Parameters {
+			if i != 0 {
+				g.emit("call i32 @putchar(i32 32)")
+			}
+			if s, ok := p.(*ast.String); ok {
+				g.emit("call void @nkrt.print.string(i8* %s)", g.stringConstant(s.Value))
+				continue
+			}
+			v := g.generateExpression(p)
+			switch g.kindOf(p) {
+			case float:
+				g.emit("call void @nkrt.print.float(double %s)", v)
+			case boolean:
+				g.emit("call void @nkrt.print.bool(i1 %s)", v)
+			default:
+				g.emit("call void @nkrt.print.int(i64 %s)", v)
+			}
+		}
+		if e.name == "println" {
+			g.emit("call i32 @putchar(i32 10)")
+		}
+		return ""
+	}
+
+	f := e.function
+	var args []string
+	for i, p := range n.Parameters {
+		args = append(args, f.parameters[i].typ.get().llvm()+" "+g.generateExpression(p))
+	}
+	result := f.result.get()
+	call := fmt.Sprintf("call %s %s(%s)", result.llvm(), quote("@", "nk."+f.Name), strings.Join(args, ", "))
+	if result == void {
+		g.emit("%s", call)
+		return ""
+	}
+	return g.temp("%s", call)
+}
@@ -0,0 +1,105 @@
+package codegen
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/builtins"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+	"github.com/niklaskorz/nklang/semantics"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// parse parses and analyzes the program at path with the builtins declared.
+func parse(t *testing.T, path string) *ast.Program {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s := lexer.NewScanner(f)
+	s.File = filepath.Base(path)
+	p, err := parser.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := semantics.NewScope()
+	for _, name := range builtins.Names() {
+		ds.Declare(name)
+	}
+	if err := semantics.AnalyzeLookupsWithScope(p, ds); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// testGolden compiles each testdata/*.nk file with generate and compares the
+// result with the golden file of the same name ending in ext. With -update,
+// the golden files are rewritten instead.
+func testGolden(t *testing.T, ext string, generate func(p *ast.Program, predefined []string) (string, error)) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.nk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		golden := strings.TrimSuffix(path, ".nk") + ext
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			output, err := generate(parse(t, path), builtins.Names())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(output), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != string(expected) {
+				t.Errorf("Output differs from %s, run go test -update to accept it\n%s", golden, output)
+			}
+		})
+	}
+}
+
+func TestGenerateGolden(t *testing.T) {
+	testGolden(t, ".ll", Generate)
+}
+
+func TestGenerateWATGolden(t *testing.T) {
+	testGolden(t, ".wat", GenerateWAT)
+}
+
+func TestGenerateRejectsDynamicFeatures(t *testing.T) {
+	programs := map[string]string{
+		`x := 1; x = 1.5;`:                  "test.nk:1:9: Can't assign Float to x of type Integer",
+		`a := [1, 2];`:                      "test.nk:1:6: Arrays are not supported",
+		`f := func(g) { return g(1); }; f;`: "test.nk:1:23: Calls of variables are not supported",
+	}
+	for src, expected := range programs {
+		s := lexer.NewScanner(strings.NewReader(src))
+		s.File = "test.nk"
+		p, err := parser.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := semantics.AnalyzeLookups(p); err != nil {
+			t.Fatal(err)
+		}
+		_, err = Generate(p, nil)
+		if _, ok := err.(*Error); !ok || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to fail with an error containing %q, got %v", src, expected, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package codegen
+
+// runtime is included in every module and implements printing and runtime
+// errors on top of the C standard library.
+const runtime = `declare i32 @printf(i8*, ...)
+declare i32 @snprintf(i8*, i64, i8*, ...)
+declare double @strtod(i8*, i8**)
+declare i32 @putchar(i32)
+declare i32 @puts(i8*)
+declare void @exit(i32) noreturn
+
+@nkrt.format.int = private unnamed_addr constant [5 x i8] c"%lld\00"
+@nkrt.format.string = private unnamed_addr constant [3 x i8] c"%s\00"
+@nkrt.format.float = private unnamed_addr constant [5 x i8] c"%.*f\00"
+@nkrt.true = private unnamed_addr constant [5 x i8] c"true\00"
+@nkrt.false = private unnamed_addr constant [6 x i8] c"false\00"
+@nkrt.nan = private unnamed_addr constant [4 x i8] c"NaN\00"
+@nkrt.inf = private unnamed_addr constant [5 x i8] c"+Inf\00"
+@nkrt.neginf = private unnamed_addr constant [5 x i8] c"-Inf\00"
+
+define internal void @nkrt.print.string(i8* %s) {
+  %format = getelementptr inbounds [3 x i8], [3 x i8]* @nkrt.format.string, i64 0, i64 0
+  call i32 (i8*, ...) @printf(i8* %format, i8* %s)
+  ret void
+}
+
+define internal void @nkrt.print.int(i64 %v) {
+  %format = getelementptr inbounds [5 x i8], [5 x i8]* @nkrt.format.int, i64 0, i64 0
+  call i32 (i8*, ...) @printf(i8* %format, i64 %v)
+  ret void
+}
+
+define internal void @nkrt.print.bool(i1 %v) {
+  %true = getelementptr inbounds [5 x i8], [5 x i8]* @nkrt.true, i64 0, i64 0
+  %false = getelementptr inbounds [6 x i8], [6 x i8]* @nkrt.false, i64 0, i64 0
+  %s = select i1 %v, i8* %true, i8* %false
+  call void @nkrt.print.string(i8* %s)
+  ret void
+}
+
+; Floats are printed like the interpreter does, with the fewest decimal
+; places that still read back as the same value.
+define internal void @nkrt.print.float(double %v) {
+entry:
+  %buffer = alloca [1536 x i8]
+  %s = getelementptr inbounds [1536 x i8], [1536 x i8]* %buffer, i64 0, i64 0
+  %isnan = fcmp uno double %v, %v
+  br i1 %isnan, label %nan, label %number
+nan:
+  call void @nkrt.print.string(i8* getelementptr inbounds ([4 x i8], [4 x i8]* @nkrt.nan, i64 0, i64 0))
+  ret void
+number:
+  %isinf = fcmp oeq double %v, 0x7FF0000000000000
+  br i1 %isinf, label %inf, label %finite
+inf:
+  call void @nkrt.print.string(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @nkrt.inf, i64 0, i64 0))
+  ret void
+finite:
+  %isneginf = fcmp oeq double %v, 0xFFF0000000000000
+  br i1 %isneginf, label %neginf, label %format
+neginf:
+  call void @nkrt.print.string(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @nkrt.neginf, i64 0, i64 0))
+  ret void
+format:
+  %precision = phi i32 [ 0, %finite ], [ %next, %retry ]
+  %format.float = getelementptr inbounds [5 x i8], [5 x i8]* @nkrt.format.float, i64 0, i64 0
+  call i32 (i8*, i64, i8*, ...) @snprintf(i8* %s, i64 1536, i8* %format.float, i32 %precision, double %v)
+  %parsed = call double @strtod(i8* %s, i8** null)
+  %exact = fcmp oeq double %parsed, %v
+  %limit = icmp sge i32 %precision, 1100
+  %done = or i1 %exact, %limit
+  br i1 %done, label %print, label %retry
+retry:
+  %next = add i32 %precision, 1
+  br label %format
+print:
+  call void @nkrt.print.string(i8* %s)
+  ret void
+}
+
+define internal void @nkrt.fail(i8* %message) noreturn {
+  call i32 @puts(i8* %message)
+  call void @exit(i32 1)
+  unreachable
+}
+`
@@ -0,0 +1,77 @@
+(module
+  (import "nk" "print_i64" (func $print_i64 (param i64)))
+  (import "nk" "print_f64" (func $print_f64 (param f64)))
+  (import "nk" "print_bool" (func $print_bool (param i32)))
+  (import "nk" "print_string" (func $print_string (param i32 i32)))
+  (memory (export "memory") 1)
+  (data (i32.const 0) "fib(20) = \0a10! =fib.nk:2:8: Function fib ended without returning a value\0afib.nk:9:12: Function faculty ended without returning a value\0a")
+  (func $nk.fib (param $n.0 i64) (result i64)
+    local.get $n.0
+    i64.const 2
+    i64.lt_s
+    if
+      local.get $n.0
+      return
+    end
+    local.get $n.0
+    i64.const 1
+    i64.sub
+    call $nk.fib
+    local.get $n.0
+    i64.const 2
+    i64.sub
+    call $nk.fib
+    i64.add
+    return
+    i32.const 16
+    i32.const 57
+    call $print_string
+    unreachable
+  )
+  (func $nk.faculty (param $n.0 i64) (result i64)
+    local.get $n.0
+    i64.const 0
+    i64.eq
+    if
+      i64.const 1
+      return
+    end
+    local.get $n.0
+    local.get $n.0
+    i64.const 1
+    i64.sub
+    call $nk.faculty
+    i64.mul
+    return
+    i32.const 73
+    i32.const 62
+    call $print_string
+    unreachable
+  )
+  (func $main (export "main")
+    i32.const 0
+    i32.const 9
+    call $print_string
+    i32.const 9
+    i32.const 1
+    call $print_string
+    i64.const 20
+    call $nk.fib
+    call $print_i64
+    i32.const 10
+    i32.const 1
+    call $print_string
+    i32.const 11
+    i32.const 5
+    call $print_string
+    i32.const 9
+    i32.const 1
+    call $print_string
+    i64.const 10
+    call $nk.faculty
+    call $print_i64
+    i32.const 10
+    i32.const 1
+    call $print_string
+  )
+)
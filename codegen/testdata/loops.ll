@@ -0,0 +1,160 @@
+declare i32 @printf(i8*, ...)
+declare i32 @snprintf(i8*, i64, i8*, ...)
+declare double @strtod(i8*, i8**)
+declare i32 @putchar(i32)
+declare i32 @puts(i8*)
+declare void @exit(i32) noreturn
+
+@nkrt.format.int = private unnamed_addr constant [5 x i8] c"%lld\00"
+@nkrt.format.string = private unnamed_addr constant [3 x i8] c"%s\00"
+@nkrt.format.float = private unnamed_addr constant [5 x i8] c"%.*f\00"
+@nkrt.true = private unnamed_addr constant [5 x i8] c"true\00"
+@nkrt.false = private unnamed_addr constant [6 x i8] c"false\00"
+@nkrt.nan = private unnamed_addr constant [4 x i8] c"NaN\00"
+@nkrt.inf = private unnamed_addr constant [5 x i8] c"+Inf\00"
+@nkrt.neginf = private unnamed_addr constant [5 x i8] c"-Inf\00"
+
+define internal void @nkrt.print.string(i8* %s) {
+  %format = getelementptr inbounds [3 x i8], [3 x i8]* @nkrt.format.string, i64 0, i64 0
+  call i32 (i8*, ...) @printf(i8* %format, i8* %s)
+  ret void
+}
+
+define internal void @nkrt.print.int(i64 %v) {
+  %format = getelementptr inbounds [5 x i8], [5 x i8]* @nkrt.format.int, i64 0, i64 0
+  call i32 (i8*, ...) @printf(i8* %format, i64 %v)
+  ret void
+}
+
+define internal void @nkrt.print.bool(i1 %v) {
+  %true = getelementptr inbounds [5 x i8], [5 x i8]* @nkrt.true, i64 0, i64 0
+  %false = getelementptr inbounds [6 x i8], [6 x i8]* @nkrt.false, i64 0, i64 0
+  %s = select i1 %v, i8* %true, i8* %false
+  call void @nkrt.print.string(i8* %s)
+  ret void
+}
+
+; Floats are printed like the interpreter does, with the fewest decimal
+; places that still read back as the same value.
+define internal void @nkrt.print.float(double %v) {
+entry:
+  %buffer = alloca [1536 x i8]
+  %s = getelementptr inbounds [1536 x i8], [1536 x i8]* %buffer, i64 0, i64 0
+  %isnan = fcmp uno double %v, %v
+  br i1 %isnan, label %nan, label %number
+nan:
+  call void @nkrt.print.string(i8* getelementptr inbounds ([4 x i8], [4 x i8]* @nkrt.nan, i64 0, i64 0))
+  ret void
+number:
+  %isinf = fcmp oeq double %v, 0x7FF0000000000000
+  br i1 %isinf, label %inf, label %finite
+inf:
+  call void @nkrt.print.string(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @nkrt.inf, i64 0, i64 0))
+  ret void
+finite:
+  %isneginf = fcmp oeq double %v, 0xFFF0000000000000
+  br i1 %isneginf, label %neginf, label %format
+neginf:
+  call void @nkrt.print.string(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @nkrt.neginf, i64 0, i64 0))
+  ret void
+format:
+  %precision = phi i32 [ 0, %finite ], [ %next, %retry ]
+  %format.float = getelementptr inbounds [5 x i8], [5 x i8]* @nkrt.format.float, i64 0, i64 0
+  call i32 (i8*, i64, i8*, ...) @snprintf(i8* %s, i64 1536, i8* %format.float, i32 %precision, double %v)
+  %parsed = call double @strtod(i8* %s, i8** null)
+  %exact = fcmp oeq double %parsed, %v
+  %limit = icmp sge i32 %precision, 1100
+  %done = or i1 %exact, %limit
+  br i1 %done, label %print, label %retry
+retry:
+  %next = add i32 %precision, 1
+  br label %format
+print:
+  call void @nkrt.print.string(i8* %s)
+  ret void
+}
+
+define internal void @nkrt.fail(i8* %message) noreturn {
+  call i32 @puts(i8* %message)
+  call void @exit(i32 1)
+  unreachable
+}
+
+@"nk.i" = internal global i64 0
+@"nk.sum" = internal global double 0.0
+@.str.1 = private unnamed_addr constant [5 x i8] c"sum:\00"
+@.str.2 = private unnamed_addr constant [11 x i8] c"no newline\00"
+@.str.3 = private unnamed_addr constant [33 x i8] c"loops.nk:17:16: Division by zero\00"
+
+define internal i1 @"nk.even"(i64 %"arg.n") {
+entry:
+  %"n.1" = alloca i64
+  store i64 %"arg.n", i64* %"n.1"
+  %t2 = load i64, i64* %"n.1"
+  %t3 = load i64, i64* %"n.1"
+  %t4 = icmp eq i64 2, 0
+  br i1 %t4, label %div.zero.1, label %div.ok.2
+div.zero.1:
+  call void @nkrt.fail(i8* getelementptr inbounds ([33 x i8], [33 x i8]* @.str.3, i64 0, i64 0))
+  unreachable
+div.ok.2:
+  %t5 = sdiv i64 %t3, 2
+  %t6 = mul i64 %t5, 2
+  %t7 = sub i64 %t2, %t6
+  %t8 = icmp eq i64 %t7, 0
+  ret i1 %t8
+}
+
+define i32 @main() {
+entry:
+  store i64 0, i64* @"nk.i"
+  store double 0x0000000000000000, double* @"nk.sum"
+  br label %while.cond.1
+while.cond.1:
+  br i1 true, label %while.body.3, label %while.end.2
+while.body.3:
+  %t1 = load i64, i64* @"nk.i"
+  %t2 = add i64 %t1, 1
+  store i64 %t2, i64* @"nk.i"
+  %t3 = load i64, i64* @"nk.i"
+  %t4 = icmp sgt i64 %t3, 10
+  br i1 %t4, label %if.then.5, label %if.end.4
+if.then.5:
+  br label %while.end.2
+if.end.4:
+  %t5 = load i64, i64* @"nk.i"
+  %t6 = icmp eq i64 %t5, 5
+  br i1 %t6, label %if.then.7, label %if.end.6
+if.then.7:
+  br label %while.cond.1
+if.end.6:
+  %t7 = load double, double* @"nk.sum"
+  %t8 = load i64, i64* @"nk.i"
+  %t9 = sitofp i64 %t8 to double
+  %t10 = fmul double 0x3FF8000000000000, %t9
+  %t11 = fadd double %t7, %t10
+  store double %t11, double* @"nk.sum"
+  br label %while.cond.1
+while.end.2:
+  call void @nkrt.print.string(i8* getelementptr inbounds ([5 x i8], [5 x i8]* @.str.1, i64 0, i64 0))
+  call i32 @putchar(i32 32)
+  %t12 = load double, double* @"nk.sum"
+  call void @nkrt.print.float(double %t12)
+  call i32 @putchar(i32 10)
+  %t13 = call i1 @"nk.even"(i64 4)
+  call void @nkrt.print.bool(i1 %t13)
+  call i32 @putchar(i32 32)
+  %t14 = call i1 @"nk.even"(i64 7)
+  call void @nkrt.print.bool(i1 %t14)
+  call i32 @putchar(i32 32)
+  %t15 = call i1 @"nk.even"(i64 7)
+  %t16 = xor i1 %t15, true
+  %t17 = load i64, i64* @"nk.i"
+  %t18 = icmp sgt i64 %t17, 3
+  %t19 = and i1 %t16, %t18
+  call void @nkrt.print.bool(i1 %t19)
+  call i32 @putchar(i32 10)
+  call void @nkrt.print.string(i8* getelementptr inbounds ([11 x i8], [11 x i8]* @.str.2, i64 0, i64 0))
+  call i32 @putchar(i32 10)
+  ret i32 0
+}
@@ -0,0 +1,113 @@
+(module
+  (import "nk" "print_i64" (func $print_i64 (param i64)))
+  (import "nk" "print_f64" (func $print_f64 (param f64)))
+  (import "nk" "print_bool" (func $print_bool (param i32)))
+  (import "nk" "print_string" (func $print_string (param i32 i32)))
+  (memory (export "memory") 1)
+  (global $nk.i (mut i64) (i64.const 0))
+  (global $nk.sum (mut f64) (f64.const 0))
+  (data (i32.const 0) "sum: \0ano newlineloops.nk:17:16: Division by zero\0aloops.nk:16:9: Function even ended without returning a value\0a")
+  (func $nk.even (param $n.0 i64) (result i32)
+    (local $divisor.1 i64)
+    local.get $n.0
+    local.get $n.0
+    i64.const 2
+    local.tee $divisor.1
+    i64.eqz
+    if
+      i32.const 16
+      i32.const 33
+      call $print_string
+      unreachable
+    end
+    local.get $divisor.1
+    i64.div_s
+    i64.const 2
+    i64.mul
+    i64.sub
+    i64.const 0
+    i64.eq
+    return
+    i32.const 49
+    i32.const 61
+    call $print_string
+    unreachable
+  )
+  (func $main (export "main")
+    i64.const 0
+    global.set $nk.i
+    f64.const 0x0p+00
+    global.set $nk.sum
+    block $while.end.2
+      loop $while.cond.1
+        i32.const 1
+        i32.eqz
+        br_if $while.end.2
+        global.get $nk.i
+        i64.const 1
+        i64.add
+        global.set $nk.i
+        global.get $nk.i
+        i64.const 10
+        i64.gt_s
+        if
+          br $while.end.2
+        end
+        global.get $nk.i
+        i64.const 5
+        i64.eq
+        if
+          br $while.cond.1
+        end
+        global.get $nk.sum
+        f64.const 0x1.8p+00
+        global.get $nk.i
+        f64.convert_i64_s
+        f64.mul
+        f64.add
+        global.set $nk.sum
+        br $while.cond.1
+      end
+    end
+    i32.const 0
+    i32.const 4
+    call $print_string
+    i32.const 4
+    i32.const 1
+    call $print_string
+    global.get $nk.sum
+    call $print_f64
+    i32.const 5
+    i32.const 1
+    call $print_string
+    i64.const 4
+    call $nk.even
+    call $print_bool
+    i32.const 4
+    i32.const 1
+    call $print_string
+    i64.const 7
+    call $nk.even
+    call $print_bool
+    i32.const 4
+    i32.const 1
+    call $print_string
+    i64.const 7
+    call $nk.even
+    i32.eqz
+    global.get $nk.i
+    i64.const 3
+    i64.gt_s
+    i32.and
+    call $print_bool
+    i32.const 5
+    i32.const 1
+    call $print_string
+    i32.const 6
+    i32.const 10
+    call $print_string
+    i32.const 5
+    i32.const 1
+    call $print_string
+  )
+)
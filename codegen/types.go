@@ -0,0 +1,78 @@
+package codegen
+
+// kind is the static type of a value in the natively compiled subset.
+type kind int
+
+const (
+	unknown kind = iota
+	integer
+	float
+	boolean
+	// Result of functions without return value
+	void
+)
+
+func (k kind) String() string {
+	switch k {
+	case integer:
+		return "Integer"
+	case float:
+		return "Float"
+	case boolean:
+		return "Boolean"
+	case void:
+		return "Nil"
+	}
+	return "unknown"
+}
+
+// llvm returns the LLVM IR type representing k.
+func (k kind) llvm() string {
+	switch k {
+	case float:
+		return "double"
+	case boolean:
+		return "i1"
+	case void:
+		return "void"
+	}
+	return "i64"
+}
+
+// typeVar is a type that may not be known yet. Type variables that must
+// have the same type are merged, so the type found for one of them applies
+// to all of them.
+type typeVar struct {
+	parent *typeVar
+	kind   kind
+}
+
+func newType(k kind) *typeVar {
+	return &typeVar{kind: k}
+}
+
+func (t *typeVar) find() *typeVar {
+	for t.parent != nil {
+		t = t.parent
+	}
+	return t
+}
+
+func (t *typeVar) get() kind {
+	return t.find().kind
+}
+
+// unify merges a and b, reporting false if their types differ.
+func unify(a, b *typeVar) bool {
+	a, b = a.find(), b.find()
+	switch {
+	case a == b:
+	case a.kind == unknown:
+		a.parent = b
+	case b.kind == unknown, a.kind == b.kind:
+		b.parent = a
+	default:
+		return false
+	}
+	return true
+}
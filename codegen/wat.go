@@ -0,0 +1,453 @@
+package codegen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// GenerateWAT compiles p to a WebAssembly module in text format. It supports
+// the same subset of nklang as Generate. The module exports its memory and a
+// function main running the top level statements. Printing is left to the
+// host, which provides these functions in the import module "nk":
+//
+//	print_i64(i64), print_f64(f64), print_bool(i32)
+//		print a value like println does
+//	print_string(offset i32, length i32)
+//		prints UTF-8 text stored in the exported memory
+//
+// Runtime errors print a message and trap.
+func GenerateWAT(p *ast.Program, predefined []string) (string, error) {
+	c := newChecker(predefined)
+	if err := c.checkProgram(p); err != nil {
+		return "", err
+	}
+
+	g := &watGenerator{checker: c, names: make(map[*entity]string), offsets: make(map[string]int)}
+	main := g.generateMain(p)
+	var functions []string
+	for _, f := range c.functions {
+		functions = append(functions, g.generateFunction(f))
+	}
+
+	var b strings.Builder
+	b.WriteString("(module\n")
+	b.WriteString("  (import \"nk\" \"print_i64\" (func $print_i64 (param i64)))\n")
+	b.WriteString("  (import \"nk\" \"print_f64\" (func $print_f64 (param f64)))\n")
+	b.WriteString("  (import \"nk\" \"print_bool\" (func $print_bool (param i32)))\n")
+	b.WriteString("  (import \"nk\" \"print_string\" (func $print_string (param i32 i32)))\n")
+	pages := (len(g.data) + 0xffff) / 0x10000
+	if pages == 0 {
+		pages = 1
+	}
+	fmt.Fprintf(&b, "  (memory (export \"memory\") %d)\n", pages)
+	b.WriteString(g.globals.String())
+	if len(g.data) > 0 {
+		fmt.Fprintf(&b, "  (data (i32.const 0) \"%s\")\n", watString(g.data))
+	}
+	for _, f := range functions {
+		b.WriteString(f)
+	}
+	b.WriteString(main)
+	b.WriteString(")\n")
+	return b.String(), nil
+}
+
+type watGenerator struct {
+	*checker
+	names   map[*entity]string
+	globals strings.Builder
+	// Contents of the memory, holding the strings of the program
+	data    string
+	offsets map[string]int
+
+	// State of the function being generated
+	locals  strings.Builder
+	code    strings.Builder
+	depth   int
+	label   int
+	loops   []loop
+	current *function
+}
+
+// watKind returns the WebAssembly type representing k. Booleans are i32.
+func watKind(k kind) string {
+	switch k {
+	case float:
+		return "f64"
+	case boolean:
+		return "i32"
+	}
+	return "i64"
+}
+
+// watName returns name as WebAssembly identifier. Characters not allowed in
+// identifiers are escaped.
+func watName(name string) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// watString escapes s for a WebAssembly string literal.
+func watString(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= ' ' && c <= '~' && c != '"' && c != '\\' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "\\%02x", c)
+		}
+	}
+	return b.String()
+}
+
+func (g *watGenerator) reset(f *function) {
+	g.locals.Reset()
+	g.code.Reset()
+	g.depth = 2
+	g.label = 0
+	g.loops = nil
+	g.current = f
+}
+
+func (g *watGenerator) emit(format string, a ...interface{}) {
+	g.code.WriteString(strings.Repeat("  ", g.depth))
+	fmt.Fprintf(&g.code, format, a...)
+	g.code.WriteString("\n")
+}
+
+func (g *watGenerator) newLabel(name string) string {
+	g.label++
+	return fmt.Sprintf("$%s.%d", name, g.label)
+}
+
+func (g *watGenerator) generateMain(p *ast.Program) string {
+	g.reset(nil)
+	g.generateStatements(p.Statements)
+	return "  (func $main (export \"main\")\n" + g.locals.String() + g.code.String() + "  )\n"
+}
+
+func (g *watGenerator) generateFunction(f *function) string {
+	g.reset(f)
+	var b strings.Builder
+	fmt.Fprintf(&b, "  (func %s", watName("nk."+f.Name))
+	for i, p := range f.parameters {
+		name := watName(fmt.Sprintf("%s.%d", p.name, i))
+		g.names[p] = name
+		fmt.Fprintf(&b, " (param %s %s)", name, watKind(p.typ.get()))
+	}
+	result := f.result.get()
+	if result != void {
+		fmt.Fprintf(&b, " (result %s)", watKind(result))
+	}
+	b.WriteString("\n")
+
+	g.generateStatements(f.Statements)
+	if result != void {
+		g.fail(f, fmt.Sprintf("Function %s ended without returning a value", f.Name))
+	}
+	return b.String() + g.locals.String() + g.code.String() + "  )\n"
+}
+
+// stringData stores s in memory and returns its offset.
+func (g *watGenerator) stringData(s string) int {
+	if offset, ok := g.offsets[s]; ok {
+		return offset
+	}
+	offset := len(g.data)
+	g.data += s
+	g.offsets[s] = offset
+	return offset
+}
+
+func (g *watGenerator) printString(s string) {
+	g.emit("i32.const %d", g.stringData(s))
+	g.emit("i32.const %d", len(s))
+	g.emit("call $print_string")
+}
+
+// fail prints a runtime error at n and traps.
+func (g *watGenerator) fail(n ast.Node, message string) {
+	g.printString(fmt.Sprintf("%s: %s\n", n.Location().Position(), message))
+	g.emit("unreachable")
+}
+
+func (g *watGenerator) declare(e *entity) {
+	t := watKind(e.typ.get())
+	if e.global {
+		name := watName("nk." + e.name)
+		g.names[e] = name
+		fmt.Fprintf(&g.globals, "  (global %s (mut %s) (%s.const 0))\n", name, t, t)
+		return
+	}
+	g.label++
+	name := watName(fmt.Sprintf("%s.%d", e.name, g.label))
+	g.names[e] = name
+	fmt.Fprintf(&g.locals, "    (local %s %s)\n", name, t)
+}
+
+func (g *watGenerator) store(e *entity) {
+	if e.global {
+		g.emit("global.set %s", g.names[e])
+	} else {
+		g.emit("local.set %s", g.names[e])
+	}
+}
+
+func (g *watGenerator) generateStatements(statements []ast.Statement) {
+	for _, n := range statements {
+		g.generateStatement(n)
+	}
+}
+
+func (g *watGenerator) generateStatement(n ast.Statement) {
+	switch n := n.(type) {
+	case *ast.IfStatement:
+		g.generateIfStatement(n)
+	case *ast.WhileStatement:
+		l := loop{continueLabel: g.newLabel("while.cond"), breakLabel: g.newLabel("while.end")}
+		g.emit("block %s", l.breakLabel)
+		g.depth++
+		g.emit("loop %s", l.continueLabel)
+		g.depth++
+		g.generateCondition(n.Condition)
+		g.emit("i32.eqz")
+		g.emit("br_if %s", l.breakLabel)
+		g.loops = append(g.loops, l)
+		g.generateStatements(n.Statements)
+		g.loops = g.loops[:len(g.loops)-1]
+		g.emit("br %s", l.continueLabel)
+		g.depth--
+		g.emit("end")
+		g.depth--
+		g.emit("end")
+	case *ast.ContinueStatement:
+		g.emit("br %s", g.loops[len(g.loops)-1].continueLabel)
+	case *ast.BreakStatement:
+		g.emit("br %s", g.loops[len(g.loops)-1].breakLabel)
+	case *ast.DeclarationStatement:
+		e := g.entities[n]
+		if e.kind == functionEntity {
+			return
+		}
+		g.declare(e)
+		g.generateExpression(n.Value)
+		g.store(e)
+	case *ast.AssignmentStatement:
+		g.generateExpression(n.Value)
+		g.store(g.entities[n])
+	case *ast.ReturnStatement:
+		g.generateExpression(n.Expression)
+		g.emit("return")
+	case *ast.ExpressionStatement:
+		g.generateExpression(n.Expression)
+		if g.kindOf(n.Expression) != void {
+			g.emit("drop")
+		}
+	}
+}
+
+func (g *watGenerator) generateIfStatement(n *ast.IfStatement) {
+	if n.Condition == nil {
+		g.generateStatements(n.Statements)
+		return
+	}
+	g.generateCondition(n.Condition)
+	g.emit("if")
+	g.depth++
+	g.generateStatements(n.Statements)
+	g.depth--
+	if n.ElseBranch != nil {
+		g.emit("else")
+		g.depth++
+		g.generateIfStatement(n.ElseBranch)
+		g.depth--
+	}
+	g.emit("end")
+}
+
+// generateCondition converts the value of n to i32 the way IsTrue does.
+func (g *watGenerator) generateCondition(n ast.Expression) {
+	g.generateExpression(n)
+	switch g.kindOf(n) {
+	case float:
+		g.emit("f64.const 0")
+		g.emit("f64.ne")
+	case integer:
+		g.emit("i64.const 0")
+		g.emit("i64.ne")
+	}
+}
+
+func (g *watGenerator) kindOf(n ast.Expression) kind {
+	return g.types[n].get()
+}
+
+func (g *watGenerator) generateExpression(n ast.Expression) {
+	switch n := n.(type) {
+	case *ast.Integer:
+		g.emit("i64.const %d", n.Value)
+	case *ast.Float:
+		g.emit("f64.const %s", strconv.FormatFloat(n.Value, 'x', -1, 64))
+	case *ast.Boolean:
+		if n.Value {
+			g.emit("i32.const 1")
+		} else {
+			g.emit("i32.const 0")
+		}
+	case *ast.LookupExpression:
+		e := g.entities[n]
+		if e.global {
+			g.emit("global.get %s", g.names[e])
+		} else {
+			g.emit("local.get %s", g.names[e])
+		}
+	case *ast.IfExpression:
+		g.generateIfExpression(n)
+	case *ast.BinaryOperationExpression:
+		g.generateBinaryOperation(n)
+	case *ast.UnaryOperationExpression:
+		switch {
+		case n.Operator == ast.UnaryOperatorLnot:
+			g.generateCondition(n.A)
+			g.emit("i32.eqz")
+		case n.Operator == ast.UnaryOperatorPos:
+			g.generateExpression(n.A)
+		case g.kindOf(n.A) == float:
+			g.generateExpression(n.A)
+			g.emit("f64.neg")
+		default:
+			g.emit("i64.const 0")
+			g.generateExpression(n.A)
+			g.emit("i64.sub")
+		}
+	case *ast.CallExpression:
+		g.generateCall(n)
+	}
+}
+
+func (g *watGenerator) generateIfExpression(n *ast.IfExpression) {
+	if n.Condition == nil {
+		g.generateExpression(n.Value)
+		return
+	}
+	g.generateCondition(n.Condition)
+	g.emit("if (result %s)", watKind(g.kindOf(n)))
+	g.depth++
+	g.generateExpression(n.Value)
+	g.depth--
+	g.emit("else")
+	g.depth++
+	g.generateIfExpression(n.ElseBranch)
+	g.depth--
+	g.emit("end")
+}
+
+var watIntegerOperations = map[ast.BinaryOperator]string{
+	ast.BinaryOperatorEq:  "i64.eq",
+	ast.BinaryOperatorNe:  "i64.ne",
+	ast.BinaryOperatorLt:  "i64.lt_s",
+	ast.BinaryOperatorLe:  "i64.le_s",
+	ast.BinaryOperatorGt:  "i64.gt_s",
+	ast.BinaryOperatorGe:  "i64.ge_s",
+	ast.BinaryOperatorAdd: "i64.add",
+	ast.BinaryOperatorSub: "i64.sub",
+	ast.BinaryOperatorMul: "i64.mul",
+	ast.BinaryOperatorDiv: "i64.div_s",
+}
+
+var watFloatOperations = map[ast.BinaryOperator]string{
+	ast.BinaryOperatorEq:  "f64.eq",
+	ast.BinaryOperatorNe:  "f64.ne",
+	ast.BinaryOperatorLt:  "f64.lt",
+	ast.BinaryOperatorLe:  "f64.le",
+	ast.BinaryOperatorGt:  "f64.gt",
+	ast.BinaryOperatorGe:  "f64.ge",
+	ast.BinaryOperatorAdd: "f64.add",
+	ast.BinaryOperatorSub: "f64.sub",
+	ast.BinaryOperatorMul: "f64.mul",
+	ast.BinaryOperatorDiv: "f64.div",
+}
+
+func (g *watGenerator) generateBinaryOperation(n *ast.BinaryOperationExpression) {
+	ka, kb := g.kindOf(n.A), g.kindOf(n.B)
+	mixed := ka != kb && n.Operator != ast.BinaryOperatorLand && n.Operator != ast.BinaryOperatorLor
+	g.generateExpression(n.A)
+	if mixed && ka == integer {
+		g.emit("f64.convert_i64_s")
+	}
+	g.generateExpression(n.B)
+	if mixed && kb == integer {
+		g.emit("f64.convert_i64_s")
+	}
+
+	switch {
+	case n.Operator == ast.BinaryOperatorLand:
+		g.emit("i32.and")
+	case n.Operator == ast.BinaryOperatorLor:
+		g.emit("i32.or")
+	case mixed || ka == float:
+		g.emit(watFloatOperations[n.Operator])
+	case ka == boolean:
+		g.emit(strings.Replace(watIntegerOperations[n.Operator], "i64", "i32", 1))
+	case n.Operator == ast.BinaryOperatorDiv:
+		// The divisor is kept in a scratch local while it is checked
+		scratch := g.newLabel("divisor")
+		fmt.Fprintf(&g.locals, "    (local %s i64)\n", scratch)
+		g.emit("local.tee %s", scratch)
+		g.emit("i64.eqz")
+		g.emit("if")
+		g.depth++
+		g.fail(n, "Division by zero")
+		g.depth--
+		g.emit("end")
+		g.emit("local.get %s", scratch)
+		g.emit("i64.div_s")
+	default:
+		g.emit(watIntegerOperations[n.Operator])
+	}
+}
+
+func (g *watGenerator) generateCall(n *ast.CallExpression) {
+	e := g.entities[n]
+	if e.kind == predefinedEntity {
+		for i, p := range n.Parameters {
+			if i != 0 {
+				g.printString(" ")
+			}
+			if s, ok := p.(*ast.String); ok {
+				g.printString(s.Value)
+				continue
+			}
+			g.generateExpression(p)
+			switch g.kindOf(p) {
+			case float:
+				g.emit("call $print_f64")
+			case boolean:
+				g.emit("call $print_bool")
+			default:
+				g.emit("call $print_i64")
+			}
+		}
+		if e.name == "println" {
+			g.printString("\n")
+		}
+		return
+	}
+
+	for _, p := range n.Parameters {
+		g.generateExpression(p)
+	}
+	g.emit("call %s", watName("nk."+e.function.Name))
+}
@@ -0,0 +1,649 @@
+package compiler
+
+import (
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/evaluator"
+)
+
+// Compile lowers p to bytecode. The variables are located by the scope
+// indices and slots resolved by the semantic analysis, so p must have been
+// analyzed before.
+func Compile(p *ast.Program) (*Program, error) {
+	program := &Program{}
+	c := &compiler{program: program, function: &Function{}, names: make(map[string]int)}
+	if err := c.compileStatements(p.Statements); err != nil {
+		return nil, err
+	}
+	c.emit(OpNil, 0, 0, ast.Span{})
+	c.emit(OpReturn, 0, 0, ast.Span{})
+	program.Main = c.function
+	return program, nil
+}
+
+// block is a loop or try statement enclosing the code being compiled.
+type block struct {
+	// Number of scopes entered in the function when entering the block
+	depth int
+
+	loop bool
+	// Start of the loop, target of continue
+	loopStart int
+	// Jumps to the end of the loop, patched once it is known
+	breaks []int
+
+	// Finally statements of a try statement, nil if it has none
+	finally []ast.Statement
+}
+
+// scope is a scope entered in the function being compiled. Its slots are
+// kept in the locals starting at base.
+type scope struct {
+	base int
+	// Number of slots declared so far. Scopes entered later start after
+	// them, and as the scope can only declare more slots once they have
+	// been left, they may share locals.
+	size int
+}
+
+// locationKind tells where the code of a function finds a variable.
+type locationKind int
+
+const (
+	inProgramScope locationKind = iota
+	inLocals
+	inCaptured
+)
+
+// location is the local or captured variable index or, in the scope the
+// program runs in, the variable in slot of the scope index levels up.
+type location struct {
+	kind  locationKind
+	index int
+	slot  int
+}
+
+type compiler struct {
+	program  *Program
+	function *Function
+	// Indices of the strings in program.Names, shared by all functions
+	names map[string]int
+	// Scopes entered since the start of the function, innermost last. The
+	// top level statements of main run in the scope of the program.
+	scopes []*scope
+	blocks []*block
+	// Locations of the variables captured by the function, by slot
+	captures []location
+	// Main is compiled at the top level, where return is not allowed
+	inFunction bool
+}
+
+func (c *compiler) emit(op Opcode, a, b int, span ast.Span) int {
+	c.function.Code = append(c.function.Code, Instruction{Op: op, A: a, B: b})
+	c.function.Spans = append(c.function.Spans, span)
+	return len(c.function.Code) - 1
+}
+
+// patch sets the target of the jump at pc to the next instruction.
+func (c *compiler) patch(pc int) {
+	c.function.Code[pc].A = len(c.function.Code)
+}
+
+func (c *compiler) constant(o evaluator.Object) int {
+	c.program.Constants = append(c.program.Constants, o)
+	return len(c.program.Constants) - 1
+}
+
+func (c *compiler) name(name string) int {
+	if i, ok := c.names[name]; ok {
+		return i
+	}
+	c.program.Names = append(c.program.Names, name)
+	c.names[name] = len(c.program.Names) - 1
+	return c.names[name]
+}
+
+// pushScope enters a scope, which only exists at compile time: its
+// variables are locals of the function.
+func (c *compiler) pushScope() {
+	s := &scope{}
+	if n := len(c.scopes); n > 0 {
+		s.base = c.scopes[n-1].base + c.scopes[n-1].size
+	}
+	c.scopes = append(c.scopes, s)
+}
+
+func (c *compiler) popScope() {
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+// resolve returns the location of the variable in slot of the scope index
+// levels up.
+func (c *compiler) resolve(index, slot int) location {
+	i := len(c.scopes) - 1 - index
+	switch {
+	case i >= 0:
+		return location{kind: inLocals, index: c.scopes[i].base + slot}
+	case c.inFunction:
+		// Functions only see their own scopes and the variables they
+		// capture
+		return c.captures[slot]
+	default:
+		return location{kind: inProgramScope, index: -1 - i, slot: slot}
+	}
+}
+
+func (c *compiler) load(index, slot int, span ast.Span) {
+	switch l := c.resolve(index, slot); l.kind {
+	case inLocals:
+		c.emit(OpLoadLocal, l.index, 0, span)
+	case inCaptured:
+		c.emit(OpLoadCaptured, l.index, 0, span)
+	default:
+		c.emit(OpLoad, l.index, l.slot, span)
+	}
+}
+
+func (c *compiler) store(index, slot int, span ast.Span) {
+	switch l := c.resolve(index, slot); l.kind {
+	case inLocals:
+		c.emit(OpStoreLocal, l.index, 0, span)
+	case inCaptured:
+		c.emit(OpStoreCaptured, l.index, 0, span)
+	default:
+		c.emit(OpStore, l.index, l.slot, span)
+	}
+}
+
+// declare declares name in slot of the innermost scope, popping its value.
+func (c *compiler) declare(slot int, name string, span ast.Span) {
+	if len(c.scopes) == 0 {
+		c.emit(OpDeclare, slot, c.name(name), span)
+		return
+	}
+	s := c.scopes[len(c.scopes)-1]
+	if slot >= s.size {
+		s.size = slot + 1
+	}
+	if s.base+slot >= c.function.Locals {
+		c.function.Locals = s.base + slot + 1
+	}
+	c.emit(OpDeclareLocal, s.base+slot, 0, span)
+}
+
+// compileBlock compiles statements in a scope of their own.
+func (c *compiler) compileBlock(statements []ast.Statement) error {
+	c.pushScope()
+	if err := c.compileStatements(statements); err != nil {
+		return err
+	}
+	c.popScope()
+	return nil
+}
+
+// unwind emits the code leaving all blocks above blocks[target], running
+// their finally statements.
+func (c *compiler) unwind(target int, span ast.Span) error {
+	blocks, scopes := c.blocks, c.scopes
+	defer func() {
+		c.blocks, c.scopes = blocks, scopes
+	}()
+
+	for i := len(blocks) - 1; i > target; i-- {
+		b := blocks[i]
+		if b.loop {
+			continue
+		}
+		c.emit(OpEndTry, 0, 0, span)
+		if b.finally != nil {
+			// Finally statements may leave blocks outside of the try
+			// statement themselves. The scopes they are compiled in are
+			// copied, as scopes entered by them mustn't replace the
+			// scopes being left.
+			c.blocks = append([]*block(nil), blocks[:i]...)
+			c.scopes = append([]*scope(nil), scopes[:b.depth]...)
+			if err := c.compileBlock(b.finally); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loop returns the index of the innermost loop block, or -1.
+func (c *compiler) loop() int {
+	for i := len(c.blocks) - 1; i >= 0; i-- {
+		if c.blocks[i].loop {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *compiler) compileStatements(statements []ast.Statement) error {
+	for _, s := range statements {
+		if err := c.compileStatement(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) compileStatement(n ast.Statement) error {
+	switch s := n.(type) {
+	case *ast.IfStatement:
+		return c.compileIfStatement(s)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(s)
+	case *ast.ForStatement:
+		return c.compileForStatement(s)
+	case *ast.TryStatement:
+		return c.compileTryStatement(s)
+	case *ast.ExpressionStatement:
+		if err := c.compileExpression(s.Expression); err != nil {
+			return err
+		}
+		c.emit(OpPop, 0, 0, s.Span)
+	case *ast.DeclarationStatement:
+		// The variable is declared before its value is evaluated, so
+		// recursive functions can capture themselves. Variables of the
+		// program's scope stay pending until the value is stored.
+		if len(c.scopes) == 0 {
+			c.emit(OpPreDeclare, s.Slot, c.name(s.Identifier), s.Span)
+		} else {
+			c.emit(OpNil, 0, 0, s.Span)
+			c.declare(s.Slot, s.Identifier, s.Span)
+		}
+		if err := c.compileExpression(s.Value); err != nil {
+			return err
+		}
+		c.store(0, s.Slot, s.Span)
+	case *ast.AssignmentStatement:
+		if err := c.compileExpression(s.Value); err != nil {
+			return err
+		}
+		c.store(s.ScopeIndex, s.Slot, s.Span)
+	case *ast.SubscriptAssignmentStatement:
+		for _, e := range []ast.Expression{s.Target, s.Index, s.Value} {
+			if err := c.compileExpression(e); err != nil {
+				return err
+			}
+		}
+		c.emit(OpSetSubscript, 0, 0, s.Span)
+	case *ast.MemberAssignmentStatement:
+		if err := c.compileExpression(s.Target); err != nil {
+			return err
+		}
+		if err := c.compileExpression(s.Value); err != nil {
+			return err
+		}
+		c.emit(OpSetMember, c.name(s.Name), 0, s.Span)
+	case *ast.StructDeclaration:
+		c.program.Structs = append(c.program.Structs, s)
+		c.emit(OpStruct, len(c.program.Structs)-1, 0, s.Span)
+		c.declare(s.Slot, s.Name, s.Span)
+	case *ast.ClassDeclaration:
+		return c.compileClassDeclaration(s)
+	case *ast.ReturnStatement:
+		if !c.inFunction {
+			return newError(s, "Unexpected return statement")
+		}
+		if err := c.compileExpression(s.Expression); err != nil {
+			return err
+		}
+		if err := c.unwind(-1, s.Span); err != nil {
+			return err
+		}
+		c.emit(OpReturn, 0, 0, s.Span)
+	case *ast.ThrowStatement:
+		if err := c.compileExpression(s.Expression); err != nil {
+			return err
+		}
+		c.emit(OpThrow, 0, 0, s.Span)
+	case *ast.ContinueStatement:
+		i := c.loop()
+		if i == -1 {
+			return newError(s, "Unexpected continue statement")
+		}
+		if err := c.unwind(i, s.Span); err != nil {
+			return err
+		}
+		c.emit(OpJump, c.blocks[i].loopStart, 0, s.Span)
+	case *ast.BreakStatement:
+		i := c.loop()
+		if i == -1 {
+			return newError(s, "Unexpected break statement")
+		}
+		if err := c.unwind(i, s.Span); err != nil {
+			return err
+		}
+		c.blocks[i].breaks = append(c.blocks[i].breaks, c.emit(OpJump, 0, 0, s.Span))
+	}
+	return nil
+}
+
+func (c *compiler) compileIfStatement(n *ast.IfStatement) error {
+	if n.Condition == nil {
+		return c.compileBlock(n.Statements)
+	}
+
+	if err := c.compileExpression(n.Condition); err != nil {
+		return err
+	}
+	jump := c.emit(OpJumpIfFalse, 0, 0, n.Span)
+	if err := c.compileBlock(n.Statements); err != nil {
+		return err
+	}
+	if n.ElseBranch == nil {
+		c.patch(jump)
+		return nil
+	}
+
+	end := c.emit(OpJump, 0, 0, n.Span)
+	c.patch(jump)
+	if err := c.compileIfStatement(n.ElseBranch); err != nil {
+		return err
+	}
+	c.patch(end)
+	return nil
+}
+
+func (c *compiler) compileWhileStatement(n *ast.WhileStatement) error {
+	b := &block{depth: len(c.scopes), loop: true, loopStart: len(c.function.Code)}
+	if err := c.compileExpression(n.Condition); err != nil {
+		return err
+	}
+	b.breaks = append(b.breaks, c.emit(OpJumpIfFalse, 0, 0, n.Span))
+
+	c.blocks = append(c.blocks, b)
+	if err := c.compileBlock(n.Statements); err != nil {
+		return err
+	}
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	c.emit(OpJump, b.loopStart, 0, n.Span)
+
+	for _, pc := range b.breaks {
+		c.patch(pc)
+	}
+	return nil
+}
+
+func (c *compiler) compileForStatement(n *ast.ForStatement) error {
+	if err := c.compileExpression(n.Iterable); err != nil {
+		return err
+	}
+	c.emit(OpIterate, 0, 0, n.Iterable.Location())
+
+	// The iterator stays on the stack while looping
+	b := &block{depth: len(c.scopes), loop: true, loopStart: len(c.function.Code)}
+	next := c.emit(OpNext, 0, 0, n.Span)
+	c.pushScope()
+	c.declare(n.ValueSlot, n.ValueIdentifier, n.Span)
+	if n.IndexIdentifier != "" {
+		c.declare(n.IndexSlot, n.IndexIdentifier, n.Span)
+	} else {
+		c.emit(OpPop, 0, 0, n.Span)
+	}
+
+	c.blocks = append(c.blocks, b)
+	if err := c.compileStatements(n.Statements); err != nil {
+		return err
+	}
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	c.popScope()
+	c.emit(OpJump, b.loopStart, 0, n.Span)
+
+	// Exhausted iterators are popped by OpNext itself, but break leaves
+	// them on the stack
+	c.patch(next)
+	end := c.emit(OpJump, 0, 0, n.Span)
+	for _, pc := range b.breaks {
+		c.patch(pc)
+	}
+	c.emit(OpPop, 0, 0, n.Span)
+	c.patch(end)
+	return nil
+}
+
+// compileTryStatement installs a handler for the try block and, if there
+// is a finally block, for the catch block. The finally statements are
+// compiled once for each way of leaving the statement.
+func (c *compiler) compileTryStatement(n *ast.TryStatement) error {
+	handler := c.emit(OpTry, 0, 0, n.Span)
+	c.blocks = append(c.blocks, &block{depth: len(c.scopes), finally: n.Finally})
+	if err := c.compileBlock(n.Statements); err != nil {
+		return err
+	}
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	c.emit(OpEndTry, 0, 0, n.Span)
+	if err := c.compileFinally(n); err != nil {
+		return err
+	}
+	ends := []int{c.emit(OpJump, 0, 0, n.Span)}
+	c.patch(handler)
+
+	if n.Catch != nil {
+		if n.Finally != nil {
+			handler = c.emit(OpTry, 0, 0, n.Catch.Span)
+			c.blocks = append(c.blocks, &block{depth: len(c.scopes), finally: n.Finally})
+		}
+		c.pushScope()
+		c.emit(OpCatch, 0, 0, n.Catch.Span)
+		c.declare(n.Catch.Slot, n.Catch.Identifier, n.Catch.Span)
+		if err := c.compileStatements(n.Catch.Statements); err != nil {
+			return err
+		}
+		c.popScope()
+		if n.Finally == nil {
+			for _, pc := range ends {
+				c.patch(pc)
+			}
+			return nil
+		}
+
+		c.blocks = c.blocks[:len(c.blocks)-1]
+		c.emit(OpEndTry, 0, 0, n.Span)
+		if err := c.compileFinally(n); err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(OpJump, 0, 0, n.Span))
+		c.patch(handler)
+	}
+
+	if err := c.compileFinally(n); err != nil {
+		return err
+	}
+	c.emit(OpRethrow, 0, 0, n.Span)
+
+	for _, pc := range ends {
+		c.patch(pc)
+	}
+	return nil
+}
+
+func (c *compiler) compileFinally(n *ast.TryStatement) error {
+	if n.Finally == nil {
+		return nil
+	}
+	return c.compileBlock(n.Finally)
+}
+
+func (c *compiler) compileClassDeclaration(n *ast.ClassDeclaration) error {
+	if n.Superclass != nil {
+		if err := c.compileExpression(n.Superclass); err != nil {
+			return err
+		}
+	}
+
+	class := &Class{ClassDeclaration: n}
+	for _, m := range n.Methods {
+		f, err := c.compileFunction(m, true)
+		if err != nil {
+			return err
+		}
+		class.Methods = append(class.Methods, f)
+	}
+	c.program.Classes = append(c.program.Classes, class)
+
+	span := n.Span
+	if n.Superclass != nil {
+		span = n.Superclass.Span
+	}
+	c.emit(OpClass, len(c.program.Classes)-1, 0, span)
+	c.declare(n.Slot, n.Name, n.Span)
+	return nil
+}
+
+// compileFunction compiles n into a new entry of program.Functions and
+// returns its index. The captures of methods are relative to the scope
+// binding them to an instance, a child scope of the one they are declared
+// in.
+func (c *compiler) compileFunction(n *ast.Function, method bool) (int, error) {
+	f := &Function{Name: n.Name, Parameters: n.Parameters, Locals: len(n.Parameters)}
+	fc := &compiler{program: c.program, function: f, names: c.names, inFunction: true}
+	for _, capture := range n.Captures {
+		var source CaptureSource
+		var l location
+		if method && capture.ScopeIndex == 0 {
+			source, l.index = CaptureBinding, capture.Slot
+		} else {
+			index := capture.ScopeIndex
+			if method {
+				index--
+			}
+			l = c.resolve(index, capture.Slot)
+			if l.kind == inProgramScope {
+				// Accessed in the scope of the program directly
+				fc.captures = append(fc.captures, l)
+				continue
+			}
+			source = CaptureLocal
+			if l.kind == inCaptured {
+				source = CaptureCaptured
+			}
+		}
+		f.Captures = append(f.Captures, Capture{Source: source, Index: l.index})
+		fc.captures = append(fc.captures, location{kind: inCaptured, index: len(f.Captures) - 1})
+	}
+	// The parameters are declared in a scope of their own
+	fc.scopes = []*scope{{size: len(n.Parameters)}, {base: len(n.Parameters)}}
+	if err := fc.compileStatements(n.Statements); err != nil {
+		return 0, err
+	}
+	fc.emit(OpNil, 0, 0, n.Span)
+	fc.emit(OpReturn, 0, 0, n.Span)
+
+	c.program.Functions = append(c.program.Functions, f)
+	return len(c.program.Functions) - 1, nil
+}
+
+func (c *compiler) compileExpressions(expressions []ast.Expression) error {
+	for _, e := range expressions {
+		if err := c.compileExpression(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *compiler) compileExpression(n ast.Expression) error {
+	switch e := n.(type) {
+	case *ast.Function:
+		f, err := c.compileFunction(e, false)
+		if err != nil {
+			return err
+		}
+		c.emit(OpClosure, f, 0, e.Span)
+	case *ast.Integer:
+		c.emit(OpConstant, c.constant((*evaluator.Integer)(e)), 0, e.Span)
+	case *ast.Float:
+		c.emit(OpConstant, c.constant((*evaluator.Float)(e)), 0, e.Span)
+	case *ast.String:
+		c.emit(OpConstant, c.constant((*evaluator.String)(e)), 0, e.Span)
+	case *ast.Boolean:
+		c.emit(OpConstant, c.constant((*evaluator.Boolean)(e)), 0, e.Span)
+	case *ast.Nil:
+		c.emit(OpNil, 0, 0, e.Span)
+	case *ast.InterpolatedString:
+		if err := c.compileExpressions(e.Parts); err != nil {
+			return err
+		}
+		c.emit(OpInterpolate, len(e.Parts), 0, e.Span)
+	case *ast.ArrayExpression:
+		if err := c.compileExpressions(e.Items); err != nil {
+			return err
+		}
+		c.emit(OpArray, len(e.Items), 0, e.Span)
+	case *ast.MapExpression:
+		c.emit(OpMap, 0, 0, e.Span)
+		for _, entry := range e.Entries {
+			if err := c.compileExpression(entry.Key); err != nil {
+				return err
+			}
+			if err := c.compileExpression(entry.Value); err != nil {
+				return err
+			}
+			c.emit(OpMapEntry, 0, 0, entry.Key.Location())
+		}
+	case *ast.IfExpression:
+		return c.compileIfExpression(e)
+	case *ast.BinaryOperationExpression:
+		if err := c.compileExpression(e.A); err != nil {
+			return err
+		}
+		if err := c.compileExpression(e.B); err != nil {
+			return err
+		}
+		c.emit(OpBinary, int(e.Operator), 0, e.Span)
+	case *ast.UnaryOperationExpression:
+		if err := c.compileExpression(e.A); err != nil {
+			return err
+		}
+		c.emit(OpUnary, int(e.Operator), 0, e.Span)
+	case *ast.LookupExpression:
+		c.load(e.ScopeIndex, e.Slot, e.Span)
+	case *ast.CallExpression:
+		if err := c.compileExpression(e.Callee); err != nil {
+			return err
+		}
+		if err := c.compileExpressions(e.Parameters); err != nil {
+			return err
+		}
+		c.emit(OpCall, len(e.Parameters), 0, e.Span)
+	case *ast.SubscriptExpression:
+		if err := c.compileExpression(e.Target); err != nil {
+			return err
+		}
+		if err := c.compileExpression(e.Index); err != nil {
+			return err
+		}
+		c.emit(OpSubscript, 0, 0, e.Span)
+	case *ast.MemberExpression:
+		if err := c.compileExpression(e.Target); err != nil {
+			return err
+		}
+		c.emit(OpMember, c.name(e.Name), 0, e.Span)
+	}
+	return nil
+}
+
+func (c *compiler) compileIfExpression(n *ast.IfExpression) error {
+	if n.Condition == nil {
+		return c.compileExpression(n.Value)
+	}
+
+	if err := c.compileExpression(n.Condition); err != nil {
+		return err
+	}
+	jump := c.emit(OpJumpIfFalse, 0, 0, n.Span)
+	if err := c.compileExpression(n.Value); err != nil {
+		return err
+	}
+	end := c.emit(OpJump, 0, 0, n.Span)
+	c.patch(jump)
+	// Else branch must be set if condition is set
+	if err := c.compileIfExpression(n.ElseBranch); err != nil {
+		return err
+	}
+	c.patch(end)
+	return nil
+}
@@ -0,0 +1,102 @@
+package compiler
+
+import "fmt"
+
+// Opcode identifies the operation of an instruction. The comments list the
+// meaning of the operands A and B.
+type Opcode byte
+
+const (
+	OpConstant      Opcode = iota // push Constants[A]
+	OpNil                         // push nil
+	OpPop                         // discard the top of the stack
+	OpLoad                        // push the variable in slot B of the program's scope A levels up
+	OpStore                       // pop into the variable in slot B of the program's scope A levels up
+	OpDeclare                     // pop into a new variable named Names[B] in slot A of the program's scope
+	OpPreDeclare                  // declare Names[B] in slot A of the program's scope, pending until stored
+	OpLoadLocal                   // push the local variable A
+	OpStoreLocal                  // pop into the local variable A
+	OpDeclareLocal                // pop into a new local variable A
+	OpLoadCaptured                // push the captured variable A
+	OpStoreCaptured               // pop into the captured variable A
+	OpJump                        // continue at A
+	OpJumpIfFalse                 // pop and continue at A if the value is false
+	OpBinary                      // apply the ast.BinaryOperator A to the two topmost values
+	OpUnary                       // apply the ast.UnaryOperator A to the topmost value
+	OpArray                       // replace the A topmost values with an array
+	OpMap                         // push an empty map
+	OpMapEntry                    // pop key and value and add them to the map below
+	OpInterpolate                 // replace the A topmost values with their concatenation
+	OpSubscript                   // replace target and index with target[index]
+	OpSetSubscript                // pop target, index and value and assign target[index]
+	OpMember                      // replace the topmost value with its member Names[A]
+	OpSetMember                   // pop target and value and assign the member Names[A]
+	OpClosure                     // push a closure of Functions[A]
+	OpStruct                      // push the struct type of Structs[A]
+	OpClass                       // push the class of Classes[A], popping its superclass if it has one
+	OpCall                        // call the function below the A topmost values with them as arguments
+	OpReturn                      // return the topmost value from the current function
+	OpIterate                     // replace the topmost value with an iterator over it
+	OpNext                        // push index and value of the iterator's next element or pop it and continue at A
+	OpThrow                       // throw the topmost value
+	OpTry                         // continue at A with the error pushed if one occurs until the matching OpEndTry
+	OpEndTry                      // remove the innermost error handler
+	OpCatch                       // replace the error pushed by a handler with the value bound by catch
+	OpRethrow                     // pop the error pushed by a handler and raise it again
+)
+
+var opcodeNames = [...]string{
+	OpConstant:      "Constant",
+	OpNil:           "Nil",
+	OpPop:           "Pop",
+	OpLoad:          "Load",
+	OpStore:         "Store",
+	OpDeclare:       "Declare",
+	OpPreDeclare:    "PreDeclare",
+	OpLoadLocal:     "LoadLocal",
+	OpStoreLocal:    "StoreLocal",
+	OpDeclareLocal:  "DeclareLocal",
+	OpLoadCaptured:  "LoadCaptured",
+	OpStoreCaptured: "StoreCaptured",
+	OpJump:          "Jump",
+	OpJumpIfFalse:   "JumpIfFalse",
+	OpBinary:        "Binary",
+	OpUnary:         "Unary",
+	OpArray:         "Array",
+	OpMap:           "Map",
+	OpMapEntry:      "MapEntry",
+	OpInterpolate:   "Interpolate",
+	OpSubscript:     "Subscript",
+	OpSetSubscript:  "SetSubscript",
+	OpMember:        "Member",
+	OpSetMember:     "SetMember",
+	OpClosure:       "Closure",
+	OpStruct:        "Struct",
+	OpClass:         "Class",
+	OpCall:          "Call",
+	OpReturn:        "Return",
+	OpIterate:       "Iterate",
+	OpNext:          "Next",
+	OpThrow:         "Throw",
+	OpTry:           "Try",
+	OpEndTry:        "EndTry",
+	OpCatch:         "Catch",
+	OpRethrow:       "Rethrow",
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("Opcode(%d)", op)
+}
+
+// Instruction is a single operation with up to two operands.
+type Instruction struct {
+	Op   Opcode
+	A, B int
+}
+
+func (i Instruction) String() string {
+	return fmt.Sprintf("%s %d %d", i.Op, i.A, i.B)
+}
@@ -0,0 +1,79 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/evaluator"
+)
+
+// Program is the compiled form of an ast.Program. Instructions refer to its
+// tables by index.
+type Program struct {
+	Main      *Function
+	Constants []evaluator.Object
+	Names     []string
+	Functions []*Function
+	Structs   []*ast.StructDeclaration
+	Classes   []*Class
+}
+
+// Function holds the code of a function literal or, for Program.Main, of
+// the top level statements. Spans holds the position of each instruction.
+//
+// The variables of a call are kept in Locals slots on the stack, starting
+// with the parameters. Variables captured from the scope the program runs
+// in are accessed there, all others are captured when a closure of the
+// function is created, as listed by Captures.
+type Function struct {
+	Name       string
+	Parameters []string
+	Locals     int
+	Captures   []Capture
+	Code       []Instruction
+	Spans      []ast.Span
+}
+
+// CaptureSource tells where a closure takes a captured variable from.
+type CaptureSource int
+
+const (
+	// Local variable Index of the call creating the closure
+	CaptureLocal CaptureSource = iota
+	// Variable Index captured by the closure creating the closure
+	CaptureCaptured
+	// Slot Index of the scope binding a method to an instance, which
+	// declares self and super
+	CaptureBinding
+)
+
+// Capture is a variable captured by a closure.
+type Capture struct {
+	Source CaptureSource
+	Index  int
+}
+
+// Class is a compiled class declaration. Methods are indices into
+// Program.Functions, in declaration order.
+type Class struct {
+	*ast.ClassDeclaration
+	Methods []int
+}
+
+// Disassemble lists the instructions of all functions of p.
+func (p *Program) Disassemble() string {
+	var b strings.Builder
+	disassemble(&b, "<main>", p.Main)
+	for i, f := range p.Functions {
+		disassemble(&b, fmt.Sprintf("function %d (%s)", i, f.Name), f)
+	}
+	return b.String()
+}
+
+func disassemble(b *strings.Builder, name string, f *Function) {
+	fmt.Fprintf(b, "%s:\n", name)
+	for pc, i := range f.Code {
+		fmt.Fprintf(b, "%4d  %-24s %s\n", pc, i, f.Spans[pc].Position())
+	}
+}
@@ -0,0 +1,530 @@
+// Package dap implements a Debug Adapter Protocol server for nklang. It runs
+// programs on the evaluator under control of the debugger package, so that
+// editors can set breakpoints, step through programs and inspect their
+// variables.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/builtins"
+	"github.com/niklaskorz/nklang/debugger"
+	"github.com/niklaskorz/nklang/evaluator"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+	"github.com/niklaskorz/nklang/semantics"
+)
+
+// The evaluator runs programs on a single thread.
+const threadID = 1
+
+// Server is a debug adapter communicating over a pair of streams. The
+// program runs on its own goroutine, which blocks while it is paused.
+type Server struct {
+	predefined []builtins.Builtin
+	d          *debugger.Debugger
+
+	wmu sync.Mutex
+	w   io.Writer
+	seq int
+
+	mu         sync.Mutex
+	program    *ast.Program
+	noDebug    bool
+	stdin      *bufio.Reader
+	configured bool
+	started    bool
+	paused     bool
+	// handles holds the values of the variable references handed out since
+	// the program paused, at index reference-1
+	handles []interface{}
+	resume  chan struct{}
+	done    chan struct{}
+}
+
+// NewServer returns a server running programs in which the builtins in
+// predefined are declared. Output of print and println is sent to the
+// client instead of stdout, which carries the protocol.
+func NewServer(predefined []builtins.Builtin) *Server {
+	s := &Server{
+		predefined: predefined,
+		d:          debugger.New(),
+		resume:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	s.d.Stopped = s.stopped
+	return s
+}
+
+// Serve reads requests from r and writes responses and events to w until
+// the client disconnects or r is closed. A running program is terminated
+// before Serve returns.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	defer s.terminate()
+	rd := textproto.NewReader(bufio.NewReader(r))
+	for {
+		header, err := rd.ReadMIMEHeader()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			return fmt.Errorf("Invalid Content-Length: %s", header.Get("Content-Length"))
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(rd.R, body); err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return err
+		}
+		result, after, err := s.handle(req)
+		res := response{Type: "response", RequestSeq: req.Seq, Success: err == nil, Command: req.Command, Body: result}
+		if err != nil {
+			res.Message = err.Error()
+		}
+		if err := s.send(&res.Seq, &res); err != nil {
+			return err
+		}
+		if after != nil {
+			after()
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+// send writes the message v after setting its sequence number, pointed to
+// by seq.
+func (s *Server) send(seq *int, v interface{}) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.seq++
+	*seq = s.seq
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+// event sends an event. Failed writes are reported by the next response.
+func (s *Server) event(name string, body interface{}) {
+	e := event{Type: "event", Event: name, Body: body}
+	s.send(&e.Seq, &e)
+}
+
+// handle dispatches req. It returns the body of the response and optionally
+// a function to call once the response has been sent.
+func (s *Server) handle(req request) (interface{}, func(), error) {
+	var args interface{}
+	var handler func() (interface{}, func(), error)
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsTerminateRequest":         true,
+		}, func() { s.event("initialized", nil) }, nil
+	case "launch":
+		a := &launchArguments{}
+		args, handler = a, func() (interface{}, func(), error) {
+			return nil, s.start, s.launch(a)
+		}
+	case "configurationDone":
+		s.mu.Lock()
+		s.configured = true
+		s.mu.Unlock()
+		return nil, s.start, nil
+	case "setBreakpoints":
+		a := &setBreakpointsArguments{}
+		args, handler = a, func() (interface{}, func(), error) {
+			return s.setBreakpoints(a), nil, nil
+		}
+	case "threads":
+		return map[string]interface{}{"threads": []Thread{{ID: threadID, Name: "main"}}}, nil, nil
+	case "stackTrace":
+		a := &stackTraceArguments{}
+		args, handler = a, func() (interface{}, func(), error) {
+			return s.stackTrace(a), nil, nil
+		}
+	case "scopes":
+		a := &scopesArguments{}
+		args, handler = a, func() (interface{}, func(), error) {
+			return s.scopes(a)
+		}
+	case "variables":
+		a := &variablesArguments{}
+		args, handler = a, func() (interface{}, func(), error) {
+			return s.variables(a)
+		}
+	case "continue":
+		return map[string]bool{"allThreadsContinued": true}, s.step(s.d.Continue), nil
+	case "next":
+		return nil, s.step(s.d.StepOver), nil
+	case "stepIn":
+		return nil, s.step(s.d.StepInto), nil
+	case "stepOut":
+		return nil, s.step(s.d.StepOut), nil
+	case "pause":
+		s.d.Pause()
+		return nil, nil, nil
+	case "terminate", "disconnect":
+		return nil, s.terminate, nil
+	default:
+		return nil, nil, fmt.Errorf("Unknown command %s", req.Command)
+	}
+
+	if len(req.Arguments) > 0 {
+		if err := json.Unmarshal(req.Arguments, args); err != nil {
+			return nil, nil, err
+		}
+	}
+	return handler()
+}
+
+// launch loads the program to debug. It starts running once the client has
+// finished configuring breakpoints.
+func (s *Server) launch(a *launchArguments) error {
+	path, err := filepath.Abs(a.Program)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := lexer.NewScanner(f)
+	sc.File = path
+	p, err := parser.Parse(sc)
+	if err != nil {
+		return err
+	}
+	ds := semantics.NewScope()
+	for _, b := range s.predefined {
+		ds.Declare(b.Name)
+	}
+	if err := semantics.AnalyzeLookupsWithScope(p, ds); err != nil {
+		return err
+	}
+
+	var stdin *bufio.Reader
+	if a.Stdin != "" {
+		in, err := os.Open(a.Stdin)
+		if err != nil {
+			return err
+		}
+		stdin = bufio.NewReader(in)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.program != nil {
+		return fmt.Errorf("A program has already been launched")
+	}
+	if !a.StopOnEntry {
+		s.d.Continue()
+	}
+	s.program = p
+	s.noDebug = a.NoDebug
+	s.stdin = stdin
+	return nil
+}
+
+// start runs the launched program unless it is running already or the
+// client is still configuring.
+func (s *Server) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.program == nil || !s.configured || s.started {
+		return
+	}
+	s.started = true
+
+	scope := evaluator.NewScope()
+	for _, b := range s.predefined {
+		f := b.Function
+		switch b.Name {
+		case "print":
+			f = evaluator.WrapFunction(s.print)
+		case "println":
+			f = evaluator.WrapFunction(s.println)
+		case "input":
+			f = evaluator.WrapFunction(s.input)
+		}
+		scope.Declare(b.Name, f)
+	}
+	if !s.noDebug {
+		scope.SetHooks(s.d)
+	}
+
+	go func() {
+		defer close(s.done)
+		exitCode := 0
+		if err := evaluator.EvaluateWithScope(s.program, scope); err != nil && err != debugger.ErrTerminated {
+			s.event("output", outputEventBody{Category: "stderr", Output: err.Error() + "\n"})
+			exitCode = 1
+		}
+		s.event("exited", exitedEventBody{ExitCode: exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+func (s *Server) print(params []evaluator.Object) (evaluator.Object, error) {
+	s.event("output", outputEventBody{Category: "stdout", Output: evaluator.FormatObjects(params)})
+	return evaluator.NilObject, nil
+}
+
+func (s *Server) println(params []evaluator.Object) (evaluator.Object, error) {
+	s.event("output", outputEventBody{Category: "stdout", Output: evaluator.FormatObjects(params) + "\n"})
+	return evaluator.NilObject, nil
+}
+
+// input reads a line from the file given as stdin when launching, as stdin
+// carries the protocol.
+func (s *Server) input(params []evaluator.Object) (evaluator.Object, error) {
+	if s.stdin == nil {
+		return nil, fmt.Errorf("input needs the stdin launch argument while debugging")
+	}
+	s.print(params)
+	text, err := s.stdin.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	return &evaluator.String{Value: strings.TrimSuffix(text, "\n")}, nil
+}
+
+// stopped is called by the debugger on the program's goroutine and blocks
+// until the client resumes the program.
+func (s *Server) stopped(reason debugger.Reason) {
+	s.mu.Lock()
+	s.paused = true
+	s.handles = nil
+	s.mu.Unlock()
+	s.event("stopped", stoppedEventBody{Reason: reason.String(), ThreadID: threadID, AllThreadsStopped: true})
+	<-s.resume
+	s.mu.Lock()
+	s.paused = false
+	s.mu.Unlock()
+}
+
+// step returns a function that resumes the paused program after calling
+// prepare.
+func (s *Server) step(prepare func()) func() {
+	return func() {
+		s.mu.Lock()
+		paused := s.paused
+		s.paused = false
+		s.mu.Unlock()
+		if paused {
+			prepare()
+			s.resume <- struct{}{}
+		}
+	}
+}
+
+// terminate ends the program and waits for it to finish.
+func (s *Server) terminate() {
+	s.d.Terminate()
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if !started {
+		return
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		case s.resume <- struct{}{}:
+			// The program was paused, possibly just before Terminate
+		}
+	}
+}
+
+func (s *Server) setBreakpoints(a *setBreakpointsArguments) interface{} {
+	lines := a.Lines
+	if a.Breakpoints != nil {
+		lines = nil
+		for _, b := range a.Breakpoints {
+			lines = append(lines, b.Line)
+		}
+	}
+	path, err := filepath.Abs(a.Source.Path)
+	if err != nil {
+		path = a.Source.Path
+	}
+	s.d.SetBreakpoints(path, lines)
+
+	breakpoints := []Breakpoint{}
+	for _, l := range lines {
+		breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: l})
+	}
+	return map[string]interface{}{"breakpoints": breakpoints}
+}
+
+// frames returns the frames of the paused program, innermost first, or nil
+// if it is running.
+func (s *Server) frames() []*debugger.Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.paused {
+		return nil
+	}
+	return s.d.Frames()
+}
+
+func (s *Server) stackTrace(a *stackTraceArguments) interface{} {
+	frames := s.frames()
+	stackFrames := []StackFrame{}
+	for i, f := range frames {
+		if i < a.StartFrame || a.Levels > 0 && i >= a.StartFrame+a.Levels {
+			continue
+		}
+		sf := StackFrame{ID: i + 1, Name: f.Name}
+		if f.Statement != nil {
+			span := f.Statement.Location()
+			sf.Source = &Source{Name: filepath.Base(span.File), Path: span.File}
+			sf.Line, sf.Column = span.Line, span.Column
+		}
+		stackFrames = append(stackFrames, sf)
+	}
+	return map[string]interface{}{"stackFrames": stackFrames, "totalFrames": len(frames)}
+}
+
+func (s *Server) scopes(a *scopesArguments) (interface{}, func(), error) {
+	frames := s.frames()
+	if a.FrameID < 1 || a.FrameID > len(frames) {
+		return nil, nil, fmt.Errorf("No frame %d", a.FrameID)
+	}
+	f := frames[a.FrameID-1]
+	scopes := []Scope{}
+	if f.Scope != nil {
+		name, hint := "Locals", "locals"
+		if a.FrameID == len(frames) {
+			name, hint = "Globals", ""
+		}
+		scopes = append(scopes, Scope{Name: name, PresentationHint: hint, VariablesReference: s.reference(f.Scope)})
+	}
+	return map[string]interface{}{"scopes": scopes}, nil, nil
+}
+
+// reference returns a variable reference for v, which must be a scope or an
+// object with children. It is valid until the program resumes.
+func (s *Server) reference(v interface{}) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handles = append(s.handles, v)
+	return len(s.handles)
+}
+
+func (s *Server) variables(a *variablesArguments) (interface{}, func(), error) {
+	s.mu.Lock()
+	if !s.paused || a.VariablesReference < 1 || a.VariablesReference > len(s.handles) {
+		s.mu.Unlock()
+		return nil, nil, fmt.Errorf("Invalid variables reference %d", a.VariablesReference)
+	}
+	v := s.handles[a.VariablesReference-1]
+	s.mu.Unlock()
+
+	variables := []Variable{}
+	add := func(name string, o evaluator.Object) {
+		variables = append(variables, s.variable(name, o))
+	}
+	switch v := v.(type) {
+	case *evaluator.DefinitionScope:
+		// Inner variables shadow outer ones of the same name
+		seen := make(map[string]bool)
+		for scope := v; scope != nil; scope = scope.Parent() {
+			vars := scope.Variables()
+			visible := make([]bool, len(vars))
+			for i := len(vars) - 1; i >= 0; i-- {
+				if _, ok := vars[i].Value.(*evaluator.PredefinedFunction); !ok && !seen[vars[i].Name] {
+					seen[vars[i].Name] = true
+					visible[i] = true
+				}
+			}
+			for i, v := range vars {
+				if visible[i] {
+					add(v.Name, v.Value)
+				}
+			}
+		}
+	case *evaluator.Array:
+		for i, item := range v.Items {
+			add(fmt.Sprintf("[%d]", i), item)
+		}
+	case *evaluator.Map:
+		values := v.Values()
+		for i, k := range v.Keys() {
+			add(formatValue(k), values[i])
+		}
+	case *evaluator.Record:
+		for i, f := range v.Type.Fields {
+			add(f, v.Values[i])
+		}
+	case *evaluator.Instance:
+		for _, f := range v.Fields() {
+			o, _ := v.Member(f)
+			add(f, o)
+		}
+	case *evaluator.Error:
+		add("kind", &evaluator.String{Value: v.Kind})
+		add("message", &evaluator.String{Value: v.Message})
+	}
+	return map[string]interface{}{"variables": variables}, nil, nil
+}
+
+// variable describes o as variable name, handing out a reference if o has
+// children.
+func (s *Server) variable(name string, o evaluator.Object) Variable {
+	v := Variable{Name: name, Value: formatValue(o), Type: o.TypeName()}
+	switch o := o.(type) {
+	case *evaluator.Array:
+		if len(o.Items) > 0 {
+			v.VariablesReference = s.reference(o)
+		}
+	case *evaluator.Map:
+		if o.Len() > 0 {
+			v.VariablesReference = s.reference(o)
+		}
+	case *evaluator.Record:
+		if len(o.Values) > 0 {
+			v.VariablesReference = s.reference(o)
+		}
+	case *evaluator.Instance:
+		if len(o.Fields()) > 0 {
+			v.VariablesReference = s.reference(o)
+		}
+	case *evaluator.Error:
+		v.VariablesReference = s.reference(o)
+	}
+	return v
+}
+
+// formatValue formats o like println does, but quotes strings.
+func formatValue(o evaluator.Object) string {
+	if s, ok := o.(*evaluator.String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return evaluator.FormatObject(o)
+}
@@ -0,0 +1,250 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niklaskorz/nklang/builtins"
+)
+
+// message is a response or event sent by the server.
+type message struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client drives a debug session with a server running on another
+// goroutine.
+type client struct {
+	t        *testing.T
+	w        *io.PipeWriter
+	messages chan message
+	errors   chan error
+	seq      int
+	// events received while waiting for something else
+	events []message
+	output strings.Builder
+}
+
+func newClient(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, w: inW, messages: make(chan message, 64), errors: make(chan error, 1)}
+	go func() {
+		err := NewServer(builtins.Predefined).Serve(inR, outW)
+		outW.Close()
+		c.errors <- err
+	}()
+	go func() {
+		defer close(c.messages)
+		rd := textproto.NewReader(bufio.NewReader(outR))
+		for {
+			header, err := rd.ReadMIMEHeader()
+			if err != nil {
+				return
+			}
+			length, err := strconv.Atoi(header.Get("Content-Length"))
+			if err != nil {
+				return
+			}
+			body := make([]byte, length)
+			if _, err := io.ReadFull(rd.R, body); err != nil {
+				return
+			}
+			var m message
+			if err := json.Unmarshal(body, &m); err != nil {
+				return
+			}
+			c.messages <- m
+		}
+	}()
+	return c
+}
+
+// receive returns the next message of the server.
+func (c *client) receive() message {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("Server closed the connection")
+		}
+		if m.Type == "event" && m.Event == "output" {
+			var body outputEventBody
+			json.Unmarshal(m.Body, &body)
+			c.output.WriteString(body.Output)
+		}
+		return m
+	case <-time.After(10 * time.Second):
+		c.t.Fatal("Timed out waiting for the server")
+	}
+	return message{}
+}
+
+// request sends a request and decodes the body of its successful response
+// into body, unless body is nil.
+func (c *client) request(command string, arguments interface{}, body interface{}) {
+	c.t.Helper()
+	c.seq++
+	req := map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": arguments}
+	data, err := json.Marshal(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		m := c.receive()
+		if m.Type == "event" {
+			c.events = append(c.events, m)
+			continue
+		}
+		if m.RequestSeq != c.seq {
+			c.t.Fatalf("Expected response to %d, got %d", c.seq, m.RequestSeq)
+		}
+		if !m.Success {
+			c.t.Fatalf("%s failed: %s", command, m.Message)
+		}
+		if body != nil {
+			if err := json.Unmarshal(m.Body, body); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return
+	}
+}
+
+// event waits for the event name and decodes its body into body, unless
+// body is nil. Events received before are skipped.
+func (c *client) event(name string, body interface{}) {
+	c.t.Helper()
+	for {
+		var m message
+		if len(c.events) > 0 {
+			m, c.events = c.events[0], c.events[1:]
+		} else {
+			m = c.receive()
+		}
+		if m.Type != "event" || m.Event != name {
+			continue
+		}
+		if body != nil {
+			if err := json.Unmarshal(m.Body, body); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return
+	}
+}
+
+// stopped waits until the program stops for reason and returns its
+// innermost frame along with the local variables in it.
+func (c *client) stopped(reason string) (StackFrame, map[string]string) {
+	c.t.Helper()
+	var stopped stoppedEventBody
+	c.event("stopped", &stopped)
+	if stopped.Reason != reason {
+		c.t.Fatalf("Expected to stop for %s, stopped for %s", reason, stopped.Reason)
+	}
+
+	var trace struct {
+		StackFrames []StackFrame `json:"stackFrames"`
+	}
+	c.request("stackTrace", map[string]interface{}{"threadId": threadID}, &trace)
+	if len(trace.StackFrames) == 0 {
+		c.t.Fatal("Expected stack frames")
+	}
+	var scopes struct {
+		Scopes []Scope `json:"scopes"`
+	}
+	c.request("scopes", map[string]interface{}{"frameId": trace.StackFrames[0].ID}, &scopes)
+	if len(scopes.Scopes) == 0 {
+		c.t.Fatal("Expected a scope")
+	}
+	var variables struct {
+		Variables []Variable `json:"variables"`
+	}
+	c.request("variables", map[string]interface{}{"variablesReference": scopes.Scopes[0].VariablesReference}, &variables)
+	vars := make(map[string]string)
+	for _, v := range variables.Variables {
+		vars[v.Name] = v.Value
+	}
+	return trace.StackFrames[0], vars
+}
+
+func TestDebugExample(t *testing.T) {
+	program, err := filepath.Abs("../example.nk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := ioutil.TempFile("", "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(stdin.Name())
+	stdin.WriteString("nklang\n")
+	stdin.Close()
+
+	c := newClient(t)
+	c.request("initialize", map[string]interface{}{"adapterID": "nklg"}, nil)
+	c.event("initialized", nil)
+	c.request("launch", map[string]interface{}{"program": program, "stdin": stdin.Name()}, nil)
+	// return n * faculty(n - 1);
+	source := map[string]interface{}{"path": program}
+	c.request("setBreakpoints", map[string]interface{}{"source": source, "breakpoints": []map[string]int{{"line": 74}}}, nil)
+	c.request("configurationDone", nil, nil)
+
+	frame, vars := c.stopped("breakpoint")
+	if frame.Name != "faculty" || frame.Line != 74 || vars["n"] != "9" {
+		t.Errorf("Expected to stop in faculty at line 74 with n = 9, got %s at line %d with %v", frame.Name, frame.Line, vars)
+	}
+	if !strings.Contains(c.output.String(), "It's not low\n") || strings.Contains(c.output.String(), "9! =") {
+		t.Errorf("Expected the output up to the call of faculty, got %q", c.output.String())
+	}
+
+	c.request("stepIn", map[string]interface{}{"threadId": threadID}, nil)
+	frame, vars = c.stopped("step")
+	if frame.Name != "faculty" || frame.Line != 71 || vars["n"] != "8" {
+		t.Errorf("Expected to step into faculty at line 71 with n = 8, got %s at line %d with %v", frame.Name, frame.Line, vars)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": threadID}, nil)
+	frame, vars = c.stopped("breakpoint")
+	if frame.Line != 74 || vars["n"] != "8" {
+		t.Errorf("Expected to stop at line 74 with n = 8, got line %d with %v", frame.Line, vars)
+	}
+
+	c.request("setBreakpoints", map[string]interface{}{"source": source, "breakpoints": []map[string]int{}}, nil)
+	c.request("continue", map[string]interface{}{"threadId": threadID}, nil)
+	var exited exitedEventBody
+	c.event("exited", &exited)
+	c.event("terminated", nil)
+	if exited.ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exited.ExitCode)
+	}
+	for _, expected := range []string{"9! = 362880\n", "pow(6)(3): 729\n", "So your name is nklang\n"} {
+		if !strings.Contains(c.output.String(), expected) {
+			t.Errorf("Expected output to contain %q, got %q", expected, c.output.String())
+		}
+	}
+
+	c.request("disconnect", nil, nil)
+	if err := <-c.errors; err != nil {
+		t.Fatal(err)
+	}
+}
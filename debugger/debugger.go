@@ -0,0 +1,245 @@
+// Package debugger pauses the evaluation of nklang programs at breakpoints
+// and after steps, giving access to the active calls and their variables
+// while the evaluation is paused. It only decides when to pause; user
+// interfaces are built on top of it through the Stopped callback.
+package debugger
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/evaluator"
+)
+
+// Reason tells why the evaluation has been paused.
+type Reason int
+
+const (
+	// Entry means the evaluation is about to run its first statement
+	Entry Reason = iota
+	Breakpoint
+	Step
+	// Pause means Pause has been called
+	Pause
+)
+
+func (r Reason) String() string {
+	switch r {
+	case Entry:
+		return "entry"
+	case Breakpoint:
+		return "breakpoint"
+	case Step:
+		return "step"
+	case Pause:
+		return "pause"
+	}
+	return "?"
+}
+
+// ErrTerminated is returned by an evaluation aborted by Terminate.
+var ErrTerminated = errors.New("Terminated by debugger")
+
+type mode int
+
+const (
+	running mode = iota
+	stepInto
+	stepOver
+	stepOut
+)
+
+// Frame is an active function call or, at the bottom of the stack, the top
+// level of the program.
+type Frame struct {
+	// Name of the called function, "<main>" for the top level
+	Name string
+	// Position of the call, the zero Span for the top level
+	CallSite ast.Span
+	// Statement is the statement being evaluated in the frame and Scope the
+	// innermost scope it is evaluated in
+	Statement ast.Statement
+	Scope     *evaluator.DefinitionScope
+}
+
+// Debugger implements evaluator.Hooks. Before the evaluation starts, the
+// debugger pauses at the first statement unless Continue has been called.
+type Debugger struct {
+	// Stopped is called on the evaluating goroutine whenever the evaluation
+	// pauses. The evaluation resumes when it returns, according to the last
+	// call of Continue, StepInto, StepOver, StepOut or Terminate.
+	Stopped func(reason Reason)
+
+	mu          sync.Mutex
+	breakpoints map[string]map[int]bool
+	mode        mode
+	entry       bool
+	pause       bool
+	terminate   bool
+	// Number of frames and innermost frame when the current step started
+	depth  int
+	from   *Frame
+	frames []*Frame
+}
+
+// New returns a debugger that pauses at the first statement.
+func New() *Debugger {
+	return &Debugger{
+		breakpoints: make(map[string]map[int]bool),
+		mode:        stepInto,
+		entry:       true,
+		frames:      []*Frame{{Name: "<main>"}},
+	}
+}
+
+// SetBreakpoints replaces the breakpoints in file by breakpoints at the
+// given lines. file is the name the program was parsed with.
+func (d *Debugger) SetBreakpoints(file string, lines []int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m := make(map[int]bool)
+	for _, l := range lines {
+		m[l] = true
+	}
+	d.breakpoints[file] = m
+}
+
+// Breakpoints returns the lines in file that have a breakpoint.
+func (d *Debugger) Breakpoints(file string) []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var lines []int
+	for l := range d.breakpoints[file] {
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// Continue resumes the evaluation up to the next breakpoint.
+func (d *Debugger) Continue() {
+	d.resume(running)
+}
+
+// StepInto resumes the evaluation up to the next statement.
+func (d *Debugger) StepInto() {
+	d.resume(stepInto)
+}
+
+// StepOver resumes the evaluation up to the next statement of the current
+// function, not pausing in the functions it calls.
+func (d *Debugger) StepOver() {
+	d.resume(stepOver)
+}
+
+// StepOut resumes the evaluation up to the next statement after the current
+// function has returned.
+func (d *Debugger) StepOut() {
+	d.resume(stepOut)
+}
+
+func (d *Debugger) resume(m mode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entry = false
+	d.mode = m
+	d.depth = len(d.frames)
+	d.from = d.frames[len(d.frames)-1]
+}
+
+// Pause makes a running evaluation pause at its next statement. Unlike the
+// other methods, it may be called while the evaluation is running.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pause = true
+}
+
+// Terminate makes the evaluation return ErrTerminated at its next
+// statement.
+func (d *Debugger) Terminate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.terminate = true
+}
+
+// Frames returns the active frames, innermost first. The frames may only be
+// inspected while the evaluation is paused.
+func (d *Debugger) Frames() []*Frame {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	frames := make([]*Frame, len(d.frames))
+	for i, f := range d.frames {
+		frames[len(frames)-1-i] = f
+	}
+	return frames
+}
+
+// Statement implements evaluator.Hooks.
+func (d *Debugger) Statement(n ast.Statement, scope *evaluator.DefinitionScope) error {
+	d.mu.Lock()
+	top := d.frames[len(d.frames)-1]
+	top.Statement = n
+	top.Scope = scope
+	reason, stop := d.reason(n)
+	d.mu.Unlock()
+
+	if stop && d.Stopped != nil {
+		d.Stopped(reason)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.terminate {
+		return ErrTerminated
+	}
+	return nil
+}
+
+// reason decides whether to pause before n and why.
+func (d *Debugger) reason(n ast.Statement) (Reason, bool) {
+	if d.terminate {
+		return 0, false
+	}
+	if d.entry {
+		d.entry = false
+		return Entry, true
+	}
+	if d.pause {
+		d.pause = false
+		return Pause, true
+	}
+	switch d.mode {
+	case stepInto:
+		return Step, true
+	case stepOver:
+		// Calls made after the current one has returned are stepped over
+		// as well
+		if d.frames[len(d.frames)-1] == d.from || len(d.frames) < d.depth {
+			return Step, true
+		}
+	case stepOut:
+		if len(d.frames) < d.depth {
+			return Step, true
+		}
+	}
+	s := n.Location()
+	if d.breakpoints[s.File][s.Line] {
+		return Breakpoint, true
+	}
+	return 0, false
+}
+
+// Enter implements evaluator.Hooks.
+func (d *Debugger) Enter(frame evaluator.StackFrame) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.frames = append(d.frames, &Frame{Name: frame.FunctionName(), CallSite: frame.CallSite})
+}
+
+// Leave implements evaluator.Hooks.
+func (d *Debugger) Leave(frame evaluator.StackFrame) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.frames = d.frames[:len(d.frames)-1]
+}
@@ -0,0 +1,122 @@
+package debugger_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/niklaskorz/nklang/debugger"
+	"github.com/niklaskorz/nklang/evaluator"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+	"github.com/niklaskorz/nklang/semantics"
+)
+
+const file = "debug.nk"
+
+const src = `f := func(n) {
+    x := n + 1;
+    return x * 2;
+};
+a := f(1);
+b := f(a);
+c := a + b;
+`
+
+// run evaluates src under control of d. Whenever the evaluation pauses,
+// the position is recorded as "reason line function" and the next of
+// commands resumes it; once they are used up, the evaluation continues.
+func run(t *testing.T, d *debugger.Debugger, commands ...func(d *debugger.Debugger)) ([]string, error) {
+	s := lexer.NewScanner(strings.NewReader(src))
+	s.File = file
+	p, err := parser.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := semantics.AnalyzeLookups(p); err != nil {
+		t.Fatal(err)
+	}
+
+	var stops []string
+	d.Stopped = func(reason debugger.Reason) {
+		f := d.Frames()[0]
+		stops = append(stops, fmt.Sprintf("%s %d %s", reason, f.Statement.Location().Line, f.Name))
+		if len(commands) == 0 {
+			d.Continue()
+			return
+		}
+		commands[0](d)
+		commands = commands[1:]
+	}
+	scope := evaluator.NewScope()
+	scope.SetHooks(d)
+	return stops, evaluator.EvaluateWithScope(p, scope)
+}
+
+func expectStops(t *testing.T, stops []string, expected ...string) {
+	t.Helper()
+	if strings.Join(stops, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected stops\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(stops, "\n"))
+	}
+}
+
+func TestStepInto(t *testing.T) {
+	stepInto := (*debugger.Debugger).StepInto
+	stops, err := run(t, debugger.New(), stepInto, stepInto, stepInto, stepInto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStops(t, stops, "entry 1 <main>", "step 5 <main>", "step 2 f", "step 3 f", "step 6 <main>")
+}
+
+func TestStepOver(t *testing.T) {
+	stepOver := (*debugger.Debugger).StepOver
+	stops, err := run(t, debugger.New(), stepOver, stepOver, stepOver, stepOver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStops(t, stops, "entry 1 <main>", "step 5 <main>", "step 6 <main>", "step 7 <main>")
+}
+
+func TestStepOut(t *testing.T) {
+	stepInto := (*debugger.Debugger).StepInto
+	stepOut := (*debugger.Debugger).StepOut
+	stops, err := run(t, debugger.New(), stepInto, stepInto, stepOut, stepInto, stepOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStops(t, stops, "entry 1 <main>", "step 5 <main>", "step 2 f", "step 6 <main>", "step 2 f", "step 7 <main>")
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := debugger.New()
+	d.SetBreakpoints(file, []int{3})
+	var values []string
+	inspect := func(d *debugger.Debugger) {
+		frames := d.Frames()
+		if len(frames) != 2 || frames[1].Name != "<main>" {
+			t.Errorf("Expected f to be called from <main>, got %d frames", len(frames))
+		}
+		for _, v := range frames[0].Scope.Variables() {
+			values = append(values, v.Name+"="+evaluator.FormatObject(v.Value))
+		}
+		values = append(values, fmt.Sprintf("called at %d", frames[0].CallSite.Line))
+		d.Continue()
+	}
+	stops, err := run(t, d, (*debugger.Debugger).Continue, inspect, inspect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStops(t, stops, "entry 1 <main>", "breakpoint 3 f", "breakpoint 3 f")
+	if v := strings.Join(values, " "); v != "x=2 called at 5 x=5 called at 6" {
+		t.Errorf("Unexpected variables at the breakpoints: %s", v)
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	stops, err := run(t, debugger.New(), (*debugger.Debugger).StepInto, (*debugger.Debugger).Terminate)
+	if err != debugger.ErrTerminated {
+		t.Errorf("Expected the evaluation to be terminated, got %v", err)
+	}
+	expectStops(t, stops, "entry 1 <main>", "step 5 <main>")
+}
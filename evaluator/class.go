@@ -0,0 +1,171 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// Class is the object created by a class declaration. Calling it creates an
+// Instance and runs the init method, if the class or one of its ancestors
+// defines one.
+type Class struct {
+	*ast.ClassDeclaration
+	Parent  *Class
+	methods map[string]Method
+	// Scope the class was declared in, parent of all method bindings
+	scope *DefinitionScope
+}
+
+// Method implements a method of a Class. Classes evaluated from the AST
+// implement their methods by ast.Function, the virtual machine by compiled
+// code.
+type Method interface {
+	// Bind returns a function running the method in a child scope of scope,
+	// which declares self and, if the class has a parent class, super.
+	Bind(scope *DefinitionScope) Object
+}
+
+// astMethod is a method evaluated from its function literal.
+type astMethod struct {
+	*ast.Function
+}
+
+func (m astMethod) Bind(scope *DefinitionScope) Object {
+	return newFunction(m.Function, scope)
+}
+
+func NewClass(n *ast.ClassDeclaration, parent *Class, scope *DefinitionScope) *Class {
+	methods := make(map[string]Method)
+	for _, m := range n.Methods {
+		methods[m.Name] = astMethod{Function: m}
+	}
+	return NewClassWithMethods(n, parent, methods, scope)
+}
+
+// NewClassWithMethods creates a class implementing the methods of n by the
+// given methods, keyed by name.
+func NewClassWithMethods(n *ast.ClassDeclaration, parent *Class, methods map[string]Method, scope *DefinitionScope) *Class {
+	scope.retain()
+	return &Class{ClassDeclaration: n, Parent: parent, methods: methods, scope: scope}
+}
+
+func (o *Class) TypeName() string {
+	return "Class"
+}
+
+func (o *Class) IsTrue() bool {
+	return true
+}
+
+func (o *Class) Equals(other Object) (*Boolean, error) {
+	return &Boolean{Value: o == other}, nil
+}
+
+// lookupMethod searches the class and its ancestors for the method name and
+// returns it along with the class defining it.
+func (o *Class) lookupMethod(name string) (Method, *Class) {
+	for c := o; c != nil; c = c.Parent {
+		if m, ok := c.methods[name]; ok {
+			return m, c
+		}
+	}
+	return nil, nil
+}
+
+// bind creates a function calling the method m of class c on self. The
+// function's scope declares self and, if c has a parent class, super.
+func bind(m Method, c *Class, self *Instance) Object {
+	scope := c.scope.child()
+	scope.declare(0, "self", self)
+	if c.Parent != nil {
+		scope.declare(1, "super", &Super{class: c.Parent, self: self})
+	}
+	return m.Bind(scope)
+}
+
+// Instance is an object created by calling a Class. Fields are created by
+// assigning to them and kept in assignment order.
+type Instance struct {
+	Class  *Class
+	fields []string
+	values map[string]Object
+}
+
+// NewInstance creates an instance of class without running its init
+// method.
+func NewInstance(class *Class) *Instance {
+	return &Instance{Class: class, values: make(map[string]Object)}
+}
+
+func (o *Instance) TypeName() string {
+	return o.Class.Name
+}
+
+func (o *Instance) IsTrue() bool {
+	return true
+}
+
+func (o *Instance) Equals(other Object) (*Boolean, error) {
+	return &Boolean{Value: o == other}, nil
+}
+
+// Fields returns the names of the instance's fields in assignment order.
+func (o *Instance) Fields() []string {
+	return o.fields
+}
+
+// Member returns the field name or, if there is no such field, the method
+// name bound to the instance.
+func (o *Instance) Member(name string) (Object, error) {
+	if v, ok := o.values[name]; ok {
+		return v, nil
+	}
+	if m, c := o.Class.lookupMethod(name); m != nil {
+		return bind(m, c, o), nil
+	}
+	return nil, fmt.Errorf("%s has no member %s", o.Class.Name, name)
+}
+
+// Init returns the init method of the instance's class bound to the
+// instance, or nil if the class has none.
+func (o *Instance) Init() Object {
+	if m, c := o.Class.lookupMethod("init"); m != nil {
+		return bind(m, c, o)
+	}
+	return nil
+}
+
+func (o *Instance) SetMember(name string, value Object) error {
+	if _, ok := o.values[name]; !ok {
+		o.fields = append(o.fields, name)
+	}
+	o.values[name] = value
+	return nil
+}
+
+// Super gives methods of a subclass access to the methods of the parent
+// class, bound to the same instance.
+type Super struct {
+	class *Class
+	self  *Instance
+}
+
+func (o *Super) TypeName() string {
+	return "Super"
+}
+
+func (o *Super) IsTrue() bool {
+	return true
+}
+
+func (o *Super) Equals(other Object) (*Boolean, error) {
+	return &Boolean{Value: false}, nil
+}
+
+func (o *Super) Member(name string) (Object, error) {
+	if m, c := o.class.lookupMethod(name); m != nil {
+		return bind(m, c, o.self), nil
+	}
+	return nil, fmt.Errorf("%s has no method %s", o.class.Name, name)
+}
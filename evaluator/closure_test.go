@@ -0,0 +1,152 @@
+package evaluator_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/evaluator"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+	"github.com/niklaskorz/nklang/semantics"
+)
+
+// parse parses and analyzes src.
+func parse(t testing.TB, src string) *ast.Program {
+	p, err := parser.Parse(lexer.NewScanner(strings.NewReader(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := semantics.AnalyzeLookups(p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// run evaluates src and returns the formatted values of its global
+// variables by name.
+func run(t testing.TB, src string) map[string]string {
+	scope := evaluator.NewScope()
+	if err := evaluator.EvaluateWithScope(parse(t, src), scope); err != nil {
+		t.Fatal(err)
+	}
+	vars := make(map[string]string)
+	for _, v := range scope.Variables() {
+		vars[v.Name] = evaluator.FormatObject(v.Value)
+	}
+	return vars
+}
+
+func expectVariables(t *testing.T, vars map[string]string, expected map[string]string) {
+	t.Helper()
+	for name, value := range expected {
+		if vars[name] != value {
+			t.Errorf("Expected %s to be %s, got %s", name, value, vars[name])
+		}
+	}
+}
+
+func TestClosuresCaptureLoopVariablesPerIteration(t *testing.T) {
+	vars := run(t, `
+		fs := [nil, nil, nil];
+		i := 0;
+		while i < 3 {
+			j := i;
+			fs[i] = func() { return j; };
+			i = i + 1;
+		}
+		w0 := fs[0](); w1 := fs[1](); w2 := fs[2]();
+
+		gs := [nil, nil, nil];
+		for k, v in [10, 20, 30] {
+			gs[k] = func() { return k * v; };
+		}
+		f0 := gs[0](); f1 := gs[1](); f2 := gs[2]();
+	`)
+	expectVariables(t, vars, map[string]string{
+		"w0": "0", "w1": "1", "w2": "2",
+		"f0": "0", "f1": "20", "f2": "60",
+	})
+}
+
+func TestClosuresShareCapturedVariables(t *testing.T) {
+	vars := run(t, `
+		counter := func() {
+			n := 0;
+			return [func() { n = n + 1; }, func() { return n; }];
+		};
+		c := counter();
+		c[0]();
+		c[0]();
+		shared := c[1]();
+		other := counter()[1]();
+
+		x := 1;
+		getX := func() { return x; };
+		setX := func(v) { x = v; };
+		x = 2;
+		late := getX();
+		setX(3);
+	`)
+	expectVariables(t, vars, map[string]string{
+		"shared": "2",
+		"other":  "0",
+		"late":   "2",
+		"x":      "3",
+	})
+}
+
+func TestClassesKeepScopesOfLeftBlocks(t *testing.T) {
+	vars := run(t, `
+		cs := [nil, nil, nil];
+		for i, x in [0, 10, 20] {
+			class C {
+				get() { return x + i; }
+			}
+			cs[i] = C;
+		}
+		c0 := cs[0]().get(); c1 := cs[1]().get(); c2 := cs[2]().get();
+
+		f := func(n) {
+			if n > 0 {
+				y := n;
+				g := func() { return y; };
+				return g() + f(n - 1);
+			}
+			return 0;
+		};
+		sum := f(5);
+
+		// Runs at the depth of the loop body whose scope C retained
+		d := 0;
+		if true {
+			unrelated := 100;
+			d = cs[2]().get();
+		}
+	`)
+	expectVariables(t, vars, map[string]string{
+		"c0": "0", "c1": "11", "c2": "22",
+		"sum": "15",
+		"d":   "22",
+	})
+}
+
+const fibSource = `
+fib := func(n) {
+    if n < 2 {
+        return n;
+    }
+    return fib(n - 1) + fib(n - 2);
+};
+result := fib(20);
+`
+
+func BenchmarkFib(b *testing.B) {
+	p := parse(b, fibSource)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := evaluator.Evaluate(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
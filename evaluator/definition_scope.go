@@ -1,44 +1,232 @@
 package evaluator
 
-type definitionMap map[string]Object
+import "github.com/niklaskorz/nklang/ast"
 
+// variable holds the value of a declared name. Its value is nil while the
+// name is not declared.
+type variable struct {
+	name  string
+	value Object
+	// Set from the declaration of the variable until its value is assigned,
+	// while the variable holds the nil object
+	pending bool
+}
+
+// binding holds a variable in a slot of a scope. Once a closure captures
+// the variable, it moves to the heap and is shared with the closure through
+// captured.
+type binding struct {
+	variable
+	captured *variable
+}
+
+func (b *binding) get() *variable {
+	if b.captured != nil {
+		return b.captured
+	}
+	return &b.variable
+}
+
+// DefinitionScope holds the variables of a scope in the slots assigned to
+// them by the semantic analysis. The scopes of blocks and calls are entered
+// into the active scopes of their evaluation at their depth, so the variable
+// index scopes up is found at frames[depth-index].slots[slot]. A scope left
+// is reused by the next scope entered at the same depth. The virtual machine
+// keeps its variables in the same scopes.
 type DefinitionScope struct {
-	parent      *DefinitionScope
-	definitions definitionMap
+	stack *callStack
+	// Position in the active scopes, 0 for scopes without a parent
+	depth int
+	slots []binding
+	// frames is set on retained scopes, which may be used after they have
+	// been left and aren't reused. It holds the scopes visible from the
+	// scope, outermost first.
+	frames []*DefinitionScope
 }
 
 func NewScope() *DefinitionScope {
-	return &DefinitionScope{
-		definitions: make(definitionMap),
+	s := &callStack{}
+	ds := &DefinitionScope{stack: s}
+	s.scopes = append(s.scopes, ds)
+	return ds
+}
+
+// enter makes a scope the active scope at depth, leaving all scopes at the
+// same or a greater depth.
+func (s *callStack) enter(depth int) *DefinitionScope {
+	s.scopes = s.scopes[:depth]
+	for len(s.free) <= depth {
+		s.free = append(s.free, nil)
 	}
+	ds := s.free[depth]
+	if ds == nil || ds.frames != nil {
+		ds = &DefinitionScope{stack: s, depth: depth}
+		s.free[depth] = ds
+	}
+	ds.slots = ds.slots[:0]
+	s.scopes = append(s.scopes, ds)
+	return ds
+}
+
+// NewScope creates a child scope of scope, which must be the innermost
+// active scope of its evaluation.
+func (scope *DefinitionScope) NewScope() *DefinitionScope {
+	return scope.stack.enter(scope.depth + 1)
 }
 
-func (scope *DefinitionScope) newScope() *DefinitionScope {
-	return &DefinitionScope{
-		parent:      scope,
-		definitions: make(definitionMap),
+// CaptureScope creates the scope a function literal closes over, holding
+// only the variables it captures.
+func (scope *DefinitionScope) CaptureScope(captures []ast.Capture) *DefinitionScope {
+	ds := &DefinitionScope{stack: scope.stack, slots: make([]binding, len(captures))}
+	for i, c := range captures {
+		frame := scope.frame(c.ScopeIndex)
+		frame.grow(c.Slot + 1)
+		b := &frame.slots[c.Slot]
+		if b.captured == nil {
+			b.captured = &variable{name: b.name, value: b.value, pending: b.pending}
+		}
+		ds.slots[i].captured = b.captured
 	}
+	return ds
 }
 
-func (scope *DefinitionScope) lookup(name string, index int) Object {
-	if index == 0 {
-		return scope.definitions[name]
+// ParameterScope creates the scope of a call made in scope, declaring the
+// parameters in order. Its parent is captures, the scope holding the
+// variables captured by the called function.
+func (scope *DefinitionScope) ParameterScope(captures *DefinitionScope, parameters []string, args []Object) *DefinitionScope {
+	s := scope.stack
+	s.scopes = append(s.scopes[:scope.depth+1], captures)
+	ds := s.enter(scope.depth + 2)
+	ds.grow(len(args))
+	for i, v := range args {
+		ds.slots[i].variable = variable{name: parameters[i], value: v}
 	}
-	return scope.parent.lookup(name, index-1)
+	return ds
 }
 
-func (scope *DefinitionScope) declare(name string, value Object) {
-	scope.definitions[name] = value
+// retain keeps scope and the scopes visible from it from being reused, so
+// they can be used after they have been left.
+func (scope *DefinitionScope) retain() {
+	if scope.frames != nil {
+		return
+	}
+	outermost := scope.depth
+	for outermost > 0 && scope.stack.scopes[outermost].depth != 0 {
+		outermost--
+	}
+	frames := make([]*DefinitionScope, scope.depth+1-outermost)
+	copy(frames, scope.stack.scopes[outermost:])
+	for i, ds := range frames {
+		if ds.frames == nil {
+			ds.frames = frames[:i+1]
+		}
+	}
+}
+
+// child creates a child scope of the retained scope, which doesn't become
+// an active scope.
+func (scope *DefinitionScope) child() *DefinitionScope {
+	ds := &DefinitionScope{stack: scope.stack, depth: len(scope.frames)}
+	ds.frames = append(scope.frames[:len(scope.frames):len(scope.frames)], ds)
+	return ds
 }
 
+// frame returns the scope index levels up.
+func (scope *DefinitionScope) frame(index int) *DefinitionScope {
+	if scope.frames != nil {
+		return scope.frames[len(scope.frames)-1-index]
+	}
+	return scope.stack.scopes[scope.depth-index]
+}
+
+// grow makes room for n slots in scope.
+func (scope *DefinitionScope) grow(n int) {
+	for len(scope.slots) < n {
+		scope.slots = append(scope.slots, binding{})
+	}
+}
+
+func (scope *DefinitionScope) variable(index, slot int) *variable {
+	frame := scope.frame(index)
+	if slot >= len(frame.slots) {
+		return nil
+	}
+	if v := frame.slots[slot].get(); v.value != nil {
+		return v
+	}
+	return nil
+}
+
+// Lookup returns the value of the variable in slot of the scope index
+// levels up. It reports false if the variable has not been declared, which
+// happens if the statement declaring it wasn't run.
+func (scope *DefinitionScope) Lookup(index, slot int) (Object, bool) {
+	if v := scope.variable(index, slot); v != nil {
+		return v.value, true
+	}
+	return nil, false
+}
+
+// declare declares name in slot of scope. Closures that captured the
+// variable previously held by the slot keep it.
+func (scope *DefinitionScope) declare(slot int, name string, value Object) {
+	scope.grow(slot + 1)
+	scope.slots[slot] = binding{variable: variable{name: name, value: value}}
+}
+
+// declarePending declares name in slot of scope as pending, holding the
+// nil object until its value is assigned.
+func (scope *DefinitionScope) declarePending(slot int, name string) {
+	scope.declare(slot, name, NilObject)
+	scope.slots[slot].pending = true
+}
+
+// set sets the value of the variable in slot of scope itself.
+func (scope *DefinitionScope) set(slot int, value Object) {
+	v := scope.slots[slot].get()
+	v.value = value
+	v.pending = false
+}
+
+// DeclarePending declares name in the given slot like DeclareAt, but as
+// pending until a value is assigned to it. Declared reports false for
+// pending variables.
+func (scope *DefinitionScope) DeclarePending(slot int, name string) {
+	scope.declarePending(slot, name)
+}
+
+// Declared reports whether the variable in slot of scope has been declared
+// and, unless it was declared by DeclareAt or Declare, its value assigned.
+// A declaration that failed to evaluate its value leaves the variable
+// pending.
+func (scope *DefinitionScope) Declared(slot int) bool {
+	if slot >= len(scope.slots) {
+		return false
+	}
+	v := scope.slots[slot].get()
+	return v.value != nil && !v.pending
+}
+
+// DeclareAt declares name in the given slot, replacing the variable
+// previously held by the slot.
+func (scope *DefinitionScope) DeclareAt(slot int, name string, value Object) {
+	scope.declare(slot, name, value)
+}
+
+// Declare declares a predefined name in the next free slot. Predefined
+// names must be declared in the same order as in the semantic analysis.
 func (scope *DefinitionScope) Declare(name string, value Object) {
-	scope.definitions[name] = value
+	scope.declare(len(scope.slots), name, value)
 }
 
-func (scope *DefinitionScope) assign(name string, value Object, index int) {
-	if index == 0 {
-		scope.definitions[name] = value
-		return
+// Assign sets the value of the variable in slot of the scope index levels
+// up. Like Lookup, it reports false if the variable has not been declared.
+func (scope *DefinitionScope) Assign(index, slot int, value Object) bool {
+	v := scope.variable(index, slot)
+	if v == nil {
+		return false
 	}
-	scope.parent.assign(name, value, index-1)
+	v.value = value
+	v.pending = false
+	return true
 }
@@ -0,0 +1,61 @@
+package evaluator_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/niklaskorz/nklang/evaluator"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+	"github.com/niklaskorz/nklang/semantics"
+)
+
+func TestUseOfVariableNotDeclaredAtRuntime(t *testing.T) {
+	ds := semantics.NewScope()
+	scope := evaluator.NewScope()
+	evaluate := func(src string) error {
+		p, err := parser.Parse(lexer.NewScanner(strings.NewReader(src)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := semantics.AnalyzeLookupsWithScope(p, ds); err != nil {
+			t.Fatal(err)
+		}
+		return evaluator.EvaluateWithScope(p, scope)
+	}
+
+	// The declaration of b is analyzed, but never runs
+	if err := evaluate("a := [][0]; b := 2;"); err == nil {
+		t.Fatal("Expected index error")
+	}
+	for _, src := range []string{"b;", "b = 3;", "(func() { return b; })();"} {
+		err := evaluate(src)
+		if err == nil || !strings.Contains(err.Error(), "b has not been declared") {
+			t.Errorf("Expected %q to fail as b has not been declared, got %v", src, err)
+		}
+	}
+}
+
+const facultySource = `
+faculty := func(n) {
+    if n == 0 {
+        return 1;
+    }
+    return n * faculty(n - 1);
+};
+i := 0;
+while i < 1000 {
+    faculty(20);
+    i = i + 1;
+}
+`
+
+func BenchmarkFaculty(b *testing.B) {
+	p := parse(b, facultySource)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := evaluator.Evaluate(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// Error is the object bound by a catch clause for runtime errors, and can be
+// thrown like any other object. Kind classifies the error, e.g. "TypeError"
+// for unsupported operations.
+type Error struct {
+	Message string
+	Kind    string
+	// Position the error occurred at, set when it is thrown if still empty
+	Span ast.Span
+}
+
+func NewError(message, kind string) *Error {
+	return &Error{Message: message, Kind: kind}
+}
+
+// NewRuntimeErrorObject converts a runtime error into a catchable Error.
+func NewRuntimeErrorObject(err *RuntimeError) *Error {
+	return &Error{Message: err.Err.Error(), Kind: errorKind(err.Err), Span: err.Span}
+}
+
+func errorKind(err error) string {
+	switch err.(type) {
+	case *OperationNotSupportedError:
+		return "TypeError"
+	case *IndexOutOfBoundsError:
+		return "IndexError"
+	}
+	return "RuntimeError"
+}
+
+func (o *Error) TypeName() string {
+	return "Error"
+}
+
+func (o *Error) IsTrue() bool {
+	return true
+}
+
+func (o *Error) Equals(other Object) (*Boolean, error) {
+	return &Boolean{Value: o == other}, nil
+}
+
+func (o *Error) Member(name string) (Object, error) {
+	switch name {
+	case "message":
+		return &String{Value: o.Message}, nil
+	case "kind":
+		return &String{Value: o.Kind}, nil
+	case "position":
+		return &String{Value: o.Span.Position()}, nil
+	case "line":
+		return &Integer{Value: int64(o.Span.Line)}, nil
+	case "column":
+		return &Integer{Value: int64(o.Span.Column)}, nil
+	}
+	return nil, fmt.Errorf("Error has no member %s", name)
+}
@@ -1,18 +1,28 @@
 package evaluator
 
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
 type syntaxError struct {
+	span        ast.Span
 	description string
 }
 
-func newSyntaxError(description string) *syntaxError {
-	return &syntaxError{description: description}
+func newSyntaxError(span ast.Span, description string) *syntaxError {
+	return &syntaxError{span: span, description: description}
 }
 
 func (e *syntaxError) Error() string {
-	return e.description
+	return fmt.Sprintf("%s: %s", e.span.Position(), e.description)
 }
 
 type returnError struct {
+	span  ast.Span
 	value Object
 }
 
@@ -20,30 +30,129 @@ func (e *returnError) Error() string {
 	return "Unexpected return statement"
 }
 
-type continueError struct{}
+func (e *returnError) syntaxError() *syntaxError {
+	return newSyntaxError(e.span, e.Error())
+}
+
+type continueError struct {
+	span ast.Span
+}
 
 func (e *continueError) Error() string {
 	return "Unexpected continue statement"
 }
 
 func (e *continueError) syntaxError() *syntaxError {
-	return newSyntaxError(e.Error())
+	return newSyntaxError(e.span, e.Error())
 }
 
-type breakError struct{}
+type breakError struct {
+	span ast.Span
+}
 
 func (e *breakError) Error() string {
 	return "Unexpected break statement"
 }
 
 func (e *breakError) syntaxError() *syntaxError {
-	return newSyntaxError(e.Error())
+	return newSyntaxError(e.span, e.Error())
+}
+
+// ThrowError carries a thrown value up to the closest enclosing try
+// statement, or error handler of the virtual machine.
+type ThrowError struct {
+	Span  ast.Span
+	Value Object
+	// Function calls active when the value was thrown, outermost first
+	Trace []StackFrame
+}
+
+func (e *ThrowError) Error() string {
+	return fmt.Sprintf("Uncaught %s", FormatObject(e.Value))
+}
+
+// RuntimeError converts an uncaught thrown value into a RuntimeError.
+func (e *ThrowError) RuntimeError() *RuntimeError {
+	return &RuntimeError{Span: e.Span, Err: fmt.Errorf("Uncaught %s", FormatObject(e.Value)), Trace: e.Trace}
+}
+
+// undeclaredVariable reports the use of a variable the semantic analysis
+// resolved, but whose declaration hasn't run.
+func undeclaredVariable(name string) error {
+	return fmt.Errorf("%s has not been declared", name)
+}
+
+// IndexOutOfBoundsError reports an access to an index outside of a
+// sequence.
+type IndexOutOfBoundsError struct {
+	Index int64
+}
+
+func (e *IndexOutOfBoundsError) Error() string {
+	return fmt.Sprintf("Index %d out of bounds", e.Index)
+}
+
+// OperationNotSupportedError reports that Operator can't be applied to
+// operands of the given types.
+type OperationNotSupportedError struct {
+	Span     ast.Span
+	Operator string
+	// Type names of the operands
+	Operands []string
+}
+
+func (e *OperationNotSupportedError) Error() string {
+	return fmt.Sprintf("cannot apply '%s' to %s", e.Operator, strings.Join(e.Operands, " and "))
 }
 
-type OperationNotSupportedError struct{}
+func operationNotSupported(operator string, operands ...Object) *OperationNotSupportedError {
+	types := make([]string, len(operands))
+	for i, o := range operands {
+		types[i] = o.TypeName()
+	}
+	return &OperationNotSupportedError{Operator: operator, Operands: types}
+}
 
-func (e OperationNotSupportedError) Error() string {
-	return "Operation not supported"
+// RuntimeError is an error that occurred while evaluating the node at Span.
+type RuntimeError struct {
+	Span ast.Span
+	Err  error
+	// Function calls active when the error occurred, outermost first
+	Trace []StackFrame
 }
 
-var operationNotSupported = OperationNotSupportedError{}
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span.Position(), e.Err)
+}
+
+// Cause returns the underlying error, see github.com/pkg/errors.
+func (e *RuntimeError) Cause() error {
+	return e.Err
+}
+
+// PrintError prints err to w, preceded by a traceback of the nklang
+// function calls that were active if err occurred at runtime.
+func PrintError(w io.Writer, err error) {
+	if err, ok := err.(*RuntimeError); ok && len(err.Trace) > 0 {
+		fmt.Fprintln(w, "Traceback (most recent call last):")
+		caller := "<main>"
+		for _, frame := range err.Trace {
+			fmt.Fprintf(w, "  %s, in %s\n", frame.CallSite.Position(), caller)
+			caller = frame.FunctionName()
+		}
+		fmt.Fprintf(w, "  %s, in %s\n", err.Span.Position(), caller)
+	}
+	fmt.Fprintln(w, err)
+}
+
+// Positioned attaches the position of n to err, unless err is nil, already
+// positioned or used for control flow.
+func Positioned(n ast.Node, err error) error {
+	switch err := err.(type) {
+	case nil, *RuntimeError, *syntaxError, *returnError, *continueError, *breakError, *ThrowError:
+		return err
+	case *OperationNotSupportedError:
+		err.Span = n.Location()
+	}
+	return &RuntimeError{Span: n.Location(), Err: err}
+}
@@ -1,13 +1,15 @@
 package evaluator
 
 import (
+	"fmt"
+
 	"github.com/niklaskorz/nklang/ast"
 )
 
 func evaluateExpression(n ast.Expression, scope *DefinitionScope) (Object, error) {
 	switch e := n.(type) {
 	case *ast.Function:
-		return &Function{Function: e, parentScope: scope}, nil
+		return newFunction(e, scope), nil
 	case *ast.Integer:
 		return (*Integer)(e), nil
 	case *ast.Float:
@@ -16,8 +18,14 @@ func evaluateExpression(n ast.Expression, scope *DefinitionScope) (Object, error
 		return (*String)(e), nil
 	case *ast.Boolean:
 		return (*Boolean)(e), nil
+	case *ast.Nil:
+		return NilObject, nil
+	case *ast.InterpolatedString:
+		return evaluateInterpolatedString(e, scope)
 	case *ast.ArrayExpression:
 		return evaluateArrayExpression(e, scope)
+	case *ast.MapExpression:
+		return evaluateMapExpression(e, scope)
 	case *ast.IfExpression:
 		return evaluateIfExpression(e, scope)
 	case *ast.BinaryOperationExpression:
@@ -30,11 +38,25 @@ func evaluateExpression(n ast.Expression, scope *DefinitionScope) (Object, error
 		return evaluateCallExpression(e, scope)
 	case *ast.SubscriptExpression:
 		return evaluateSubscriptExpression(e, scope)
+	case *ast.MemberExpression:
+		return evaluateMemberExpression(e, scope)
 	}
 
 	return nil, nil
 }
 
+func evaluateInterpolatedString(n *ast.InterpolatedString, scope *DefinitionScope) (Object, error) {
+	str := ""
+	for _, e := range n.Parts {
+		v, err := evaluateExpression(e, scope)
+		if err != nil {
+			return nil, err
+		}
+		str += FormatObject(v)
+	}
+	return &String{Value: str}, nil
+}
+
 func evaluateArrayExpression(n *ast.ArrayExpression, scope *DefinitionScope) (Object, error) {
 	items := []Object{}
 	for _, e := range n.Items {
@@ -47,6 +69,26 @@ func evaluateArrayExpression(n *ast.ArrayExpression, scope *DefinitionScope) (Ob
 	return &Array{Items: items}, nil
 }
 
+func evaluateMapExpression(n *ast.MapExpression, scope *DefinitionScope) (Object, error) {
+	m := NewMap()
+	for _, e := range n.Entries {
+		k, err := evaluateExpression(e.Key, scope)
+		if err != nil {
+			return nil, err
+		}
+		key, err := MapKey(k)
+		if err != nil {
+			return nil, Positioned(e.Key, err)
+		}
+		v, err := evaluateExpression(e.Value, scope)
+		if err != nil {
+			return nil, err
+		}
+		m.Set(key, v)
+	}
+	return m, nil
+}
+
 func evaluateIfExpression(n *ast.IfExpression, scope *DefinitionScope) (Object, error) {
 	if n.Condition == nil {
 		return evaluateExpression(n.Value, scope)
@@ -74,7 +116,13 @@ func evaluateBinaryExpression(n *ast.BinaryOperationExpression, scope *Definitio
 		return nil, err
 	}
 
-	switch n.Operator {
+	v, err := EvaluateBinaryOperation(n.Operator, aValue, bValue)
+	return v, Positioned(n, err)
+}
+
+// EvaluateBinaryOperation applies operator to already evaluated operands.
+func EvaluateBinaryOperation(operator ast.BinaryOperator, aValue, bValue Object) (Object, error) {
+	switch operator {
 	case ast.BinaryOperatorEq:
 		return aValue.Equals(bValue)
 	case ast.BinaryOperatorNe:
@@ -127,7 +175,7 @@ func evaluateBinaryExpression(n *ast.BinaryOperationExpression, scope *Definitio
 		return bValue, nil
 	}
 
-	return nil, operationNotSupported
+	return nil, operationNotSupported(operator.String(), aValue, bValue)
 }
 
 func evaluateUnaryExpression(n *ast.UnaryOperationExpression, scope *DefinitionScope) (Object, error) {
@@ -136,7 +184,13 @@ func evaluateUnaryExpression(n *ast.UnaryOperationExpression, scope *DefinitionS
 		return nil, err
 	}
 
-	switch n.Operator {
+	v, err := EvaluateUnaryOperation(n.Operator, value)
+	return v, Positioned(n, err)
+}
+
+// EvaluateUnaryOperation applies operator to an already evaluated operand.
+func EvaluateUnaryOperation(operator ast.UnaryOperator, value Object) (Object, error) {
+	switch operator {
 	case ast.UnaryOperatorLnot:
 		return &Boolean{Value: !value.IsTrue()}, nil
 	case ast.UnaryOperatorPos:
@@ -149,11 +203,15 @@ func evaluateUnaryExpression(n *ast.UnaryOperationExpression, scope *DefinitionS
 		}
 	}
 
-	return nil, operationNotSupported
+	return nil, operationNotSupported(operator.String(), value)
 }
 
 func evaluateLookupExpression(n *ast.LookupExpression, scope *DefinitionScope) (Object, error) {
-	return scope.lookup(n.Identifier, n.ScopeIndex), nil
+	v, ok := scope.Lookup(n.ScopeIndex, n.Slot)
+	if !ok {
+		return nil, Positioned(n, undeclaredVariable(n.Identifier))
+	}
+	return v, nil
 }
 
 func evaluateCallExpression(n *ast.CallExpression, scope *DefinitionScope) (Object, error) {
@@ -164,26 +222,65 @@ func evaluateCallExpression(n *ast.CallExpression, scope *DefinitionScope) (Obje
 
 	switch callee := callee.(type) {
 	case *Function:
-		return evaluateFunctionCall(callee, n.Parameters, scope)
+		return evaluateFunctionCall(callee, n, scope)
 	case *PredefinedFunction:
-		return evaluatePredefinedFunctionCall(callee, n.Parameters, scope)
+		return evaluatePredefinedFunctionCall(callee, n, scope)
+	case *StructType:
+		return evaluateStructCall(callee, n, scope)
+	case *Class:
+		return evaluateClassCall(callee, n, scope)
 	}
 
-	return nil, OperationNotSupportedError{}
+	return nil, Positioned(n, operationNotSupported("()", callee))
 }
 
-func evaluateFunctionCall(o *Function, params []ast.Expression, scope *DefinitionScope) (Object, error) {
-	parameterScope := o.parentScope.newScope()
+func evaluateFunctionCall(o *Function, n *ast.CallExpression, scope *DefinitionScope) (Object, error) {
+	params := n.Parameters
+	if len(params) != len(o.Parameters) {
+		return nil, Positioned(n, fmt.Errorf("Expected %d arguments, got %d", len(o.Parameters), len(params)))
+	}
+
+	args := make([]Object, len(params))
 	for i, p := range params {
 		v, err := evaluateExpression(p, scope)
 		if err != nil {
 			return nil, err
 		}
-		name := o.Parameters[i]
-		parameterScope.declare(name, v)
+		args[i] = v
 	}
 
-	if err := evaluateStatements(o.Statements, parameterScope.newScope()); err != nil {
+	return callFunction(o, args, n.Location(), scope)
+}
+
+// Call calls the function from outside of the evaluator, such as from the
+// virtual machine. Values thrown and not caught by the function are
+// returned as RuntimeError.
+func (o *Function) Call(params []Object) (Object, error) {
+	if len(params) != len(o.Parameters) {
+		return nil, fmt.Errorf("Expected %d arguments, got %d", len(o.Parameters), len(params))
+	}
+	v, err := callFunction(o, params, o.Location(), NewScope())
+	if err, ok := err.(*ThrowError); ok {
+		return nil, err.RuntimeError()
+	}
+	return v, err
+}
+
+// callFunction calls o from the scope caller. The call stack follows the
+// caller, not the scope the function was defined in.
+func callFunction(o *Function, args []Object, callSite ast.Span, caller *DefinitionScope) (Object, error) {
+	parameterScope := caller.ParameterScope(o.parentScope, o.Parameters, args)
+	stack := caller.stack
+
+	frame := StackFrame{Name: o.Name, CallSite: callSite}
+	stack.push(frame)
+	defer stack.pop()
+	if h := stack.hooks; h != nil {
+		h.Enter(frame)
+		defer h.Leave(frame)
+	}
+
+	if err := evaluateStatements(o.Statements, parameterScope.NewScope()); err != nil {
 		switch err := err.(type) {
 		case *returnError:
 			return err.value, nil
@@ -191,6 +288,11 @@ func evaluateFunctionCall(o *Function, params []ast.Expression, scope *Definitio
 			return nil, err.syntaxError()
 		case *breakError:
 			return nil, err.syntaxError()
+		case *RuntimeError:
+			if err.Trace == nil {
+				err.Trace = stack.snapshot()
+			}
+			return nil, err
 		default:
 			return nil, err
 		}
@@ -199,9 +301,9 @@ func evaluateFunctionCall(o *Function, params []ast.Expression, scope *Definitio
 	return NilObject, nil
 }
 
-func evaluatePredefinedFunctionCall(o *PredefinedFunction, params []ast.Expression, scope *DefinitionScope) (Object, error) {
+func evaluatePredefinedFunctionCall(o *PredefinedFunction, n *ast.CallExpression, scope *DefinitionScope) (Object, error) {
 	parameters := []Object{}
-	for _, p := range params {
+	for _, p := range n.Parameters {
 		v, err := evaluateExpression(p, scope)
 		if err != nil {
 			return nil, err
@@ -209,7 +311,42 @@ func evaluatePredefinedFunctionCall(o *PredefinedFunction, params []ast.Expressi
 		parameters = append(parameters, v)
 	}
 
-	return o.fn(parameters)
+	v, err := o.Call(parameters)
+	return v, Positioned(n, err)
+}
+
+func evaluateStructCall(o *StructType, n *ast.CallExpression, scope *DefinitionScope) (Object, error) {
+	values := []Object{}
+	for _, p := range n.Parameters {
+		v, err := evaluateExpression(p, scope)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	r, err := o.New(values)
+	if err != nil {
+		return nil, Positioned(n, err)
+	}
+	return r, nil
+}
+
+func evaluateClassCall(o *Class, n *ast.CallExpression, scope *DefinitionScope) (Object, error) {
+	instance := NewInstance(o)
+
+	init := instance.Init()
+	if init == nil {
+		if len(n.Parameters) != 0 {
+			return nil, Positioned(n, fmt.Errorf("Expected 0 arguments, got %d", len(n.Parameters)))
+		}
+		return instance, nil
+	}
+
+	if _, err := evaluateFunctionCall(init.(*Function), n, scope); err != nil {
+		return nil, err
+	}
+	return instance, nil
 }
 
 func evaluateSubscriptExpression(n *ast.SubscriptExpression, scope *DefinitionScope) (Object, error) {
@@ -218,9 +355,8 @@ func evaluateSubscriptExpression(n *ast.SubscriptExpression, scope *DefinitionSc
 		return nil, err
 	}
 
-	o, ok := target.(Subscriptable)
-	if !ok {
-		return nil, operationNotSupported
+	if _, ok := target.(Subscriptable); !ok {
+		return nil, Positioned(n, operationNotSupported("[]", target))
 	}
 
 	index, err := evaluateExpression(n.Index, scope)
@@ -228,7 +364,18 @@ func evaluateSubscriptExpression(n *ast.SubscriptExpression, scope *DefinitionSc
 		return nil, err
 	}
 
-	return o.Subscript(index)
+	v, err := Subscript(target, index)
+	return v, Positioned(n, err)
+}
+
+func evaluateMemberExpression(n *ast.MemberExpression, scope *DefinitionScope) (Object, error) {
+	target, err := evaluateExpression(n.Target, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := Member(target, n.Name)
+	return v, Positioned(n, err)
 }
 
 func EvaluateExpression(n ast.Expression, scope *DefinitionScope) (Object, error) {
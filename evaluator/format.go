@@ -0,0 +1,129 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Formattable is implemented by objects of other packages, such as the
+// virtual machine, that render themselves.
+type Formattable interface {
+	FormatObject() string
+}
+
+// FormatObjects renders objects the way println prints them, separated by
+// single spaces.
+func FormatObjects(objects []Object) string {
+	return formatObjects(objects, nil)
+}
+
+func formatObjects(objects []Object, visiting []Object) string {
+	s := ""
+	for i, o := range objects {
+		if i != 0 {
+			s += " "
+		}
+		s += formatObject(o, visiting)
+	}
+	return s
+}
+
+// FormatObject renders a single object the way println prints it.
+func FormatObject(o Object) string {
+	return formatObject(o, nil)
+}
+
+// formatObject renders o inside of the containers being rendered in
+// visiting. A container inside of itself is rendered without its contents,
+// like [...] for arrays.
+func formatObject(o Object, visiting []Object) string {
+	for _, v := range visiting {
+		if v == o {
+			return formatCycle(o)
+		}
+	}
+
+	switch o := o.(type) {
+	case *String:
+		return o.Value
+	case *Integer:
+		return strconv.FormatInt(o.Value, 10)
+	case *Float:
+		return strconv.FormatFloat(o.Value, 'f', -1, 64)
+	case *Boolean:
+		if o.Value {
+			return "true"
+		}
+		return "false"
+	case *Nil:
+		return "nil"
+	case *Array:
+		return "[" + formatObjects(o.Items, append(visiting, o)) + "]"
+	case *Map:
+		visiting = append(visiting, o)
+		s := "{"
+		for i, k := range o.Keys() {
+			if i != 0 {
+				s += ", "
+			}
+			s += formatObject(k, visiting) + ": " + formatObject(o.Values()[i], visiting)
+		}
+		return s + "}"
+	case *StructType:
+		return "struct " + o.Name
+	case *Record:
+		visiting = append(visiting, o)
+		s := o.Type.Name + "{"
+		for i, f := range o.Type.Fields {
+			if i != 0 {
+				s += ", "
+			}
+			s += f + ": " + formatObject(o.Values[i], visiting)
+		}
+		return s + "}"
+	case *Class:
+		return "class " + o.Name
+	case *Instance:
+		visiting = append(visiting, o)
+		s := o.Class.Name + "{"
+		for i, f := range o.Fields() {
+			if i != 0 {
+				s += ", "
+			}
+			v, _ := o.Member(f)
+			s += f + ": " + formatObject(v, visiting)
+		}
+		return s + "}"
+	case *Error:
+		return o.Kind + ": " + o.Message
+	case *Range:
+		return fmt.Sprintf("range(%d, %d, %d)", o.Start, o.End, o.Step)
+	case *Function:
+		s := "func("
+		for j, param := range o.Function.Parameters {
+			if j != 0 {
+				s += ", "
+			}
+			s += param
+		}
+		return s + ")"
+	case *PredefinedFunction:
+		return "[PredefinedFunction]"
+	case Formattable:
+		return o.FormatObject()
+	}
+	return "[Object]"
+}
+
+// formatCycle renders the container o that is already being rendered.
+func formatCycle(o Object) string {
+	switch o := o.(type) {
+	case *Map:
+		return "{...}"
+	case *Record:
+		return o.Type.Name + "{...}"
+	case *Instance:
+		return o.Class.Name + "{...}"
+	}
+	return "[...]"
+}
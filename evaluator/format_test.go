@@ -0,0 +1,28 @@
+package evaluator_test
+
+import "testing"
+
+func TestFormatContainersInsideThemselves(t *testing.T) {
+	vars := run(t, `
+		a := [1];
+		a[0] = a;
+		m := {"k": 1};
+		m["k"] = m;
+		struct Node { next }
+		n := Node(nil);
+		n.next = n;
+		class Box {
+			init() { self.inner = self; }
+		}
+		b := Box();
+		shared := [2];
+		twice := [shared, shared];
+	`)
+	expectVariables(t, vars, map[string]string{
+		"a":     "[[...]]",
+		"m":     "{k: {...}}",
+		"n":     "Node{next: Node{...}}",
+		"b":     "Box{inner: Box{...}}",
+		"twice": "[[2] [2]]",
+	})
+}
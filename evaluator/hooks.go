@@ -0,0 +1,62 @@
+package evaluator
+
+import "github.com/niklaskorz/nklang/ast"
+
+// Hooks observe an evaluation, allowing tools such as debuggers to follow
+// and pause it. The evaluation waits for each hook to return.
+type Hooks interface {
+	// Statement is called before n is evaluated in scope. A returned error
+	// aborts the evaluation with that error.
+	Statement(n ast.Statement, scope *DefinitionScope) error
+	// Enter is called when the function call described by frame starts,
+	// Leave when it has ended.
+	Enter(frame StackFrame)
+	Leave(frame StackFrame)
+}
+
+// SetHooks makes all evaluations in scope and its child scopes report to
+// h. A nil h removes the hooks.
+func (scope *DefinitionScope) SetHooks(h Hooks) {
+	scope.stack.hooks = h
+}
+
+// Variable is a variable of a DefinitionScope.
+type Variable struct {
+	Name  string
+	Value Object
+}
+
+// Variables returns the variables declared in scope so far, ordered by
+// slot. Pending variables, whose value is still being evaluated, are left
+// out.
+func (scope *DefinitionScope) Variables() []Variable {
+	var vars []Variable
+	for i := range scope.slots {
+		if v := scope.slots[i].get(); v.value != nil && !v.pending {
+			vars = append(vars, Variable{Name: v.name, Value: v.value})
+		}
+	}
+	return vars
+}
+
+// Parent returns the scope enclosing scope, or nil for the outermost scope
+// visible from it. Inside of functions, that is the scope holding the
+// variables the function captures.
+func (scope *DefinitionScope) Parent() *DefinitionScope {
+	if scope.frames != nil {
+		if n := len(scope.frames); n > 1 {
+			return scope.frames[n-2]
+		}
+		return nil
+	}
+	if scope.depth == 0 {
+		return nil
+	}
+	return scope.frame(1)
+}
+
+// Frames returns the frames of the function calls active in the evaluation
+// scope belongs to, outermost first.
+func (scope *DefinitionScope) Frames() []StackFrame {
+	return scope.stack.snapshot()
+}
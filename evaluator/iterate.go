@@ -0,0 +1,71 @@
+package evaluator
+
+// Iterable is implemented by objects that can be looped over with for in.
+type Iterable interface {
+	Iterate() Iterator
+}
+
+// Iterator steps through the elements of an Iterable. Next returns the index
+// and value of the next element, ok is false once all elements are visited.
+type Iterator interface {
+	Next() (index Object, value Object, ok bool)
+}
+
+type arrayIterator struct {
+	array *Array
+	i     int
+}
+
+// Iterate visits the items of the array. Items appended while iterating are
+// visited as well.
+func (o *Array) Iterate() Iterator {
+	return &arrayIterator{array: o}
+}
+
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.i >= len(it.array.Items) {
+		return nil, nil, false
+	}
+	i := it.i
+	it.i++
+	return &Integer{Value: int64(i)}, it.array.Items[i], true
+}
+
+type stringIterator struct {
+	runes []rune
+	i     int
+}
+
+// Iterate visits the string rune by rune, indexed by rune position.
+func (o *String) Iterate() Iterator {
+	return &stringIterator{runes: []rune(o.Value)}
+}
+
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.i >= len(it.runes) {
+		return nil, nil, false
+	}
+	i := it.i
+	it.i++
+	return &Integer{Value: int64(i)}, &String{Value: string(it.runes[i])}, true
+}
+
+type mapIterator struct {
+	m *Map
+	i int
+}
+
+// Iterate visits the map in insertion order. The index is the key of each
+// entry, the value its value.
+func (o *Map) Iterate() Iterator {
+	return &mapIterator{m: o}
+}
+
+func (it *mapIterator) Next() (Object, Object, bool) {
+	if it.i >= len(it.m.keys) {
+		return nil, nil, false
+	}
+	i := it.i
+	it.i++
+	return it.m.keys[i], it.m.values[i], true
+}
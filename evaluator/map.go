@@ -0,0 +1,142 @@
+package evaluator
+
+import (
+	"math"
+)
+
+// HashKey identifies the value of a Hashable object. Objects that are equal
+// have the same HashKey.
+type HashKey struct {
+	Type  string
+	Value interface{}
+}
+
+// Hashable is implemented by objects that can be used as map keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (o *String) HashKey() HashKey {
+	return HashKey{Type: "String", Value: o.Value}
+}
+
+func (o *Integer) HashKey() HashKey {
+	return HashKey{Type: "Integer", Value: o.Value}
+}
+
+func (o *Float) HashKey() HashKey {
+	// Integral floats are equal to integers, so they must hash the same
+	if o.Value == math.Trunc(o.Value) && o.Value >= math.MinInt64 && o.Value < math.MaxInt64 {
+		return HashKey{Type: "Integer", Value: int64(o.Value)}
+	}
+	return HashKey{Type: "Float", Value: o.Value}
+}
+
+func (o *Boolean) HashKey() HashKey {
+	return HashKey{Type: "Boolean", Value: o.Value}
+}
+
+func (o *Nil) HashKey() HashKey {
+	return HashKey{Type: "Nil"}
+}
+
+// Map associates Hashable keys with arbitrary values. Keys are kept in
+// insertion order.
+type Map struct {
+	keys    []Object
+	values  []Object
+	indices map[HashKey]int
+}
+
+func NewMap() *Map {
+	return &Map{indices: make(map[HashKey]int)}
+}
+
+func (o *Map) TypeName() string {
+	return "Map"
+}
+
+func (o *Map) IsTrue() bool {
+	return len(o.keys) > 0
+}
+
+func (o *Map) Equals(other Object) (*Boolean, error) {
+	switch other := other.(type) {
+	case *Map:
+		if len(o.keys) != len(other.keys) {
+			return &Boolean{Value: false}, nil
+		}
+		for i, k := range o.keys {
+			v, ok := other.Get(k.(Hashable))
+			if !ok {
+				return &Boolean{Value: false}, nil
+			}
+			eq, err := o.values[i].Equals(v)
+			if err != nil {
+				return nil, err
+			}
+			if !eq.Value {
+				return eq, nil
+			}
+		}
+		return &Boolean{Value: true}, nil
+	}
+	return &Boolean{Value: false}, nil
+}
+
+// Subscript returns the value stored for other, or nil if there is none.
+func (o *Map) Subscript(other Object) (Object, error) {
+	k, ok := other.(Hashable)
+	if !ok {
+		return nil, operationNotSupported("[]", o, other)
+	}
+	if v, ok := o.Get(k); ok {
+		return v, nil
+	}
+	return NilObject, nil
+}
+
+func (o *Map) SetSubscript(index Object, value Object) error {
+	k, ok := index.(Hashable)
+	if !ok {
+		return operationNotSupported("[]=", o, index)
+	}
+	o.Set(k, value)
+	return nil
+}
+
+// Len returns the number of entries.
+func (o *Map) Len() int {
+	return len(o.keys)
+}
+
+// Keys returns the keys in insertion order.
+func (o *Map) Keys() []Object {
+	return o.keys
+}
+
+// Values returns the values in the order of their keys.
+func (o *Map) Values() []Object {
+	return o.values
+}
+
+// Get returns the value stored for key and whether there is one.
+func (o *Map) Get(key Hashable) (Object, bool) {
+	i, ok := o.indices[key.HashKey()]
+	if !ok {
+		return nil, false
+	}
+	return o.values[i], true
+}
+
+// Set stores value for key, replacing any previous value.
+func (o *Map) Set(key Hashable, value Object) {
+	h := key.HashKey()
+	if i, ok := o.indices[h]; ok {
+		o.values[i] = value
+		return
+	}
+	o.indices[h] = len(o.keys)
+	o.keys = append(o.keys, key.(Object))
+	o.values = append(o.values, value)
+}
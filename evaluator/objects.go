@@ -7,6 +7,8 @@ import (
 )
 
 type Object interface {
+	// TypeName returns the name of the object's type as shown in error messages
+	TypeName() string
 	IsTrue() bool
 	Equals(other Object) (*Boolean, error)
 }
@@ -46,10 +48,18 @@ type Subscriptable interface {
 	Subscript(other Object) (Object, error)
 }
 
+type SubscriptAssignable interface {
+	SetSubscript(index Object, value Object) error
+}
+
 type Array struct {
 	Items []Object
 }
 
+func (o *Array) TypeName() string {
+	return "Array"
+}
+
 func (o *Array) IsTrue() bool {
 	return len(o.Items) > 0
 }
@@ -79,15 +89,36 @@ func (o *Array) Subscript(other Object) (Object, error) {
 			i = l + i
 		}
 		if i < 0 || i >= l {
-			return nil, fmt.Errorf("Index %d out of bounds", other.Value)
+			return nil, &IndexOutOfBoundsError{Index: other.Value}
 		}
 		return o.Items[i], nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("[]", o, other)
+}
+
+func (o *Array) SetSubscript(index Object, value Object) error {
+	switch index := index.(type) {
+	case *Integer:
+		i := index.Value
+		l := int64(len(o.Items))
+		if i < 0 {
+			i = l + i
+		}
+		if i < 0 || i >= l {
+			return &IndexOutOfBoundsError{Index: index.Value}
+		}
+		o.Items[i] = value
+		return nil
+	}
+	return operationNotSupported("[]=", o, index)
 }
 
 type String ast.String
 
+func (o *String) TypeName() string {
+	return "String"
+}
+
 func (o *String) IsTrue() bool {
 	return o.Value != ""
 }
@@ -105,7 +136,7 @@ func (o *String) Add(other Object) (Object, error) {
 	case *String:
 		return &String{Value: o.Value + other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("+", o, other)
 }
 
 func (o *String) Subscript(other Object) (Object, error) {
@@ -117,15 +148,19 @@ func (o *String) Subscript(other Object) (Object, error) {
 			i = l + i
 		}
 		if i < 0 || i >= l {
-			return nil, fmt.Errorf("Index %d out of bounds", other.Value)
+			return nil, &IndexOutOfBoundsError{Index: other.Value}
 		}
 		return &String{Value: string(o.Value[i])}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("[]", o, other)
 }
 
 type Integer ast.Integer
 
+func (o *Integer) TypeName() string {
+	return "Integer"
+}
+
 func (o *Integer) IsTrue() bool {
 	return o.Value != 0
 }
@@ -147,7 +182,7 @@ func (o *Integer) Lt(other Object) (*Boolean, error) {
 	case *Float:
 		return &Boolean{Value: float64(o.Value) < other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("<", o, other)
 }
 
 func (o *Integer) Lte(other Object) (*Boolean, error) {
@@ -157,7 +192,7 @@ func (o *Integer) Lte(other Object) (*Boolean, error) {
 	case *Float:
 		return &Boolean{Value: float64(o.Value) <= other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("<=", o, other)
 }
 
 func (o *Integer) Gt(other Object) (*Boolean, error) {
@@ -167,7 +202,7 @@ func (o *Integer) Gt(other Object) (*Boolean, error) {
 	case *Float:
 		return &Boolean{Value: float64(o.Value) > other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported(">", o, other)
 }
 
 func (o *Integer) Gte(other Object) (*Boolean, error) {
@@ -177,7 +212,7 @@ func (o *Integer) Gte(other Object) (*Boolean, error) {
 	case *Float:
 		return &Boolean{Value: float64(o.Value) >= other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported(">=", o, other)
 }
 
 func (o *Integer) Add(other Object) (Object, error) {
@@ -187,7 +222,7 @@ func (o *Integer) Add(other Object) (Object, error) {
 	case *Float:
 		return &Float{Value: float64(o.Value) + other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("+", o, other)
 }
 
 func (o *Integer) Sub(other Object) (Object, error) {
@@ -197,7 +232,7 @@ func (o *Integer) Sub(other Object) (Object, error) {
 	case *Float:
 		return &Float{Value: float64(o.Value) - other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("-", o, other)
 }
 
 func (o *Integer) Mul(other Object) (Object, error) {
@@ -207,17 +242,20 @@ func (o *Integer) Mul(other Object) (Object, error) {
 	case *Float:
 		return &Float{Value: float64(o.Value) * other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("*", o, other)
 }
 
 func (o *Integer) Div(other Object) (Object, error) {
 	switch other := other.(type) {
 	case *Integer:
+		if other.Value == 0 {
+			return nil, fmt.Errorf("Division by zero")
+		}
 		return &Integer{Value: o.Value / other.Value}, nil
 	case *Float:
 		return &Float{Value: float64(o.Value) / other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("/", o, other)
 }
 
 func (o *Integer) Pos() (Object, error) {
@@ -230,6 +268,10 @@ func (o *Integer) Neg() (Object, error) {
 
 type Float ast.Float
 
+func (o *Float) TypeName() string {
+	return "Float"
+}
+
 func (o *Float) IsTrue() bool {
 	return o.Value != 0
 }
@@ -251,7 +293,7 @@ func (o *Float) Lt(other Object) (*Boolean, error) {
 	case *Float:
 		return &Boolean{Value: o.Value < other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("<", o, other)
 }
 
 func (o *Float) Lte(other Object) (*Boolean, error) {
@@ -261,7 +303,7 @@ func (o *Float) Lte(other Object) (*Boolean, error) {
 	case *Float:
 		return &Boolean{Value: o.Value <= other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("<=", o, other)
 }
 
 func (o *Float) Gt(other Object) (*Boolean, error) {
@@ -271,7 +313,7 @@ func (o *Float) Gt(other Object) (*Boolean, error) {
 	case *Float:
 		return &Boolean{Value: o.Value > other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported(">", o, other)
 }
 
 func (o *Float) Gte(other Object) (*Boolean, error) {
@@ -281,7 +323,7 @@ func (o *Float) Gte(other Object) (*Boolean, error) {
 	case *Float:
 		return &Boolean{Value: o.Value >= other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported(">=", o, other)
 }
 
 func (o *Float) Add(other Object) (Object, error) {
@@ -291,7 +333,7 @@ func (o *Float) Add(other Object) (Object, error) {
 	case *Float:
 		return &Float{Value: o.Value + other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("+", o, other)
 }
 
 func (o *Float) Sub(other Object) (Object, error) {
@@ -301,7 +343,7 @@ func (o *Float) Sub(other Object) (Object, error) {
 	case *Float:
 		return &Float{Value: o.Value - other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("-", o, other)
 }
 
 func (o *Float) Mul(other Object) (Object, error) {
@@ -311,7 +353,7 @@ func (o *Float) Mul(other Object) (Object, error) {
 	case *Float:
 		return &Float{Value: o.Value * other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("*", o, other)
 }
 
 func (o *Float) Div(other Object) (Object, error) {
@@ -321,7 +363,7 @@ func (o *Float) Div(other Object) (Object, error) {
 	case *Float:
 		return &Float{Value: o.Value / other.Value}, nil
 	}
-	return nil, operationNotSupported
+	return nil, operationNotSupported("/", o, other)
 }
 
 func (o *Float) Pos() (Object, error) {
@@ -334,6 +376,10 @@ func (o *Float) Neg() (Object, error) {
 
 type Boolean ast.Boolean
 
+func (o *Boolean) TypeName() string {
+	return "Boolean"
+}
+
 func (o *Boolean) IsTrue() bool {
 	return o.Value
 }
@@ -350,6 +396,10 @@ type Nil ast.Nil
 
 var NilObject = &Nil{}
 
+func (o *Nil) TypeName() string {
+	return "Nil"
+}
+
 func (o *Nil) IsTrue() bool {
 	return false
 }
@@ -362,11 +412,21 @@ func (o *Nil) Equals(other Object) (*Boolean, error) {
 	return &Boolean{Value: false}, nil
 }
 
+// Function is a closure over the variables captured by its function
+// literal.
 type Function struct {
 	*ast.Function
 	parentScope *DefinitionScope
 }
 
+func newFunction(n *ast.Function, scope *DefinitionScope) *Function {
+	return &Function{Function: n, parentScope: scope.CaptureScope(n.Captures)}
+}
+
+func (o *Function) TypeName() string {
+	return "Function"
+}
+
 func (o *Function) IsTrue() bool {
 	return true
 }
@@ -383,6 +443,15 @@ func WrapFunction(fn func(params []Object) (Object, error)) *PredefinedFunction
 	return &PredefinedFunction{fn: fn}
 }
 
+// Call calls the wrapped Go function.
+func (o *PredefinedFunction) Call(params []Object) (Object, error) {
+	return o.fn(params)
+}
+
+func (o *PredefinedFunction) TypeName() string {
+	return "Function"
+}
+
 func (o *PredefinedFunction) IsTrue() bool {
 	return true
 }
@@ -0,0 +1,57 @@
+package evaluator
+
+import "fmt"
+
+// Subscript returns target[index].
+func Subscript(target, index Object) (Object, error) {
+	o, ok := target.(Subscriptable)
+	if !ok {
+		return nil, operationNotSupported("[]", target)
+	}
+	return o.Subscript(index)
+}
+
+// SetSubscript assigns value to target[index].
+func SetSubscript(target, index, value Object) error {
+	o, ok := target.(SubscriptAssignable)
+	if !ok {
+		return operationNotSupported("[]=", target, index)
+	}
+	return o.SetSubscript(index, value)
+}
+
+// Member returns the member name of target.
+func Member(target Object, name string) (Object, error) {
+	o, ok := target.(MemberAccessible)
+	if !ok {
+		return nil, operationNotSupported("."+name, target)
+	}
+	return o.Member(name)
+}
+
+// SetMember assigns value to the member name of target.
+func SetMember(target Object, name string, value Object) error {
+	o, ok := target.(MemberAssignable)
+	if !ok {
+		return operationNotSupported("."+name+"=", target)
+	}
+	return o.SetMember(name, value)
+}
+
+// Iterate returns an iterator over o for use in a for in loop.
+func Iterate(o Object) (Iterator, error) {
+	v, ok := o.(Iterable)
+	if !ok {
+		return nil, operationNotSupported("for in", o)
+	}
+	return v.Iterate(), nil
+}
+
+// MapKey returns o as key for a map literal.
+func MapKey(o Object) (Hashable, error) {
+	k, ok := o.(Hashable)
+	if !ok {
+		return nil, fmt.Errorf("%s can't be used as map key", o.TypeName())
+	}
+	return k, nil
+}
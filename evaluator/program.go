@@ -7,5 +7,19 @@ func Evaluate(p *ast.Program) error {
 }
 
 func EvaluateWithScope(p *ast.Program, scope *DefinitionScope) error {
-	return evaluateStatements(p.Statements, scope)
+	if err := evaluateStatements(p.Statements, scope); err != nil {
+		switch err := err.(type) {
+		case *returnError:
+			return err.syntaxError()
+		case *continueError:
+			return err.syntaxError()
+		case *breakError:
+			return err.syntaxError()
+		case *ThrowError:
+			return err.RuntimeError()
+		default:
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,80 @@
+package evaluator
+
+import (
+	"fmt"
+)
+
+// Range is a lazy sequence of integers from Start up to, but not including,
+// End, advancing by Step.
+type Range struct {
+	Start, End, Step int64
+}
+
+// NewRange creates a range, Step must not be zero.
+func NewRange(start, end, step int64) (*Range, error) {
+	if step == 0 {
+		return nil, fmt.Errorf("Range step must not be zero")
+	}
+	return &Range{Start: start, End: end, Step: step}, nil
+}
+
+// Len returns the number of integers in the range.
+func (o *Range) Len() int64 {
+	if o.Step > 0 && o.Start < o.End {
+		return (o.End - o.Start + o.Step - 1) / o.Step
+	}
+	if o.Step < 0 && o.Start > o.End {
+		return (o.Start - o.End - o.Step - 1) / -o.Step
+	}
+	return 0
+}
+
+func (o *Range) TypeName() string {
+	return "Range"
+}
+
+func (o *Range) IsTrue() bool {
+	return o.Len() > 0
+}
+
+func (o *Range) Equals(other Object) (*Boolean, error) {
+	switch other := other.(type) {
+	case *Range:
+		return &Boolean{Value: *o == *other}, nil
+	}
+	return &Boolean{Value: false}, nil
+}
+
+func (o *Range) Subscript(other Object) (Object, error) {
+	switch other := other.(type) {
+	case *Integer:
+		i := other.Value
+		l := o.Len()
+		if i < 0 {
+			i = l + i
+		}
+		if i < 0 || i >= l {
+			return nil, &IndexOutOfBoundsError{Index: other.Value}
+		}
+		return &Integer{Value: o.Start + i*o.Step}, nil
+	}
+	return nil, operationNotSupported("[]", o, other)
+}
+
+type rangeIterator struct {
+	r *Range
+	i int64
+}
+
+func (o *Range) Iterate() Iterator {
+	return &rangeIterator{r: o}
+}
+
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	if it.i >= it.r.Len() {
+		return nil, nil, false
+	}
+	i := it.i
+	it.i++
+	return &Integer{Value: i}, &Integer{Value: it.r.Start + i*it.r.Step}, true
+}
@@ -0,0 +1,46 @@
+package evaluator
+
+import "github.com/niklaskorz/nklang/ast"
+
+// StackFrame describes an active call of an nklang function.
+type StackFrame struct {
+	// Name the function was declared with, empty for anonymous functions
+	Name string
+	// Position of the call expression that created the frame
+	CallSite ast.Span
+}
+
+// FunctionName returns the name of the called function or "<anonymous>".
+func (f StackFrame) FunctionName() string {
+	if f.Name == "" {
+		return "<anonymous>"
+	}
+	return f.Name
+}
+
+// callStack is shared by all scopes of one evaluation and holds the frames
+// of the functions currently being called, outermost first, as well as the
+// hooks observing the evaluation.
+type callStack struct {
+	frames []StackFrame
+	hooks  Hooks
+	// scopes are the active scopes, outermost first. Inside of a call, they
+	// continue with the scope of the captured variables of the function.
+	scopes []*DefinitionScope
+	// free holds the scope left last at each depth, unless it is retained
+	free []*DefinitionScope
+}
+
+func (s *callStack) push(f StackFrame) {
+	s.frames = append(s.frames, f)
+}
+
+func (s *callStack) pop() {
+	s.frames = s.frames[:len(s.frames)-1]
+}
+
+func (s *callStack) snapshot() []StackFrame {
+	frames := make([]StackFrame, len(s.frames))
+	copy(frames, s.frames)
+	return frames
+}
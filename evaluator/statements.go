@@ -1,6 +1,8 @@
 package evaluator
 
 import (
+	"fmt"
+
 	"github.com/niklaskorz/nklang/ast"
 )
 
@@ -14,19 +16,39 @@ func evaluateStatements(statements []ast.Statement, scope *DefinitionScope) erro
 }
 
 func evaluateStatement(n ast.Statement, scope *DefinitionScope) error {
+	if h := scope.stack.hooks; h != nil {
+		if err := h.Statement(n, scope); err != nil {
+			return err
+		}
+	}
+
 	switch s := n.(type) {
 	case *ast.IfStatement:
 		return evaluateIfStatement(s, scope)
 	case *ast.WhileStatement:
 		return evaluateWhileStatement(s, scope)
+	case *ast.ForStatement:
+		return evaluateForStatement(s, scope)
 	case *ast.ExpressionStatement:
 		return evaluateExpressionStatement(s, scope)
 	case *ast.DeclarationStatement:
 		return evaluateDeclarationStatement(s, scope)
 	case *ast.AssignmentStatement:
 		return evaluateAssignmentStatement(s, scope)
+	case *ast.SubscriptAssignmentStatement:
+		return evaluateSubscriptAssignmentStatement(s, scope)
+	case *ast.MemberAssignmentStatement:
+		return evaluateMemberAssignmentStatement(s, scope)
+	case *ast.StructDeclaration:
+		return evaluateStructDeclaration(s, scope)
+	case *ast.ClassDeclaration:
+		return evaluateClassDeclaration(s, scope)
+	case *ast.TryStatement:
+		return evaluateTryStatement(s, scope)
 	case *ast.ReturnStatement:
 		return evaluateReturnStatement(s, scope)
+	case *ast.ThrowStatement:
+		return evaluateThrowStatement(s, scope)
 	case *ast.ContinueStatement:
 		return evaluateContinueStatement(s, scope)
 	case *ast.BreakStatement:
@@ -37,7 +59,7 @@ func evaluateStatement(n ast.Statement, scope *DefinitionScope) error {
 
 func evaluateIfStatement(n *ast.IfStatement, scope *DefinitionScope) error {
 	if n.Condition == nil {
-		return evaluateStatements(n.Statements, scope.newScope())
+		return evaluateStatements(n.Statements, scope.NewScope())
 	}
 
 	c, err := evaluateExpression(n.Condition, scope)
@@ -45,7 +67,7 @@ func evaluateIfStatement(n *ast.IfStatement, scope *DefinitionScope) error {
 		return err
 	}
 	if c.IsTrue() {
-		return evaluateStatements(n.Statements, scope.newScope())
+		return evaluateStatements(n.Statements, scope.NewScope())
 	}
 	if n.ElseBranch != nil {
 		return evaluateIfStatement(n.ElseBranch, scope)
@@ -63,7 +85,42 @@ func evaluateWhileStatement(n *ast.WhileStatement, scope *DefinitionScope) error
 			return nil
 		}
 
-		if err := evaluateStatements(n.Statements, scope.newScope()); err != nil {
+		if err := evaluateStatements(n.Statements, scope.NewScope()); err != nil {
+			switch err := err.(type) {
+			case *continueError:
+				continue
+			case *breakError:
+				return nil
+			default:
+				return err
+			}
+		}
+	}
+}
+
+func evaluateForStatement(n *ast.ForStatement, scope *DefinitionScope) error {
+	v, err := evaluateExpression(n.Iterable, scope)
+	if err != nil {
+		return err
+	}
+	it, err := Iterate(v)
+	if err != nil {
+		return Positioned(n.Iterable, err)
+	}
+
+	for {
+		index, value, ok := it.Next()
+		if !ok {
+			return nil
+		}
+
+		ds := scope.NewScope()
+		if n.IndexIdentifier != "" {
+			ds.declare(n.IndexSlot, n.IndexIdentifier, index)
+		}
+		ds.declare(n.ValueSlot, n.ValueIdentifier, value)
+
+		if err := evaluateStatements(n.Statements, ds); err != nil {
 			switch err := err.(type) {
 			case *continueError:
 				continue
@@ -82,11 +139,15 @@ func evaluateExpressionStatement(n *ast.ExpressionStatement, scope *DefinitionSc
 }
 
 func evaluateDeclarationStatement(n *ast.DeclarationStatement, scope *DefinitionScope) error {
+	// The variable is declared before its value is evaluated, so recursive
+	// functions can capture themselves. It stays pending until the value is
+	// assigned.
+	scope.declarePending(n.Slot, n.Identifier)
 	value, err := evaluateExpression(n.Value, scope)
 	if err != nil {
 		return err
 	}
-	scope.declare(n.Identifier, value)
+	scope.set(n.Slot, value)
 	return nil
 }
 
@@ -95,22 +156,115 @@ func evaluateAssignmentStatement(n *ast.AssignmentStatement, scope *DefinitionSc
 	if err != nil {
 		return err
 	}
-	scope.assign(n.Identifier, value, n.ScopeIndex)
+	if !scope.Assign(n.ScopeIndex, n.Slot, value) {
+		return Positioned(n, undeclaredVariable(n.Identifier))
+	}
+	return nil
+}
+
+func evaluateSubscriptAssignmentStatement(n *ast.SubscriptAssignmentStatement, scope *DefinitionScope) error {
+	target, err := evaluateExpression(n.Target, scope)
+	if err != nil {
+		return err
+	}
+
+	index, err := evaluateExpression(n.Index, scope)
+	if err != nil {
+		return err
+	}
+
+	value, err := evaluateExpression(n.Value, scope)
+	if err != nil {
+		return err
+	}
+
+	return Positioned(n, SetSubscript(target, index, value))
+}
+
+func evaluateMemberAssignmentStatement(n *ast.MemberAssignmentStatement, scope *DefinitionScope) error {
+	target, err := evaluateExpression(n.Target, scope)
+	if err != nil {
+		return err
+	}
+
+	value, err := evaluateExpression(n.Value, scope)
+	if err != nil {
+		return err
+	}
+
+	return Positioned(n, SetMember(target, n.Name, value))
+}
+
+func evaluateStructDeclaration(n *ast.StructDeclaration, scope *DefinitionScope) error {
+	scope.declare(n.Slot, n.Name, NewStructType(n))
 	return nil
 }
 
+func evaluateClassDeclaration(n *ast.ClassDeclaration, scope *DefinitionScope) error {
+	var parent *Class
+	if n.Superclass != nil {
+		v, err := evaluateExpression(n.Superclass, scope)
+		if err != nil {
+			return err
+		}
+		c, ok := v.(*Class)
+		if !ok {
+			return Positioned(n.Superclass, fmt.Errorf("Can't inherit from %s", v.TypeName()))
+		}
+		parent = c
+	}
+	scope.declare(n.Slot, n.Name, NewClass(n, parent, scope))
+	return nil
+}
+
+func evaluateTryStatement(n *ast.TryStatement, scope *DefinitionScope) error {
+	err := evaluateStatements(n.Statements, scope.NewScope())
+	if n.Catch != nil {
+		var caught Object
+		switch e := err.(type) {
+		case *ThrowError:
+			caught = e.Value
+		case *RuntimeError:
+			caught = NewRuntimeErrorObject(e)
+		}
+		if caught != nil {
+			ds := scope.NewScope()
+			ds.declare(n.Catch.Slot, n.Catch.Identifier, caught)
+			err = evaluateStatements(n.Catch.Statements, ds)
+		}
+	}
+	if n.Finally != nil {
+		// Errors and control flow leaving the finally block take precedence
+		if ferr := evaluateStatements(n.Finally, scope.NewScope()); ferr != nil {
+			return ferr
+		}
+	}
+	return err
+}
+
 func evaluateReturnStatement(n *ast.ReturnStatement, scope *DefinitionScope) error {
 	value, err := evaluateExpression(n.Expression, scope)
 	if err != nil {
 		return err
 	}
-	return &returnError{value: value}
+	return &returnError{span: n.Location(), value: value}
+}
+
+func evaluateThrowStatement(n *ast.ThrowStatement, scope *DefinitionScope) error {
+	value, err := evaluateExpression(n.Expression, scope)
+	if err != nil {
+		return err
+	}
+	if e, ok := value.(*Error); ok && e.Span == (ast.Span{}) {
+		e.Span = n.Location()
+	}
+	return &ThrowError{Span: n.Location(), Value: value, Trace: scope.stack.snapshot()}
 }
 
 func evaluateContinueStatement(n *ast.ContinueStatement, scope *DefinitionScope) error {
-	return &continueError{}
+	return &continueError{span: n.Location()}
 }
 
 func evaluateBreakStatement(n *ast.BreakStatement, scope *DefinitionScope) error {
-	return &breakError{}
+	return &breakError{span: n.Location()}
 }
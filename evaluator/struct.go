@@ -0,0 +1,106 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// MemberAccessible is implemented by objects with members accessible
+// through the dot operator.
+type MemberAccessible interface {
+	Member(name string) (Object, error)
+}
+
+// MemberAssignable is implemented by objects with members that can be
+// assigned through the dot operator.
+type MemberAssignable interface {
+	SetMember(name string, value Object) error
+}
+
+// StructType is the type created by a struct declaration. Calling it
+// creates a Record with the arguments as field values.
+type StructType struct {
+	*ast.StructDeclaration
+	fieldIndices map[string]int
+}
+
+func NewStructType(n *ast.StructDeclaration) *StructType {
+	t := &StructType{StructDeclaration: n, fieldIndices: make(map[string]int)}
+	for i, f := range n.Fields {
+		t.fieldIndices[f] = i
+	}
+	return t
+}
+
+func (o *StructType) TypeName() string {
+	return "Struct"
+}
+
+func (o *StructType) IsTrue() bool {
+	return true
+}
+
+func (o *StructType) Equals(other Object) (*Boolean, error) {
+	return &Boolean{Value: o == other}, nil
+}
+
+// New creates a record of this type with the given field values.
+func (o *StructType) New(values []Object) (*Record, error) {
+	if len(values) != len(o.Fields) {
+		return nil, fmt.Errorf("Expected %d arguments, got %d", len(o.Fields), len(values))
+	}
+	return &Record{Type: o, Values: values}, nil
+}
+
+// Record is an instance of a StructType. Values holds the field values in
+// the order the fields are declared in.
+type Record struct {
+	Type   *StructType
+	Values []Object
+}
+
+func (o *Record) TypeName() string {
+	return o.Type.Name
+}
+
+func (o *Record) IsTrue() bool {
+	return true
+}
+
+func (o *Record) Equals(other Object) (*Boolean, error) {
+	switch other := other.(type) {
+	case *Record:
+		if o.Type != other.Type {
+			return &Boolean{Value: false}, nil
+		}
+		for i, v := range o.Values {
+			eq, err := v.Equals(other.Values[i])
+			if err != nil {
+				return nil, err
+			}
+			if !eq.Value {
+				return eq, nil
+			}
+		}
+		return &Boolean{Value: true}, nil
+	}
+	return &Boolean{Value: false}, nil
+}
+
+func (o *Record) Member(name string) (Object, error) {
+	i, ok := o.Type.fieldIndices[name]
+	if !ok {
+		return nil, fmt.Errorf("%s has no member %s", o.Type.Name, name)
+	}
+	return o.Values[i], nil
+}
+
+func (o *Record) SetMember(name string, value Object) error {
+	i, ok := o.Type.fieldIndices[name]
+	if !ok {
+		return fmt.Errorf("%s has no member %s", o.Type.Name, name)
+	}
+	o.Values[i] = value
+	return nil
+}
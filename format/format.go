@@ -0,0 +1,59 @@
+// Package format prints nklang programs as canonical source code: statements
+// are indented by four spaces, binary operators are surrounded by spaces and
+// every block starts a new line. Comments and single blank lines between
+// statements are kept.
+package format
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+)
+
+// Source formats the program src. It returns an error if src can't be
+// parsed.
+func Source(src []byte) ([]byte, error) {
+	p, err := parser.Parse(lexer.NewScanner(bytes.NewReader(src)))
+	if err != nil {
+		return nil, err
+	}
+
+	s := lexer.NewScanner(bytes.NewReader(src))
+	s.KeepComments = true
+	pr := &printer{positions: make(map[position]int)}
+	lines := strings.Split(string(src), "\n")
+	for {
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		t := *s.Token
+		if t.Type == lexer.EOF {
+			break
+		}
+		if t.Type == lexer.Comment {
+			pr.comments = append(pr.comments, t)
+			continue
+		}
+		if t.Type == lexer.String && isRaw(lines, t) {
+			t.Value = "`" + t.Value + "`"
+			t.Type = rawString
+		}
+		pr.positions[position{t.Line, t.Column}] = len(pr.tokens)
+		pr.tokens = append(pr.tokens, t)
+	}
+
+	pr.program(p)
+	return []byte(pr.b.String()), nil
+}
+
+// rawString marks String tokens written with backticks. Their value is the
+// literal as written.
+const rawString lexer.TokenType = -1
+
+// isRaw reports whether the string literal t is delimited by backticks.
+func isRaw(lines []string, t lexer.Token) bool {
+	line := []rune(lines[t.Line-1])
+	return t.Column <= len(line) && line[t.Column-1] == '`'
+}
@@ -0,0 +1,24 @@
+package format
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestSourceIsIdempotent(t *testing.T) {
+	src, err := ioutil.ReadFile("../example.nk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	once, err := Source(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, err := Source(once)
+	if err != nil {
+		t.Fatalf("Formatted source can't be parsed: %v\n%s", err, once)
+	}
+	if string(twice) != string(once) {
+		t.Errorf("Formatting the formatted source changed it\nonce:\n%s\ntwice:\n%s", once, twice)
+	}
+}
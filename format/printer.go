@@ -0,0 +1,589 @@
+package format
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/lexer"
+)
+
+const indentation = "    "
+
+// position is a line and column in the formatted source.
+type position struct {
+	line, column int
+}
+
+func (p position) before(other position) bool {
+	return p.line < other.line || p.line == other.line && p.column < other.column
+}
+
+// eof is a position after the end of every source.
+var eof = position{line: int(^uint(0) >> 1)}
+
+func start(n ast.Node) position {
+	s := n.Location()
+	return position{s.Line, s.Column}
+}
+
+func end(n ast.Node) position {
+	s := n.Location()
+	return position{s.EndLine, s.EndColumn}
+}
+
+// after returns the position following the end of n.
+func after(n ast.Node) position {
+	s := n.Location()
+	return position{s.EndLine, s.EndColumn + 1}
+}
+
+// Precedence levels of expressions, from loosest to tightest binding.
+// Operands binding looser than required are parenthesized.
+const (
+	precedenceExpression = iota
+	precedenceOr
+	precedenceAnd
+	precedenceComparison
+	precedenceTerm
+	precedenceAddend
+	precedenceUnary
+	precedencePostfix
+	precedenceValue
+)
+
+type printer struct {
+	b      strings.Builder
+	indent int
+	// Tokens of the source except comments, in order, and the index of the
+	// token starting at each position
+	tokens    []lexer.Token
+	positions map[position]int
+	// Comments not printed yet
+	comments []lexer.Token
+	// Source line of the last printed statement or comment
+	line int
+	// Set if nothing has been printed in the current block yet, which
+	// suppresses blank lines
+	first bool
+}
+
+func (p *printer) write(s string) {
+	p.b.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.b.WriteString("\n")
+	p.b.WriteString(strings.Repeat(indentation, p.indent))
+}
+
+// find returns the first token of type t starting at or after pos.
+func (p *printer) find(t lexer.TokenType, pos position) (int, lexer.Token) {
+	i := sort.Search(len(p.tokens), func(i int) bool {
+		return !position{p.tokens[i].Line, p.tokens[i].Column}.before(pos)
+	})
+	for ; i < len(p.tokens); i++ {
+		if p.tokens[i].Type == t {
+			return i, p.tokens[i]
+		}
+	}
+	return -1, lexer.Token{}
+}
+
+// closing returns the position of the brace closing the block opened at the
+// token with index i.
+func (p *printer) closing(i int) position {
+	depth := 0
+	for ; i < len(p.tokens); i++ {
+		switch p.tokens[i].Type {
+		case lexer.LeftBrace:
+			depth++
+		case lexer.RightBrace:
+			depth--
+			if depth == 0 {
+				return position{p.tokens[i].Line, p.tokens[i].Column}
+			}
+		}
+	}
+	return position{}
+}
+
+// separate prints a blank line if the source has one before line.
+func (p *printer) separate(line int) {
+	if !p.first && line > p.line+1 {
+		p.write("\n")
+	}
+	p.first = false
+}
+
+// flush prints the comments before pos, each on a line of its own.
+func (p *printer) flush(pos position) {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		if !(position{c.Line, c.Column}).before(pos) {
+			return
+		}
+		p.comments = p.comments[1:]
+		p.separate(c.Line)
+		p.write(strings.Repeat(indentation, p.indent))
+		p.write(strings.TrimRight(c.Value, " \t"))
+		p.write("\n")
+		p.line = c.EndLine
+	}
+}
+
+// trailing prints the comments before limit starting on the line that has
+// just been printed behind it.
+func (p *printer) trailing(limit position) {
+	for len(p.comments) > 0 && p.comments[0].Line == p.line {
+		c := p.comments[0]
+		if !(position{c.Line, c.Column}).before(limit) {
+			return
+		}
+		p.comments = p.comments[1:]
+		p.write(" ")
+		p.write(strings.TrimRight(c.Value, " \t"))
+		p.line = c.EndLine
+	}
+}
+
+func (p *printer) program(n *ast.Program) {
+	p.first = true
+	p.statements(n.Statements)
+	p.flush(eof)
+}
+
+func (p *printer) statements(statements []ast.Statement) {
+	for _, n := range statements {
+		p.flush(start(n))
+		p.separate(n.Location().Line)
+		p.write(strings.Repeat(indentation, p.indent))
+		p.statement(n)
+		p.first = false
+		p.line = n.Location().EndLine
+		p.trailing(eof)
+		p.write("\n")
+	}
+}
+
+// block prints a block of statements opened by the first brace at or after
+// pos and returns the position of the closing brace.
+func (p *printer) block(pos position, statements []ast.Statement) position {
+	i, open := p.find(lexer.LeftBrace, pos)
+	close := p.closing(i)
+	p.write("{")
+	p.line = open.Line
+	p.trailing(close)
+	if len(statements) == 0 && (len(p.comments) == 0 || !(position{p.comments[0].Line, p.comments[0].Column}).before(close)) {
+		p.write("}")
+		p.line = close.line
+		return close
+	}
+
+	p.write("\n")
+	p.indent++
+	p.first = true
+	p.statements(statements)
+	p.flush(close)
+	p.indent--
+	p.write(strings.Repeat(indentation, p.indent))
+	p.write("}")
+	p.line = close.line
+	return close
+}
+
+func (p *printer) statement(n ast.Statement) {
+	switch n := n.(type) {
+	case *ast.IfStatement:
+		p.ifStatement(n)
+	case *ast.WhileStatement:
+		p.write("while ")
+		p.expression(n.Condition, precedenceExpression)
+		p.write(" ")
+		p.block(after(n.Condition), n.Statements)
+	case *ast.ForStatement:
+		p.write("for ")
+		if n.IndexIdentifier != "" {
+			p.write(n.IndexIdentifier + ", ")
+		}
+		p.write(n.ValueIdentifier + " in ")
+		p.expression(n.Iterable, precedenceExpression)
+		p.write(" ")
+		p.block(after(n.Iterable), n.Statements)
+	case *ast.StructDeclaration:
+		p.write("struct " + n.Name + " {")
+		if len(n.Fields) > 0 {
+			p.write(" " + strings.Join(n.Fields, ", ") + " ")
+		}
+		p.write("}")
+	case *ast.ClassDeclaration:
+		p.classDeclaration(n)
+	case *ast.TryStatement:
+		p.write("try ")
+		close := p.block(start(n), n.Statements)
+		if n.Catch != nil {
+			p.write(" catch (" + n.Catch.Identifier + ") ")
+			close = p.block(start(n.Catch), n.Catch.Statements)
+		}
+		if n.Finally != nil {
+			_, finally := p.find(lexer.FinallyKeyword, close)
+			p.write(" finally ")
+			p.block(position{finally.Line, finally.Column}, n.Finally)
+		}
+	case *ast.ExpressionStatement:
+		// An if expression at the start of a statement would be parsed as if
+		// statement
+		if _, ok := n.Expression.(*ast.IfExpression); ok {
+			p.expression(n.Expression, precedenceValue)
+		} else {
+			p.expression(n.Expression, precedenceExpression)
+		}
+		p.write(";")
+	case *ast.DeclarationStatement:
+		p.write(n.Identifier + " := ")
+		p.expression(n.Value, precedenceExpression)
+		p.write(";")
+	case *ast.AssignmentStatement:
+		p.write(n.Identifier + " = ")
+		p.expression(n.Value, precedenceExpression)
+		p.write(";")
+	case *ast.SubscriptAssignmentStatement:
+		p.expression(n.Target, precedencePostfix)
+		p.write("[")
+		p.expression(n.Index, precedenceExpression)
+		p.write("] = ")
+		p.expression(n.Value, precedenceExpression)
+		p.write(";")
+	case *ast.MemberAssignmentStatement:
+		p.expression(n.Target, precedencePostfix)
+		p.write("." + n.Name + " = ")
+		p.expression(n.Value, precedenceExpression)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(n.Expression, precedenceExpression)
+		p.write(";")
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(n.Expression, precedenceExpression)
+		p.write(";")
+	case *ast.ContinueStatement:
+		p.write("continue;")
+	case *ast.BreakStatement:
+		p.write("break;")
+	}
+}
+
+func (p *printer) ifStatement(n *ast.IfStatement) {
+	p.write("if ")
+	p.expression(n.Condition, precedenceExpression)
+	p.write(" ")
+	p.block(after(n.Condition), n.Statements)
+	if n.ElseBranch == nil {
+		return
+	}
+	p.write(" else ")
+	if n.ElseBranch.Condition != nil {
+		p.ifStatement(n.ElseBranch)
+	} else {
+		p.block(start(n.ElseBranch), n.ElseBranch.Statements)
+	}
+}
+
+func (p *printer) classDeclaration(n *ast.ClassDeclaration) {
+	p.write("class " + n.Name + " ")
+	if n.Superclass != nil {
+		p.write(": " + n.Superclass.Identifier + " ")
+	}
+	i, open := p.find(lexer.LeftBrace, start(n))
+	close := p.closing(i)
+	p.write("{")
+	p.line = open.Line
+	p.trailing(close)
+	if len(n.Methods) == 0 {
+		p.write("}")
+		return
+	}
+
+	p.write("\n")
+	p.indent++
+	p.first = true
+	for _, m := range n.Methods {
+		p.flush(start(m))
+		p.separate(m.Line)
+		p.write(strings.Repeat(indentation, p.indent))
+		p.write(m.Name + "(" + strings.Join(m.Parameters, ", ") + ") ")
+		p.block(start(m), m.Statements)
+		p.first = false
+		p.line = m.EndLine
+		p.trailing(close)
+		p.write("\n")
+	}
+	p.flush(close)
+	p.indent--
+	p.write(strings.Repeat(indentation, p.indent))
+	p.write("}")
+}
+
+func precedence(n ast.Expression) int {
+	switch n := n.(type) {
+	case *ast.IfExpression, *ast.Function:
+		return precedenceExpression
+	case *ast.BinaryOperationExpression:
+		return binaryPrecedence(n.Operator)
+	case *ast.UnaryOperationExpression:
+		return precedenceUnary
+	case *ast.CallExpression, *ast.SubscriptExpression, *ast.MemberExpression:
+		return precedencePostfix
+	}
+	return precedenceValue
+}
+
+func binaryPrecedence(o ast.BinaryOperator) int {
+	switch o {
+	case ast.BinaryOperatorLor:
+		return precedenceOr
+	case ast.BinaryOperatorLand:
+		return precedenceAnd
+	case ast.BinaryOperatorAdd, ast.BinaryOperatorSub:
+		return precedenceTerm
+	case ast.BinaryOperatorMul, ast.BinaryOperatorDiv:
+		return precedenceAddend
+	}
+	return precedenceComparison
+}
+
+// expression prints n, in parentheses if it binds looser than min.
+func (p *printer) expression(n ast.Expression, min int) {
+	if precedence(n) < min {
+		p.write("(")
+		p.expression(n, precedenceExpression)
+		p.write(")")
+		return
+	}
+
+	switch n := n.(type) {
+	case *ast.IfExpression:
+		p.ifExpression(n, n.Value.Location().Line > n.Line)
+	case *ast.Function:
+		p.write("func(" + strings.Join(n.Parameters, ", ") + ") ")
+		p.block(start(n), n.Statements)
+	case *ast.BinaryOperationExpression:
+		level := binaryPrecedence(n.Operator)
+		// Comparisons don't chain, all other operators are left associative
+		left := level
+		if level == precedenceComparison {
+			left++
+		}
+		p.expression(n.A, left)
+		p.write(" " + n.Operator.String() + " ")
+		p.expression(n.B, level+1)
+	case *ast.UnaryOperationExpression:
+		p.write(n.Operator.String())
+		// Keep signs apart, "--x" reads like a decrement
+		if a, ok := n.A.(*ast.UnaryOperationExpression); ok && n.Operator != ast.UnaryOperatorLnot && a.Operator != ast.UnaryOperatorLnot {
+			p.write(" ")
+		}
+		p.expression(n.A, precedenceUnary)
+	case *ast.CallExpression:
+		p.expression(n.Callee, precedencePostfix)
+		_, open := p.find(lexer.LeftParen, after(n.Callee))
+		p.list("(", n.Parameters, ")", open.Line, end(n))
+	case *ast.SubscriptExpression:
+		p.expression(n.Target, precedencePostfix)
+		p.write("[")
+		p.expression(n.Index, precedenceExpression)
+		p.write("]")
+	case *ast.MemberExpression:
+		p.expression(n.Target, precedencePostfix)
+		p.write("." + n.Name)
+	case *ast.ArrayExpression:
+		p.list("[", n.Items, "]", n.Line, end(n))
+	case *ast.MapExpression:
+		p.mapExpression(n)
+	case *ast.LookupExpression:
+		p.write(n.Identifier)
+	case *ast.Integer:
+		if t, ok := p.token(n); ok {
+			p.write(t.Value)
+		} else {
+			p.write(strconv.FormatInt(n.Value, 10))
+		}
+	case *ast.Float:
+		if t, ok := p.token(n); ok {
+			p.write(t.Value)
+		} else {
+			p.write(formatFloat(n.Value))
+		}
+	case *ast.String:
+		if t, ok := p.token(n); ok && t.Type == rawString {
+			p.write(t.Value)
+		} else {
+			p.write(`"` + quote(n.Value) + `"`)
+		}
+	case *ast.InterpolatedString:
+		p.write(`"`)
+		for _, part := range n.Parts {
+			if s, ok := part.(*ast.String); ok && p.isSegment(s) {
+				p.write(quote(s.Value))
+				continue
+			}
+			p.write("${")
+			p.expression(part, precedenceExpression)
+			p.write("}")
+		}
+		p.write(`"`)
+	case *ast.Boolean:
+		p.write(strconv.FormatBool(n.Value))
+	case *ast.Nil:
+		p.write("nil")
+	}
+}
+
+// ifExpression prints n on a single line or, if multiline is set, with each
+// value on a line of its own.
+func (p *printer) ifExpression(n *ast.IfExpression, multiline bool) {
+	if n.Condition != nil {
+		p.write("if ")
+		p.expression(n.Condition, precedenceExpression)
+		p.write(" ")
+	}
+	p.write("{")
+	if multiline {
+		p.indent++
+		p.newline()
+		p.expression(n.Value, precedenceExpression)
+		p.indent--
+		p.newline()
+	} else {
+		p.write(" ")
+		p.expression(n.Value, precedenceExpression)
+		p.write(" ")
+	}
+	p.write("}")
+	if n.ElseBranch != nil {
+		p.write(" else ")
+		p.ifExpression(n.ElseBranch, multiline)
+	}
+}
+
+// list prints items separated by commas between open and close. If the first
+// item doesn't start on the line of the opening bracket, every item is put on
+// a line of its own.
+func (p *printer) list(open string, items []ast.Expression, close string, line int, end position) {
+	p.write(open)
+	if len(items) == 0 || items[0].Location().Line == line {
+		for i, item := range items {
+			if i != 0 {
+				p.write(", ")
+			}
+			p.expression(item, precedenceExpression)
+		}
+		p.write(close)
+		return
+	}
+
+	p.indent++
+	p.first = true
+	for _, item := range items {
+		p.write("\n")
+		p.flush(start(item))
+		p.write(strings.Repeat(indentation, p.indent))
+		p.expression(item, precedenceExpression)
+		p.write(",")
+		p.line = item.Location().EndLine
+		p.trailing(end)
+	}
+	p.write("\n")
+	p.flush(end)
+	p.indent--
+	p.write(strings.Repeat(indentation, p.indent))
+	p.write(close)
+}
+
+func (p *printer) mapExpression(n *ast.MapExpression) {
+	if len(n.Entries) == 0 || n.Entries[0].Key.Location().Line == n.Line {
+		p.write("{")
+		for i, e := range n.Entries {
+			if i != 0 {
+				p.write(", ")
+			}
+			p.expression(e.Key, precedenceExpression)
+			p.write(": ")
+			p.expression(e.Value, precedenceExpression)
+		}
+		p.write("}")
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	p.first = true
+	for _, e := range n.Entries {
+		p.write("\n")
+		p.flush(start(e.Key))
+		p.write(strings.Repeat(indentation, p.indent))
+		p.expression(e.Key, precedenceExpression)
+		p.write(": ")
+		p.expression(e.Value, precedenceExpression)
+		p.write(",")
+		p.line = e.Value.Location().EndLine
+		p.trailing(end(n))
+	}
+	p.write("\n")
+	p.flush(end(n))
+	p.indent--
+	p.write(strings.Repeat(indentation, p.indent))
+	p.write("}")
+}
+
+// token returns the source token of the literal n.
+func (p *printer) token(n ast.Node) (lexer.Token, bool) {
+	i, ok := p.positions[start(n)]
+	if !ok {
+		return lexer.Token{}, false
+	}
+	return p.tokens[i], true
+}
+
+// isSegment reports whether s is a literal part of an interpolated string,
+// as opposed to an interpolated string literal.
+func (p *printer) isSegment(s *ast.String) bool {
+	t, ok := p.token(s)
+	return !ok || t.Type != lexer.String && t.Type != rawString
+}
+
+// formatFloat formats v such that it is read back as Float.
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// quote escapes s for use in a quoted string literal.
+func quote(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '$' && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteString(`\$`)
+		case r < ' ' || r == 0x7f:
+			b.WriteString(`\u{` + strconv.FormatInt(int64(r), 16) + `}`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
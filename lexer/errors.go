@@ -2,17 +2,87 @@ package lexer
 
 import (
 	"fmt"
+
+	"github.com/niklaskorz/nklang/ast"
 )
 
+// position formats a position like ast.Span.Position, so lexer errors are
+// prefixed the same way as semantic and runtime errors.
+func position(file string, line, column int) string {
+	return ast.Span{File: file, Line: line, Column: column}.Position()
+}
+
 type UnexpectedSymbolError struct {
+	File         string
 	Line, Column int
 	Symbol       rune
 }
 
 func (e UnexpectedSymbolError) Error() string {
-	return fmt.Sprintf("Unexpected symbol at line %d, column %d: %c", e.Line, e.Column, e.Symbol)
+	return fmt.Sprintf("%s: Unexpected symbol %c", position(e.File, e.Line, e.Column), e.Symbol)
 }
 
 func (s *Scanner) unexpectedSymbol(symbol rune) UnexpectedSymbolError {
 	return UnexpectedSymbolError{Line: s.line, Column: s.column, Symbol: symbol}
 }
+
+type UnterminatedCommentError struct {
+	File         string
+	Line, Column int
+}
+
+func (e UnterminatedCommentError) Error() string {
+	return fmt.Sprintf("%s: Unterminated block comment", position(e.File, e.Line, e.Column))
+}
+
+type UnterminatedStringError struct {
+	File         string
+	Line, Column int
+}
+
+func (e UnterminatedStringError) Error() string {
+	return fmt.Sprintf("%s: Unterminated string literal", position(e.File, e.Line, e.Column))
+}
+
+type InvalidEscapeError struct {
+	File         string
+	Line, Column int
+	Sequence     string
+}
+
+func (e InvalidEscapeError) Error() string {
+	return fmt.Sprintf("%s: Invalid escape sequence %s", position(e.File, e.Line, e.Column), e.Sequence)
+}
+
+type InvalidNumberError struct {
+	File         string
+	Line, Column int
+	Literal      string
+	Reason       string
+}
+
+func (e InvalidNumberError) Error() string {
+	return fmt.Sprintf("%s: Invalid number literal %s (%s)", position(e.File, e.Line, e.Column), e.Literal, e.Reason)
+}
+
+// withFile sets the file of the lexer error err to the scanned file.
+func (s *Scanner) withFile(err error) error {
+	switch e := err.(type) {
+	case UnexpectedSymbolError:
+		e.File = s.File
+		return e
+	case UnterminatedCommentError:
+		e.File = s.File
+		return e
+	case UnterminatedStringError:
+		e.File = s.File
+		return e
+	case InvalidEscapeError:
+		e.File = s.File
+		return e
+	case InvalidNumberError:
+		e.File = s.File
+		return e
+	}
+	return err
+}
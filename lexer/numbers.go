@@ -0,0 +1,200 @@
+package lexer
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// scanNumber reads an integer or floating point literal starting with the
+// digit r. Integers may be written in decimal or, with a 0x, 0o or 0b prefix,
+// in hexadecimal, octal or binary. Floats are decimal with an optional
+// fraction and exponent. Digits may be separated by underscores. The literal
+// is validated, so the parser can rely on ParseInteger and ParseFloat.
+func (s *Scanner) scanNumber(r rune, line, column int) (TokenType, string, error) {
+	num := string(r)
+
+	if r == '0' {
+		next, err := s.readRune()
+		if err != nil {
+			return 0, "", err
+		}
+		switch next {
+		case 'x', 'X', 'o', 'O', 'b', 'B':
+			v, err := s.scanIdentifier()
+			if err != nil {
+				return 0, "", err
+			}
+			num += string(next) + v
+			if err := validateNumber(Integer, num, line, column); err != nil {
+				return 0, "", err
+			}
+			return Integer, num, nil
+		}
+		if err := s.unreadRune(); err != nil {
+			return 0, "", err
+		}
+	}
+
+	v, err := s.scanInteger()
+	if err != nil {
+		return 0, "", err
+	}
+	num += v
+	t := Integer
+
+	r, err = s.readRune()
+	if err != nil {
+		return 0, "", err
+	}
+	if r == '.' {
+		// Fraction
+		r, err = s.readRune()
+		if err != nil {
+			return 0, "", err
+		}
+		if !unicode.IsDigit(r) {
+			return 0, "", s.unexpectedSymbol(r)
+		}
+		v, err = s.scanInteger()
+		if err != nil {
+			return 0, "", err
+		}
+		num += "." + string(r) + v
+		t = Float
+
+		r, err = s.readRune()
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	if r == 'e' || r == 'E' {
+		// Exponent
+		num += string(r)
+		r, err = s.readRune()
+		if err != nil {
+			return 0, "", err
+		}
+		if r == '+' || r == '-' {
+			num += string(r)
+			r, err = s.readRune()
+			if err != nil {
+				return 0, "", err
+			}
+		}
+		if !unicode.IsDigit(r) {
+			return 0, "", s.unexpectedSymbol(r)
+		}
+		v, err = s.scanInteger()
+		if err != nil {
+			return 0, "", err
+		}
+		num += string(r) + v
+		t = Float
+	} else if err := s.unreadRune(); err != nil {
+		return 0, "", err
+	}
+
+	// Catch literals like 12abc
+	r, err = s.readRune()
+	if err != nil {
+		return 0, "", err
+	}
+	if unicode.IsLetter(r) {
+		return 0, "", InvalidNumberError{Line: line, Column: column, Literal: num + string(r), Reason: "unexpected letter"}
+	}
+	if err := s.unreadRune(); err != nil {
+		return 0, "", err
+	}
+
+	if err := validateNumber(t, num, line, column); err != nil {
+		return 0, "", err
+	}
+	return t, num, nil
+}
+
+// scanInteger reads decimal digits and underscores.
+func (s *Scanner) scanInteger() (string, error) {
+	str := ""
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return "", err
+		}
+
+		if !unicode.IsDigit(r) && r != '_' {
+			if err := s.unreadRune(); err != nil {
+				return "", err
+			}
+			return str, nil
+		}
+
+		str += string(r)
+	}
+}
+
+// validateNumber checks that literal can be converted to a number of type t.
+func validateNumber(t TokenType, literal string, line, column int) error {
+	if !separatesDigits(literal) {
+		return InvalidNumberError{Line: line, Column: column, Literal: literal, Reason: "'_' must separate digits"}
+	}
+
+	var err error
+	if t == Float {
+		_, err = ParseFloat(literal)
+	} else {
+		_, err = ParseInteger(literal)
+	}
+	if err == nil {
+		return nil
+	}
+
+	reason := "invalid syntax"
+	if err, ok := err.(*strconv.NumError); ok && err.Err == strconv.ErrRange {
+		reason = "value out of range"
+	}
+	return InvalidNumberError{Line: line, Column: column, Literal: literal, Reason: reason}
+}
+
+// separatesDigits reports whether every underscore in literal stands between
+// two digits, so neither 1_, 1__0, 0x_1 nor 1_.5 are accepted.
+func separatesDigits(literal string) bool {
+	hex := len(literal) > 1 && (literal[1] == 'x' || literal[1] == 'X')
+	isDigit := func(c byte) bool {
+		return '0' <= c && c <= '9' || hex && isHexDigit(rune(c))
+	}
+	for i := 0; i < len(literal); i++ {
+		if literal[i] != '_' {
+			continue
+		}
+		if i == 0 || i == len(literal)-1 || !isDigit(literal[i-1]) || !isDigit(literal[i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseInteger converts the value of an Integer token to its numeric value.
+func ParseInteger(literal string) (int64, error) {
+	literal = strings.ReplaceAll(literal, "_", "")
+	base := 10
+	if len(literal) > 2 && literal[0] == '0' {
+		switch literal[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			literal = literal[2:]
+		}
+	}
+	return strconv.ParseInt(literal, base, 64)
+}
+
+// ParseFloat converts the value of a Float token to its numeric value.
+func ParseFloat(literal string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(literal, "_", ""), 64)
+}
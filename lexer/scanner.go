@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strconv"
 	"unicode"
+	"unicode/utf8"
 )
 
 const bufferSize = 32
@@ -17,6 +19,22 @@ type Scanner struct {
 	Token         *Token
 	previousToken *Token
 	nextToken     *Token
+	// File is the name of the scanned source, used in positions of the parsed
+	// nodes.
+	File string
+	// KeepComments makes the scanner emit Comment tokens instead of
+	// skipping comments. The parser expects this to be false.
+	KeepComments bool
+	// Stack of currently open string interpolations
+	interpolations []interpolation
+}
+
+// interpolation tracks an expression embedded into a string literal with
+// "${ ... }". braces counts the unclosed braces inside the expression, line
+// and column denote the opening quotation mark of the string.
+type interpolation struct {
+	braces       int
+	line, column int
 }
 
 func NewScanner(rd io.Reader) *Scanner {
@@ -45,9 +63,19 @@ func (s *Scanner) ReadNext() error {
 	err := s.readNext()
 	if err == io.EOF {
 		s.Token = &Token{Line: s.line, Column: s.column, Type: EOF, Value: "EOF"}
-		return nil
+		err = nil
+	}
+	if err != nil {
+		return s.withFile(err)
 	}
-	return err
+	s.Token.EndLine, s.Token.EndColumn = s.line, s.column
+	return nil
+}
+
+// Previous returns the token read before the current one. It returns nil
+// directly after Unread.
+func (s *Scanner) Previous() *Token {
+	return s.previousToken
 }
 
 func (s *Scanner) readRune() (rune, error) {
@@ -84,7 +112,7 @@ func (s *Scanner) readNext() error {
 	var err error
 
 	for {
-		// Skip whitespace
+		// Skip whitespace and comments
 		r, err = s.readRune()
 		if err != nil {
 			return err
@@ -94,26 +122,43 @@ func (s *Scanner) readNext() error {
 			return io.EOF
 		}
 
-		if !unicode.IsSpace(r) {
-			break
-		}
-
-		if r == '\n' || r == '\r' {
-			s.line++
-			s.column = 0
-		}
-
-		if r == '\r' {
-			// Skip LF after CR
-			r, err = s.readRune()
+		if r == '/' {
+			line, column := s.line, s.column
+			next, err := s.readRune()
 			if err != nil {
 				return err
 			}
-			if r != '\n' {
-				// No LF, rewind
+			if next != '/' && next != '*' {
+				// Division operator, rewind
 				if err := s.unreadRune(); err != nil {
 					return err
 				}
+				break
+			}
+
+			var text string
+			if next == '/' {
+				text, err = s.scanLineComment()
+			} else {
+				text, err = s.scanBlockComment(line, column)
+			}
+			if err != nil {
+				return err
+			}
+			if s.KeepComments {
+				s.Token = &Token{Line: line, Column: column, Type: Comment, Value: text}
+				return nil
+			}
+			continue
+		}
+
+		if !unicode.IsSpace(r) {
+			break
+		}
+
+		if r == '\n' || r == '\r' {
+			if err := s.lineBreak(r); err != nil {
+				return err
 			}
 		}
 	}
@@ -122,10 +167,21 @@ func (s *Scanner) readNext() error {
 
 	if r == '"' {
 		// String
-		v, err := s.scanString()
-		if err == io.EOF {
-			return fmt.Errorf("Unexpected end of file while parsing string literal")
+		v, interpolated, err := s.scanString(line, column)
+		if err != nil {
+			return err
 		}
+		s.Token = &Token{Line: line, Column: column, Type: String, Value: v}
+		if interpolated {
+			s.Token.Type = StringHead
+			s.interpolations = append(s.interpolations, interpolation{line: line, column: column})
+		}
+		return nil
+	}
+
+	if r == '`' {
+		// Raw string
+		v, err := s.scanRawString(line, column)
 		if err != nil {
 			return err
 		}
@@ -142,27 +198,8 @@ func (s *Scanner) readNext() error {
 		id := string(r) + v
 		s.Token = &Token{Line: line, Column: column, Type: ID, Value: id}
 
-		switch id {
-		case "return":
-			s.Token.Type = ReturnKeyword
-		case "continue":
-			s.Token.Type = ContinueKeyword
-		case "break":
-			s.Token.Type = BreakKeyword
-		case "func":
-			s.Token.Type = FunctionKeyword
-		case "if":
-			s.Token.Type = IfKeyword
-		case "else":
-			s.Token.Type = ElseKeyword
-		case "while":
-			s.Token.Type = WhileKeyword
-		case "true":
-			s.Token.Type = TrueKeyword
-		case "false":
-			s.Token.Type = FalseKeyword
-		case "nil":
-			s.Token.Type = NilKeyword
+		if t, ok := Keywords[id]; ok {
+			s.Token.Type = t
 		}
 
 		return nil
@@ -170,50 +207,28 @@ func (s *Scanner) readNext() error {
 
 	if unicode.IsDigit(r) {
 		// Number
-		v, err := s.scanIdentifier()
+		t, v, err := s.scanNumber(r, line, column)
 		if err != nil {
 			return err
 		}
-		num := string(r) + v
-		r, err = s.readRune()
+		s.Token = &Token{Line: line, Column: column, Type: t, Value: v}
+		return nil
+	}
+
+	if r == ':' {
+		r, err := s.readRune()
 		if err != nil {
 			return err
 		}
-		if r == '.' {
-			// Floating point number
-			r, err = s.readRune()
-			if err != nil {
-				return err
-			}
-			if !unicode.IsDigit(r) {
-				return s.unexpectedSymbol(r)
-			}
-			v, err = s.scanIdentifier()
-			if err != nil {
-				return err
-			}
-			num += "." + string(r) + v
-			s.Token = &Token{Line: line, Column: column, Type: Float, Value: num}
 
+		if r == '=' {
+			s.Token = &Token{Line: line, Column: column, Type: DeclarationOperator, Value: ":="}
 		} else {
-			// Integer
 			if err := s.unreadRune(); err != nil {
 				return err
 			}
-			s.Token = &Token{Line: line, Column: column, Type: Integer, Value: num}
-		}
-		return nil
-	}
-
-	if r == ':' {
-		r, err = s.readRune()
-		if err != nil {
-			return err
+			s.Token = &Token{Line: line, Column: column, Type: Colon, Value: ":"}
 		}
-		if r != '=' {
-			return s.unexpectedSymbol(r)
-		}
-		s.Token = &Token{Line: line, Column: column, Type: DeclarationOperator, Value: ":="}
 		return nil
 	}
 
@@ -339,6 +354,11 @@ func (s *Scanner) readNext() error {
 		return nil
 	}
 
+	if r == '.' {
+		s.Token = &Token{Line: line, Column: column, Type: Dot, Value: "."}
+		return nil
+	}
+
 	if r == '(' {
 		s.Token = &Token{Line: line, Column: column, Type: LeftParen, Value: "("}
 		return nil
@@ -350,11 +370,32 @@ func (s *Scanner) readNext() error {
 	}
 
 	if r == '{' {
+		if n := len(s.interpolations); n > 0 {
+			s.interpolations[n-1].braces++
+		}
 		s.Token = &Token{Line: line, Column: column, Type: LeftBrace, Value: "{"}
 		return nil
 	}
 
 	if r == '}' {
+		if n := len(s.interpolations); n > 0 {
+			if s.interpolations[n-1].braces == 0 {
+				// End of interpolated expression, continue with string
+				i := s.interpolations[n-1]
+				s.interpolations = s.interpolations[:n-1]
+				v, interpolated, err := s.scanString(i.line, i.column)
+				if err != nil {
+					return err
+				}
+				s.Token = &Token{Line: line, Column: column, Type: StringTail, Value: v}
+				if interpolated {
+					s.Token.Type = StringMiddle
+					s.interpolations = append(s.interpolations, i)
+				}
+				return nil
+			}
+			s.interpolations[n-1].braces--
+		}
 		s.Token = &Token{Line: line, Column: column, Type: RightBrace, Value: "}"}
 		return nil
 	}
@@ -372,21 +413,46 @@ func (s *Scanner) readNext() error {
 	return s.unexpectedSymbol(r)
 }
 
-func (s *Scanner) scanString() (string, error) {
-	str := ""
+// lineBreak advances the position to the next line after the line break r
+// has been read. A CR directly followed by LF counts as a single line break.
+func (s *Scanner) lineBreak(r rune) error {
+	s.line++
+	s.column = 0
+
+	if r == '\r' {
+		// Skip LF after CR
+		r, err := s.readRune()
+		if err != nil {
+			return err
+		}
+		if r != '\n' {
+			// No LF, rewind
+			return s.unreadRune()
+		}
+		s.column = 0
+	}
+	return nil
+}
+
+// scanLineComment reads a comment started by "//" up to, but not including,
+// the end of the line.
+func (s *Scanner) scanLineComment() (string, error) {
+	str := "//"
 	for {
-		r, _, err := s.rd.ReadRune()
+		r, err := s.readRune()
 		if err != nil {
 			return "", err
 		}
-		s.column++
 
-		if r == '\n' {
-			s.line++
-			s.column = 0
+		if r == eofRune {
+			return str, nil
 		}
 
-		if r == '"' {
+		if r == '\n' || r == '\r' {
+			// Leave line break to the whitespace handling
+			if err := s.unreadRune(); err != nil {
+				return "", err
+			}
 			return str, nil
 		}
 
@@ -394,26 +460,195 @@ func (s *Scanner) scanString() (string, error) {
 	}
 }
 
-func (s *Scanner) scanIdentifier() (string, error) {
-	str := ""
-	for {
+// scanBlockComment reads a comment started by "/*" up to and including the
+// matching "*/". Block comments may be nested. Line breaks inside the comment
+// are normalized to LF.
+func (s *Scanner) scanBlockComment(line, column int) (string, error) {
+	str := "/*"
+	depth := 1
+	for depth > 0 {
 		r, err := s.readRune()
 		if err != nil {
 			return "", err
 		}
 
-		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+		switch r {
+		case eofRune:
+			return "", UnterminatedCommentError{Line: line, Column: column}
+		case '\n', '\r':
+			if err := s.lineBreak(r); err != nil {
+				return "", err
+			}
+			str += "\n"
+			continue
+		case '/', '*':
+			next, err := s.readRune()
+			if err != nil {
+				return "", err
+			}
+			if r == '/' && next == '*' {
+				depth++
+				str += "/*"
+				continue
+			}
+			if r == '*' && next == '/' {
+				depth--
+				str += "*/"
+				continue
+			}
 			if err := s.unreadRune(); err != nil {
 				return "", err
 			}
+		}
+
+		str += string(r)
+	}
+	return str, nil
+}
+
+// scanString reads a string literal after its opening quotation mark and
+// resolves escape sequences. line and column denote the opening quotation mark.
+// Scanning stops early at the start of an interpolated expression "${", which
+// is reported by returning true.
+func (s *Scanner) scanString(line, column int) (string, bool, error) {
+	str := ""
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return "", false, err
+		}
+
+		switch r {
+		case eofRune:
+			return "", false, UnterminatedStringError{Line: line, Column: column}
+		case '"':
+			return str, false, nil
+		case '\\':
+			v, err := s.scanEscape(line, column)
+			if err != nil {
+				return "", false, err
+			}
+			str += string(v)
+			continue
+		case '\n', '\r':
+			if err := s.lineBreak(r); err != nil {
+				return "", false, err
+			}
+			str += "\n"
+			continue
+		case '$':
+			next, err := s.readRune()
+			if err != nil {
+				return "", false, err
+			}
+			if next == '{' {
+				return str, true, nil
+			}
+			if err := s.unreadRune(); err != nil {
+				return "", false, err
+			}
+		}
+
+		str += string(r)
+	}
+}
+
+// scanEscape reads an escape sequence after its backslash and returns the
+// rune it stands for. stringLine and stringColumn denote the opening quote of
+// the string, which is reported if the input ends inside the sequence.
+func (s *Scanner) scanEscape(stringLine, stringColumn int) (rune, error) {
+	line, column := s.line, s.column
+	r, err := s.readRune()
+	if err != nil {
+		return 0, err
+	}
+
+	switch r {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case '"':
+		return '"', nil
+	case '\\':
+		return '\\', nil
+	case '$':
+		return '$', nil
+	case 'u':
+		r, err := s.readRune()
+		if err != nil {
+			return 0, err
+		}
+		if r == eofRune {
+			return 0, UnterminatedStringError{Line: stringLine, Column: stringColumn}
+		}
+		if r != '{' {
+			return 0, InvalidEscapeError{Line: line, Column: column, Sequence: "\\u" + string(r)}
+		}
+		digits := ""
+		for {
+			r, err := s.readRune()
+			if err != nil {
+				return 0, err
+			}
+			if r == '}' {
+				break
+			}
+			if r == eofRune {
+				return 0, UnterminatedStringError{Line: stringLine, Column: stringColumn}
+			}
+			if !isHexDigit(r) || len(digits) == 6 {
+				return 0, InvalidEscapeError{Line: line, Column: column, Sequence: "\\u{" + digits + string(r)}
+			}
+			digits += string(r)
+		}
+		v, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || !utf8.ValidRune(rune(v)) {
+			return 0, InvalidEscapeError{Line: line, Column: column, Sequence: "\\u{" + digits + "}"}
+		}
+		return rune(v), nil
+	case eofRune:
+		return 0, UnterminatedStringError{Line: stringLine, Column: stringColumn}
+	}
+
+	return 0, InvalidEscapeError{Line: line, Column: column, Sequence: "\\" + string(r)}
+}
+
+// scanRawString reads a raw string literal after its opening backtick. Raw
+// strings may span multiple lines and do not support escape sequences. line
+// and column denote the opening backtick.
+func (s *Scanner) scanRawString(line, column int) (string, error) {
+	str := ""
+	for {
+		r, err := s.readRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case eofRune:
+			return "", UnterminatedStringError{Line: line, Column: column}
+		case '`':
 			return str, nil
+		case '\n', '\r':
+			if err := s.lineBreak(r); err != nil {
+				return "", err
+			}
+			str += "\n"
+			continue
 		}
 
 		str += string(r)
 	}
 }
 
-func (s *Scanner) scanInteger() (string, error) {
+func isHexDigit(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func (s *Scanner) scanIdentifier() (string, error) {
 	str := ""
 	for {
 		r, err := s.readRune()
@@ -421,7 +656,7 @@ func (s *Scanner) scanInteger() (string, error) {
 			return "", err
 		}
 
-		if !unicode.IsDigit(r) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
 			if err := s.unreadRune(); err != nil {
 				return "", err
 			}
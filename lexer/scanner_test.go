@@ -0,0 +1,222 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+// scan returns the tokens of src up to, but not including, EOF.
+func scan(t *testing.T, src string, keepComments bool) []*Token {
+	t.Helper()
+	s := NewScanner(strings.NewReader(src))
+	s.KeepComments = keepComments
+	var tokens []*Token
+	for {
+		if err := s.ReadNext(); err != nil {
+			t.Fatalf("Scanning %q: %s", src, err)
+		}
+		if s.Token.Type == EOF {
+			return tokens
+		}
+		tokens = append(tokens, s.Token)
+	}
+}
+
+// scanError returns the first error scanning src.
+func scanError(t *testing.T, src string) error {
+	t.Helper()
+	s := NewScanner(strings.NewReader(src))
+	for {
+		if err := s.ReadNext(); err != nil {
+			return err
+		}
+		if s.Token.Type == EOF {
+			t.Fatalf("Expected an error scanning %q", src)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	src := "a // line\n/* block\n/* nested */ still\n*/ b /**/c"
+	tokens := scan(t, src, false)
+	expected := []struct {
+		value        string
+		line, column int
+	}{{"a", 1, 1}, {"b", 4, 4}, {"c", 4, 10}}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %v", len(expected), tokens)
+	}
+	for i, e := range expected {
+		if tok := tokens[i]; tok.Value != e.value || tok.Line != e.line || tok.Column != e.column {
+			t.Errorf("Expected %s at %d:%d, got %s at %d:%d", e.value, e.line, e.column, tok.Value, tok.Line, tok.Column)
+		}
+	}
+
+	tokens = scan(t, src, true)
+	var comments []string
+	for _, tok := range tokens {
+		if tok.Type == Comment {
+			comments = append(comments, tok.Value)
+		}
+	}
+	if len(comments) != 3 || comments[0] != "// line" || comments[1] != "/* block\n/* nested */ still\n*/" || comments[2] != "/**/" {
+		t.Errorf("Expected the three comments, got %q", comments)
+	}
+
+	if tokens := scan(t, "a / b", false); len(tokens) != 3 || tokens[1].Type != DivOperator {
+		t.Errorf("Expected a division, got %v", tokens)
+	}
+}
+
+func TestUnterminatedComments(t *testing.T) {
+	for _, src := range []string{"a /* open", "/* outer /* inner */", "/* /* */ */ /*\n"} {
+		err := scanError(t, src)
+		if _, ok := err.(UnterminatedCommentError); !ok {
+			t.Errorf("Expected an unterminated comment in %q, got %v", src, err)
+		}
+	}
+	err := scanError(t, "\n  /* /* */")
+	if e, ok := err.(UnterminatedCommentError); !ok || e.Line != 2 || e.Column != 3 {
+		t.Errorf("Expected an unterminated comment at 2:3, got %v", err)
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	src := `"\n\t\r\"\\\$\u{41}\u{1F600}\u{0}"`
+	tokens := scan(t, src, false)
+	if len(tokens) != 1 || tokens[0].Type != String || tokens[0].Value != "\n\t\r\"\\$A😀\x00" {
+		t.Errorf("Expected the escaped string, got %v", tokens)
+	}
+
+	tokens = scan(t, "`raw\\n\n${x}`", false)
+	if len(tokens) != 1 || tokens[0].Type != String || tokens[0].Value != "raw\\n\n${x}" {
+		t.Errorf("Expected the raw string, got %v", tokens)
+	}
+}
+
+func TestInvalidEscapes(t *testing.T) {
+	for src, sequence := range map[string]string{
+		`"\q"`:          `\q`,
+		`"\u41"`:        `\u4`,
+		`"\u{}"`:        `\u{}`,
+		`"\u{4G}"`:      `\u{4G`,
+		`"\u{1234567}"`: `\u{1234567`,
+		`"\u{110000}"`:  `\u{110000}`,
+		`"\u{D800}"`:    `\u{D800}`,
+	} {
+		err := scanError(t, src)
+		if e, ok := err.(InvalidEscapeError); !ok || e.Sequence != sequence || e.Column != 2 {
+			t.Errorf("Expected invalid escape sequence %s at column 2 in %s, got %v", sequence, src, err)
+		}
+	}
+}
+
+func TestUnterminatedStrings(t *testing.T) {
+	for _, src := range []string{`x := "abc`, `x := "\`, `x := "\u`, `x := "\u{`, `x := "\u{41`, "x := `raw", `x := "${1}`} {
+		err := scanError(t, src)
+		if e, ok := err.(UnterminatedStringError); !ok || e.Line != 1 || e.Column != 6 {
+			t.Errorf("Expected an unterminated string at 1:6 in %s, got %v", src, err)
+		}
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	src := `"a${ {"k": "}"}["k"] }b${"c${d}"}e" f`
+	var kinds []TokenType
+	var values []string
+	for _, tok := range scan(t, src, false) {
+		kinds = append(kinds, tok.Type)
+		values = append(values, tok.Value)
+	}
+	expectedKinds := []TokenType{
+		StringHead, LeftBrace, String, Colon, String, RightBrace, LeftBracket, String, RightBracket,
+		StringMiddle, StringHead, ID, StringTail, StringTail, ID,
+	}
+	expectedValues := []string{"a", "{", "k", ":", "}", "}", "[", "k", "]", "b", "c", "d", "", "e", "f"}
+	if len(kinds) != len(expectedKinds) {
+		t.Fatalf("Expected %d tokens, got %q", len(expectedKinds), values)
+	}
+	for i := range kinds {
+		if kinds[i] != expectedKinds[i] || values[i] != expectedValues[i] {
+			t.Errorf("Expected token %d to be %q of type %d, got %q of type %d", i, expectedValues[i], expectedKinds[i], values[i], kinds[i])
+		}
+	}
+
+	if tokens := scan(t, `"\${x}$"`, false); len(tokens) != 1 || tokens[0].Value != "${x}$" {
+		t.Errorf("Expected an escaped interpolation, got %v", tokens)
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	for src, expected := range map[string]int64{
+		"0":                     0,
+		"1_000_000":             1000000,
+		"0xFF":                  255,
+		"0xdead_beef":           0xdeadbeef,
+		"0o17":                  15,
+		"0O1_7":                 15,
+		"0b1010":                10,
+		"0B1_0":                 2,
+		"9223372036854775807":   9223372036854775807,
+		"0x7fffffffffffffff":    9223372036854775807,
+		"0b1111111111111111111": 524287,
+	} {
+		tokens := scan(t, src, false)
+		if len(tokens) != 1 || tokens[0].Type != Integer {
+			t.Errorf("Expected %s to be a single integer, got %v", src, tokens)
+			continue
+		}
+		if v, err := ParseInteger(tokens[0].Value); err != nil || v != expected {
+			t.Errorf("Expected %s to be %d, got %d (%v)", src, expected, v, err)
+		}
+	}
+
+	for src, expected := range map[string]float64{
+		"1.5":     1.5,
+		"1e-9":    1e-9,
+		"6.02E23": 6.02e23,
+		"2e+3":    2000,
+		"1_0.2_5": 10.25,
+		"1e1_0":   1e10,
+	} {
+		tokens := scan(t, src, false)
+		if len(tokens) != 1 || tokens[0].Type != Float {
+			t.Errorf("Expected %s to be a single float, got %v", src, tokens)
+			continue
+		}
+		if v, err := ParseFloat(tokens[0].Value); err != nil || v != expected {
+			t.Errorf("Expected %s to be %g, got %g (%v)", src, expected, v, err)
+		}
+	}
+}
+
+func TestInvalidNumbers(t *testing.T) {
+	for src, reason := range map[string]string{
+		"1_":                  "'_' must separate digits",
+		"1__0":                "'_' must separate digits",
+		"0x_1":                "'_' must separate digits",
+		"0b_":                 "'_' must separate digits",
+		"1_.5":                "'_' must separate digits",
+		"1.5_":                "'_' must separate digits",
+		"1_e5":                "'_' must separate digits",
+		"0x":                  "invalid syntax",
+		"0xfg":                "invalid syntax",
+		"0o8":                 "invalid syntax",
+		"0b2":                 "invalid syntax",
+		"12abc":               "unexpected letter",
+		"9223372036854775808": "value out of range",
+		"0x8000000000000000":  "value out of range",
+		"1e400":               "value out of range",
+	} {
+		err := scanError(t, src)
+		if e, ok := err.(InvalidNumberError); !ok || e.Reason != reason || e.Line != 1 || e.Column != 1 {
+			t.Errorf("Expected %s to be invalid at 1:1 with %q, got %v", src, reason, err)
+		}
+	}
+
+	for _, src := range []string{"1.", "1.e5", "1e", "1e+"} {
+		if _, ok := scanError(t, src).(UnexpectedSymbolError); !ok {
+			t.Errorf("Expected %s to end with an unexpected symbol", src)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package lexer
 
+import "strconv"
+
 type TokenType int
 
 const (
@@ -11,6 +13,14 @@ const (
 	IfKeyword                     // if
 	ElseKeyword                   // else
 	WhileKeyword                  // while
+	ForKeyword                    // for
+	InKeyword                     // in
+	StructKeyword                 // struct
+	ClassKeyword                  // class
+	ThrowKeyword                  // throw
+	TryKeyword                    // try
+	CatchKeyword                  // catch
+	FinallyKeyword                // finally
 	TrueKeyword                   // true
 	FalseKeyword                  // false
 	NilKeyword                    // nil
@@ -31,6 +41,8 @@ const (
 	GeOperator                    // >=
 	Semicolon                     // ;
 	Comma                         // ,
+	Colon                         // :
+	Dot                           // .
 	LeftParen                     // (
 	RightParen                    // )
 	LeftBrace                     // {
@@ -40,20 +52,57 @@ const (
 	ID                            // Unicode letter followed by unicode letters or digits
 	Integer                       // Digits
 	Float                         // Real numbers
-	String                        // Arbitrary characters enclosed by quotation marks
+	String                        // Arbitrary characters enclosed by quotation marks or backticks
+	StringHead                    // Start of a string up to the first interpolation: "...${
+	StringMiddle                  // Part of a string between two interpolations: }...${
+	StringTail                    // End of a string after the last interpolation: }..."
+	Comment                       // Line or block comment, only emitted if Scanner.KeepComments is set
 )
 
+// Keywords maps the keywords to their token types. Keywords can't be used
+// as identifiers.
+var Keywords = map[string]TokenType{
+	"return":   ReturnKeyword,
+	"continue": ContinueKeyword,
+	"break":    BreakKeyword,
+	"func":     FunctionKeyword,
+	"if":       IfKeyword,
+	"else":     ElseKeyword,
+	"while":    WhileKeyword,
+	"for":      ForKeyword,
+	"in":       InKeyword,
+	"struct":   StructKeyword,
+	"class":    ClassKeyword,
+	"throw":    ThrowKeyword,
+	"try":      TryKeyword,
+	"catch":    CatchKeyword,
+	"finally":  FinallyKeyword,
+	"true":     TrueKeyword,
+	"false":    FalseKeyword,
+	"nil":      NilKeyword,
+}
+
 type Token struct {
-	Line, Column int
-	Type         TokenType
-	Value        string
+	Line, Column       int
+	EndLine, EndColumn int
+	Type               TokenType
+	Value              string
 }
 
 func (t Token) String() string {
-	if t.Type == String {
-		return "\"" + t.Value + "\""
-	}
-	if t.Type == EOF {
+	switch t.Type {
+	case String:
+		return strconv.Quote(t.Value)
+	case StringHead:
+		q := strconv.Quote(t.Value)
+		return q[:len(q)-1] + "${"
+	case StringMiddle:
+		q := strconv.Quote(t.Value)
+		return "}" + q[1:len(q)-1] + "${"
+	case StringTail:
+		q := strconv.Quote(t.Value)
+		return "}" + q[1:]
+	case EOF:
 		return "EOF"
 	}
 	return t.Value
@@ -0,0 +1,319 @@
+// Package lineedit reads lines from a terminal with basic editing: moving
+// the cursor, deleting words and lines and browsing a history that may be
+// kept in a file. If the input isn't a terminal, lines are read as they
+// are.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when Ctrl-C is pressed.
+var ErrInterrupted = errors.New("Interrupted")
+
+// MaxHistory is the number of lines kept in the history.
+const MaxHistory = 1000
+
+// Editor reads lines from a terminal.
+type Editor struct {
+	// Complete, if set, is called when Tab is pressed with the line and
+	// the cursor position, counted in runes. It returns the position the
+	// word being completed starts at and the words it may be completed to.
+	Complete func(line string, pos int) (int, []string)
+
+	in       *os.File
+	r        *bufio.Reader
+	out      io.Writer
+	history  []string
+	histFile string
+}
+
+// New returns an editor reading from in and echoing to out.
+func New(in *os.File, out io.Writer) *Editor {
+	return &Editor{in: in, r: bufio.NewReader(in), out: out}
+}
+
+// LoadHistory reads the history from path and appends lines added later
+// to it. A missing file is not an error.
+func (e *Editor) LoadHistory(path string) error {
+	e.histFile = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) > MaxHistory {
+		// Keep the file from growing forever
+		lines = lines[len(lines)-MaxHistory:]
+		if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+			return err
+		}
+	}
+	for _, l := range lines {
+		if l != "" {
+			e.history = append(e.history, l)
+		}
+	}
+	return nil
+}
+
+// AddHistory adds line to the end of the history unless it is empty or
+// repeats the last line.
+func (e *Editor) AddHistory(line string) error {
+	if strings.TrimSpace(line) == "" || len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return nil
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > MaxHistory {
+		e.history = e.history[1:]
+	}
+	if e.histFile == "" {
+		return nil
+	}
+	f, err := os.OpenFile(e.histFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadLine prints prompt and returns the line entered without its line
+// break. It returns io.EOF if the input ends or Ctrl-D is pressed on an
+// empty line and ErrInterrupted if Ctrl-C is pressed.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	restore, err := makeRaw(e.in)
+	if err != nil {
+		// Not a terminal
+		text, err := e.r.ReadString('\n')
+		if err != nil && (err != io.EOF || text == "") {
+			return "", err
+		}
+		return strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r"), nil
+	}
+	defer restore()
+
+	l := &line{e: e, prompt: prompt, history: len(e.history)}
+	for {
+		r, _, err := e.r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			l.pos = len(l.buf)
+			l.refresh()
+			fmt.Fprint(e.out, "\r\n")
+			return string(l.buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case 4: // Ctrl-D
+			if len(l.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			l.delete(l.pos, l.pos+1)
+		case 1: // Ctrl-A
+			l.pos = 0
+		case 5: // Ctrl-E
+			l.pos = len(l.buf)
+		case 2: // Ctrl-B
+			l.move(-1)
+		case 6: // Ctrl-F
+			l.move(1)
+		case 8, 127: // Backspace
+			if l.pos > 0 {
+				l.delete(l.pos-1, l.pos)
+			}
+		case 11: // Ctrl-K
+			l.delete(l.pos, len(l.buf))
+		case 21: // Ctrl-U
+			l.delete(0, l.pos)
+		case 23: // Ctrl-W
+			l.delete(l.wordStart(), l.pos)
+		case 12: // Ctrl-L
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case 16: // Ctrl-P
+			l.browse(-1)
+		case 14: // Ctrl-N
+			l.browse(1)
+		case '\t':
+			if e.Complete != nil {
+				l.complete()
+			} else {
+				l.insert(r)
+			}
+		case 27:
+			l.escape()
+		default:
+			if unicode.IsPrint(r) {
+				l.insert(r)
+			}
+		}
+		l.refresh()
+	}
+}
+
+// line is the state of a line being edited.
+type line struct {
+	e      *Editor
+	prompt string
+	buf    []rune
+	pos    int
+	// Index of the history entry shown, len(history) for the new line,
+	// which is kept in edited while browsing
+	history int
+	edited  []rune
+}
+
+func (l *line) refresh() {
+	fmt.Fprintf(l.e.out, "\r%s%s\x1b[K", l.prompt, string(l.buf))
+	if n := len(l.buf) - l.pos; n > 0 {
+		fmt.Fprintf(l.e.out, "\x1b[%dD", n)
+	}
+}
+
+func (l *line) insert(r rune) {
+	l.buf = append(l.buf[:l.pos], append([]rune{r}, l.buf[l.pos:]...)...)
+	l.pos++
+}
+
+// delete removes the runes from start to end, which are clamped to the
+// line.
+func (l *line) delete(start, end int) {
+	if end > len(l.buf) {
+		end = len(l.buf)
+	}
+	if start >= end {
+		return
+	}
+	l.buf = append(l.buf[:start], l.buf[end:]...)
+	l.pos = start
+}
+
+func (l *line) move(n int) {
+	l.pos += n
+	if l.pos < 0 {
+		l.pos = 0
+	}
+	if l.pos > len(l.buf) {
+		l.pos = len(l.buf)
+	}
+}
+
+// wordStart returns the start of the word before the cursor.
+func (l *line) wordStart() int {
+	i := l.pos
+	for i > 0 && unicode.IsSpace(l.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(l.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// browse replaces the line by the history entry n entries later.
+func (l *line) browse(n int) {
+	i := l.history + n
+	if i < 0 || i > len(l.e.history) {
+		return
+	}
+	if l.history == len(l.e.history) {
+		l.edited = l.buf
+	}
+	l.history = i
+	if i == len(l.e.history) {
+		l.buf = l.edited
+	} else {
+		l.buf = []rune(l.e.history[i])
+	}
+	l.pos = len(l.buf)
+}
+
+// complete extends the word before the cursor by the longest prefix common
+// to its completions. If that is not possible, the completions are listed.
+func (l *line) complete() {
+	start, words := l.e.Complete(string(l.buf), l.pos)
+	if len(words) == 0 || start < 0 || start > l.pos {
+		fmt.Fprint(l.e.out, "\a")
+		return
+	}
+	sort.Strings(words)
+	prefix := []rune(words[0])
+	for _, w := range words[1:] {
+		r := []rune(w)
+		i := 0
+		for i < len(prefix) && i < len(r) && prefix[i] == r[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+	if len(prefix) > l.pos-start {
+		rest := append(prefix, l.buf[l.pos:]...)
+		l.buf = append(l.buf[:start], rest...)
+		l.pos = start + len(prefix)
+		return
+	}
+	if len(words) > 1 {
+		fmt.Fprintf(l.e.out, "\r\n%s\r\n", strings.Join(words, "  "))
+	}
+}
+
+// escape handles the escape sequences sent by cursor and editing keys.
+func (l *line) escape() {
+	r, _, err := l.e.r.ReadRune()
+	if err != nil || r != '[' && r != 'O' {
+		return
+	}
+	param := ""
+	for {
+		r, _, err = l.e.r.ReadRune()
+		if err != nil {
+			return
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		param += string(r)
+	}
+	switch r {
+	case 'A':
+		l.browse(-1)
+	case 'B':
+		l.browse(1)
+	case 'C':
+		l.move(1)
+	case 'D':
+		l.move(-1)
+	case 'H':
+		l.pos = 0
+	case 'F':
+		l.pos = len(l.buf)
+	case '~':
+		switch param {
+		case "1", "7":
+			l.pos = 0
+		case "4", "8":
+			l.pos = len(l.buf)
+		case "3":
+			l.delete(l.pos, l.pos+1)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package lineedit
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw fails on systems without support for raw mode, so lines are read
+// without editing.
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("Raw mode is not supported")
+}
@@ -0,0 +1,217 @@
+package lsp
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+	"github.com/niklaskorz/nklang/semantics"
+)
+
+// document is an open source file.
+type document struct {
+	uri   string
+	lines [][]rune
+	// program is nil if the text can't be parsed. lastProgram is the most
+	// recent program that could be parsed, possibly for an older text.
+	program     *ast.Program
+	lastProgram *ast.Program
+	references  semantics.References
+	diagnostics []Diagnostic
+}
+
+// update parses and analyzes text as new content of d.
+func (d *document) update(text string, predefined []string) {
+	d.lines = nil
+	for _, line := range strings.Split(text, "\n") {
+		d.lines = append(d.lines, []rune(strings.TrimSuffix(line, "\r")))
+	}
+	d.diagnostics = []Diagnostic{}
+
+	s := lexer.NewScanner(strings.NewReader(text))
+	s.File = d.uri
+	p, err := parser.Parse(s)
+	d.program = p
+	if err != nil {
+		d.addError(err)
+		return
+	}
+	d.lastProgram = p
+
+	ds := semantics.NewScope()
+	for _, name := range predefined {
+		ds.Declare(name)
+	}
+	d.references = make(semantics.References)
+	ds.RecordReferences(d.references)
+	if err := semantics.AnalyzeLookupsWithScope(p, ds); err != nil {
+		d.addError(err)
+	}
+}
+
+// addError reports err as diagnostic at the position it occurred at.
+func (d *document) addError(err error) {
+	line, column := 1, 1
+	endLine, endColumn := 0, 0
+	message := err.Error()
+	switch e := err.(type) {
+	case *semantics.Error:
+		line, column, endLine, endColumn = e.Span.Line, e.Span.Column, e.Span.EndLine, e.Span.EndColumn
+		message = e.Message
+	case parser.UnexpectedTokenError:
+		line, column, endLine, endColumn = e.Token.Line, e.Token.Column, e.Token.EndLine, e.Token.EndColumn
+	case lexer.UnexpectedSymbolError:
+		line, column = e.Line, e.Column
+	case lexer.UnterminatedCommentError:
+		line, column = e.Line, e.Column
+	case lexer.UnterminatedStringError:
+		line, column = e.Line, e.Column
+	case lexer.InvalidEscapeError:
+		line, column = e.Line, e.Column
+	case lexer.InvalidNumberError:
+		line, column = e.Line, e.Column
+	}
+	// Lexer and parser errors start with their position, which the
+	// diagnostic's range already conveys
+	message = strings.TrimPrefix(message, ast.Span{File: d.uri, Line: line, Column: column}.Position()+": ")
+	if endLine < line || endLine == line && endColumn < column {
+		endLine, endColumn = line, column
+	}
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Range:    d.spanRange(ast.Span{Line: line, Column: column, EndLine: endLine, EndColumn: endColumn}),
+		Severity: severityError,
+		Source:   "nklg",
+		Message:  message,
+	})
+}
+
+// position converts a line and column as used by spans to a Position.
+func (d *document) position(line, column int) Position {
+	if line < 1 || line > len(d.lines) {
+		return Position{Line: line - 1, Character: column - 1}
+	}
+	runes := d.lines[line-1]
+	if column-1 > len(runes) {
+		column = len(runes) + 1
+	}
+	if column < 1 {
+		column = 1
+	}
+	return Position{Line: line - 1, Character: len(utf16.Encode(runes[:column-1]))}
+}
+
+// location converts p to the line and column used by spans.
+func (d *document) location(p Position) (int, int) {
+	if p.Line < 0 || p.Line >= len(d.lines) {
+		return p.Line + 1, p.Character + 1
+	}
+	units := 0
+	for i, r := range d.lines[p.Line] {
+		if units >= p.Character {
+			return p.Line + 1, i + 1
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return p.Line + 1, len(d.lines[p.Line]) + 1
+}
+
+// spanRange returns the range covering s, whose end is the last character.
+func (d *document) spanRange(s ast.Span) Range {
+	return Range{Start: d.position(s.Line, s.Column), End: d.position(s.EndLine, s.EndColumn+1)}
+}
+
+// nameSpan returns the span of the first occurrence of name as a whole word
+// within the span of n. If there is none, the span of n is returned.
+func (d *document) nameSpan(n ast.Node, name string) ast.Span {
+	s := n.Location()
+	word := []rune(name)
+	for line := s.Line; line <= s.EndLine && line <= len(d.lines); line++ {
+		runes := d.lines[line-1]
+		from := 0
+		if line == s.Line {
+			from = s.Column - 1
+		}
+		for i := from; i+len(word) <= len(runes); i++ {
+			if string(runes[i:i+len(word)]) != name {
+				continue
+			}
+			if i > 0 && isIdentifierRune(runes[i-1]) || i+len(word) < len(runes) && isIdentifierRune(runes[i+len(word)]) {
+				continue
+			}
+			return ast.Span{File: s.File, Line: line, Column: i + 1, EndLine: line, EndColumn: i + len(word)}
+		}
+	}
+	return s
+}
+
+// definitionSpan returns the span of the name declared by def.
+func (d *document) definitionSpan(def *semantics.Definition) ast.Span {
+	if c, ok := def.Node.(*ast.ClassDeclaration); ok && (def.Name == "self" || def.Name == "super") {
+		// self and super are declared implicitly by their class
+		return d.nameSpan(c, c.Name)
+	}
+	return d.nameSpan(def.Node, def.Name)
+}
+
+func isIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// identifierAt returns the node referring to or declaring a variable at the
+// given line and column, along with the span of the variable name in it.
+func (d *document) identifierAt(line, column int) (ast.Node, ast.Span) {
+	if d.program == nil {
+		return nil, ast.Span{}
+	}
+	var found ast.Node
+	var span ast.Span
+	for _, n := range d.program.Statements {
+		walk(n, func(n ast.Node) bool {
+			if !contains(n.Location(), line, column) {
+				return false
+			}
+			var name string
+			switch n := n.(type) {
+			case *ast.LookupExpression:
+				name = n.Identifier
+			case *ast.AssignmentStatement:
+				name = n.Identifier
+			case *ast.DeclarationStatement:
+				name = n.Identifier
+			default:
+				return true
+			}
+			s := n.Location()
+			s.EndLine, s.EndColumn = s.Line, s.Column+len([]rune(name))-1
+			if contains(s, line, column) {
+				found, span = n, s
+			}
+			return true
+		})
+	}
+	return found, span
+}
+
+// definition returns the definition of the variable used or declared by n.
+func (d *document) definition(n ast.Node) *semantics.Definition {
+	if def, ok := d.references[n]; ok {
+		return def
+	}
+	if n, ok := n.(*ast.DeclarationStatement); ok {
+		return &semantics.Definition{Name: n.Identifier, Node: n}
+	}
+	return nil
+}
+
+// contains reports whether the given line and column lie within s. The
+// position directly after s counts as well, as that is where the cursor
+// rests after typing a name.
+func contains(s ast.Span, line, column int) bool {
+	if line < s.Line || line == s.Line && column < s.Column {
+		return false
+	}
+	return line < s.EndLine || line == s.EndLine && column <= s.EndColumn+1
+}
@@ -0,0 +1,355 @@
+// Package lsp implements a Language Server Protocol server for nklang. It
+// publishes the errors found by parsing and semantic analysis as
+// diagnostics and offers go to definition, hover, document symbols and
+// completion.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/semantics"
+)
+
+// Server is a language server communicating over a pair of streams.
+type Server struct {
+	predefined []string
+	documents  map[string]*document
+	w          io.Writer
+	shutdown   bool
+}
+
+// NewServer returns a server for programs in which the names in predefined
+// are declared.
+func NewServer(predefined []string) *Server {
+	return &Server{predefined: predefined, documents: make(map[string]*document)}
+}
+
+// Serve reads requests from r and writes responses to w until the client
+// sends the exit notification or r is closed.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	rd := textproto.NewReader(bufio.NewReader(r))
+	for {
+		header, err := rd.ReadMIMEHeader()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			return fmt.Errorf("Invalid Content-Length: %s", header.Get("Content-Length"))
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(rd.R, body); err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.reply(nil, nil, &responseError{Code: parseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("Exit without shutdown")
+			}
+			return nil
+		}
+		result, rerr := s.handle(req)
+		if req.ID == nil {
+			// Notifications get no response
+			continue
+		}
+		if err := s.reply(req.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) write(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, err *responseError) error {
+	if err != nil {
+		return s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: *err})
+	}
+	return s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle dispatches req and returns its result.
+func (s *Server) handle(req request) (interface{}, *responseError) {
+	var params interface{}
+	var handler func() (interface{}, error)
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// Columns are converted from runes to UTF-16 code units,
+				// which every client supports
+				"positionEncoding":       "utf-16",
+				"textDocumentSync":       1,
+				"definitionProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider":     map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "nklg"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		p := &didOpenParams{}
+		params, handler = p, func() (interface{}, error) {
+			return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		p := &didChangeParams{}
+		params, handler = p, func() (interface{}, error) {
+			if len(p.ContentChanges) == 0 {
+				return nil, nil
+			}
+			return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		p := &documentParams{}
+		params, handler = p, func() (interface{}, error) {
+			delete(s.documents, p.TextDocument.URI)
+			return nil, s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+	case "textDocument/definition":
+		p := &textDocumentPositionParams{}
+		params, handler = p, func() (interface{}, error) {
+			return s.definition(p), nil
+		}
+	case "textDocument/hover":
+		p := &textDocumentPositionParams{}
+		params, handler = p, func() (interface{}, error) {
+			return s.hover(p), nil
+		}
+	case "textDocument/documentSymbol":
+		p := &documentParams{}
+		params, handler = p, func() (interface{}, error) {
+			return s.documentSymbols(p), nil
+		}
+	case "textDocument/completion":
+		p := &textDocumentPositionParams{}
+		params, handler = p, func() (interface{}, error) {
+			return s.completion(p), nil
+		}
+	default:
+		if req.ID == nil || strings.HasPrefix(req.Method, "$/") {
+			return nil, nil
+		}
+		return nil, &responseError{Code: methodNotFound, Message: "Unknown method " + req.Method}
+	}
+
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return nil, &responseError{Code: invalidParams, Message: err.Error()}
+	}
+	result, err := handler()
+	if err != nil {
+		return nil, &responseError{Code: invalidParams, Message: err.Error()}
+	}
+	return result, nil
+}
+
+// update sets the text of the document uri and publishes its diagnostics.
+func (s *Server) update(uri string, text string) error {
+	d, ok := s.documents[uri]
+	if !ok {
+		d = &document{uri: uri}
+		s.documents[uri] = d
+	}
+	d.update(text, s.predefined)
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: d.diagnostics})
+}
+
+func (s *Server) definition(p *textDocumentPositionParams) interface{} {
+	d, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	n, _ := d.identifierAt(d.location(p.Position))
+	if n == nil {
+		return nil
+	}
+	def := d.definition(n)
+	if def == nil || def.Node == nil {
+		return nil
+	}
+	return Location{URI: d.uri, Range: d.spanRange(d.definitionSpan(def))}
+}
+
+func (s *Server) hover(p *textDocumentPositionParams) interface{} {
+	d, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	n, span := d.identifierAt(d.location(p.Position))
+	if n == nil {
+		return nil
+	}
+	def := d.definition(n)
+	if def == nil {
+		return nil
+	}
+	text := "```nklang\n" + signature(def) + "\n```"
+	if def.Node != nil {
+		text += fmt.Sprintf("\n\n%s, declared at line %d", describe(def), d.definitionSpan(def).Line)
+	} else {
+		text += "\n\nPredefined"
+	}
+	return hover{Contents: markupContent{Kind: "markdown", Value: text}, Range: d.spanRange(span)}
+}
+
+// signature returns a one line summary of the declaration of def.
+func signature(def *semantics.Definition) string {
+	switch n := def.Node.(type) {
+	case nil:
+		return def.Name
+	case *ast.DeclarationStatement:
+		if f, ok := n.Value.(*ast.Function); ok {
+			return fmt.Sprintf("%s := func(%s)", def.Name, strings.Join(f.Parameters, ", "))
+		}
+	case *ast.StructDeclaration:
+		return fmt.Sprintf("struct %s { %s }", n.Name, strings.Join(n.Fields, ", "))
+	case *ast.ClassDeclaration:
+		if def.Name == "self" || def.Name == "super" {
+			return def.Name
+		}
+		if n.Superclass != nil {
+			return fmt.Sprintf("class %s : %s", n.Name, n.Superclass.Identifier)
+		}
+		return "class " + n.Name
+	}
+	return def.Name
+}
+
+// describe tells what kind of variable def declares.
+func describe(def *semantics.Definition) string {
+	switch n := def.Node.(type) {
+	case *ast.DeclarationStatement:
+		if _, ok := n.Value.(*ast.Function); ok {
+			return "Function"
+		}
+		return "Variable"
+	case *ast.Function:
+		if n.Name != "" {
+			return "Parameter of " + n.Name
+		}
+		return "Parameter"
+	case *ast.ForStatement:
+		return "Loop variable"
+	case *ast.CatchClause:
+		return "Caught error"
+	case *ast.StructDeclaration:
+		return "Struct"
+	case *ast.ClassDeclaration:
+		if def.Name == "self" || def.Name == "super" {
+			return "Instance of class " + n.Name
+		}
+		return "Class"
+	}
+	return "Variable"
+}
+
+func (s *Server) documentSymbols(p *documentParams) interface{} {
+	d, ok := s.documents[p.TextDocument.URI]
+	if !ok || d.program == nil {
+		return []DocumentSymbol{}
+	}
+	return d.symbols(d.program.Statements)
+}
+
+// symbols returns the declarations in statements, including those in the
+// bodies of declared functions as children.
+func (d *document) symbols(statements []ast.Statement) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, n := range statements {
+		switch n := n.(type) {
+		case *ast.DeclarationStatement:
+			sym := DocumentSymbol{Name: n.Identifier, Kind: symbolVariable, Range: d.spanRange(n.Span), SelectionRange: d.spanRange(d.nameSpan(n, n.Identifier))}
+			if f, ok := n.Value.(*ast.Function); ok {
+				sym.Kind = symbolFunction
+				sym.Children = d.symbols(f.Statements)
+			}
+			symbols = append(symbols, sym)
+		case *ast.StructDeclaration:
+			symbols = append(symbols, DocumentSymbol{Name: n.Name, Kind: symbolStruct, Range: d.spanRange(n.Span), SelectionRange: d.spanRange(d.nameSpan(n, n.Name))})
+		case *ast.ClassDeclaration:
+			sym := DocumentSymbol{Name: n.Name, Kind: symbolClass, Range: d.spanRange(n.Span), SelectionRange: d.spanRange(d.nameSpan(n, n.Name))}
+			for _, m := range n.Methods {
+				sym.Children = append(sym.Children, DocumentSymbol{
+					Name:           m.Name,
+					Kind:           symbolMethod,
+					Range:          d.spanRange(m.Span),
+					SelectionRange: d.spanRange(d.nameSpan(m, m.Name)),
+					Children:       d.symbols(m.Statements),
+				})
+			}
+			symbols = append(symbols, sym)
+		}
+	}
+	return symbols
+}
+
+func (s *Server) completion(p *textDocumentPositionParams) interface{} {
+	items := []CompletionItem{}
+	d, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return items
+	}
+
+	seen := make(map[string]bool)
+	if d.lastProgram != nil {
+		line, column := d.location(p.Position)
+		for _, def := range visible(d.lastProgram, line, column) {
+			if seen[def.Name] {
+				continue
+			}
+			seen[def.Name] = true
+			item := CompletionItem{Label: def.Name, Kind: completionVariable, Detail: signature(def)}
+			switch def.Node.(type) {
+			case *ast.StructDeclaration:
+				item.Kind = completionStruct
+			case *ast.ClassDeclaration:
+				if def.Name != "self" && def.Name != "super" {
+					item.Kind = completionClass
+				}
+			case *ast.DeclarationStatement:
+				if describe(def) == "Function" {
+					item.Kind = completionFunction
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	for _, name := range s.predefined {
+		if !seen[name] {
+			items = append(items, CompletionItem{Label: name, Kind: completionFunction, Detail: "predefined"})
+		}
+	}
+	return items
+}
@@ -0,0 +1,217 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strconv"
+	"testing"
+
+	"github.com/niklaskorz/nklang/builtins"
+)
+
+// client scripts a session with the server: it collects the messages sent
+// to the server and decodes the ones the server sent back.
+type client struct {
+	in     bytes.Buffer
+	nextID int
+}
+
+func (c *client) send(t *testing.T, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(&c.in, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// request sends a request and returns its ID.
+func (c *client) request(t *testing.T, method string, params interface{}) int {
+	c.nextID++
+	c.send(t, map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	return c.nextID
+}
+
+func (c *client) notify(t *testing.T, method string, params interface{}) {
+	c.send(t, map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// message is a response or notification sent by the server.
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// run serves the scripted session and returns the messages of the server.
+func (c *client) run(t *testing.T) []message {
+	var out bytes.Buffer
+	if err := NewServer(builtins.Names()).Serve(&c.in, &out); err != nil {
+		t.Fatal(err)
+	}
+	var messages []message
+	rd := textproto.NewReader(bufio.NewReader(&out))
+	for {
+		header, err := rd.ReadMIMEHeader()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(rd.R, body); err != nil {
+			t.Fatal(err)
+		}
+		var m message
+		if err := json.Unmarshal(body, &m); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+}
+
+// result decodes the result of the response to request id into v.
+func result(t *testing.T, messages []message, id int, v interface{}) {
+	t.Helper()
+	for _, m := range messages {
+		if m.ID == nil || *m.ID != id {
+			continue
+		}
+		if m.Error != nil {
+			t.Fatalf("Request %d failed: %s", id, m.Error.Message)
+		}
+		if err := json.Unmarshal(m.Result, v); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	t.Fatalf("No response to request %d", id)
+}
+
+// diagnostics returns the diagnostics published for uri, in order.
+func diagnostics(t *testing.T, messages []message, uri string) [][]Diagnostic {
+	var published [][]Diagnostic
+	for _, m := range messages {
+		if m.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var p publishDiagnosticsParams
+		if err := json.Unmarshal(m.Params, &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.URI == uri {
+			published = append(published, p.Diagnostics)
+		}
+	}
+	return published
+}
+
+func position(line, character int) map[string]interface{} {
+	return map[string]interface{}{"line": line, "character": character}
+}
+
+func TestSession(t *testing.T) {
+	example, err := ioutil.ReadFile("../example.nk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const uri = "file:///example.nk"
+	const broken = "file:///broken.nk"
+	doc := map[string]interface{}{"uri": uri}
+
+	c := &client{}
+	initialize := c.request(t, "initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.notify(t, "initialized", map[string]interface{}{})
+	c.notify(t, "textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "nklang", "version": 1, "text": string(example)},
+	})
+	// add in line 28: println(add(50, 30));
+	definition := c.request(t, "textDocument/definition", map[string]interface{}{"textDocument": doc, "position": position(27, 9)})
+	hovered := c.request(t, "textDocument/hover", map[string]interface{}{"textDocument": doc, "position": position(27, 9)})
+	symbols := c.request(t, "textDocument/documentSymbol", map[string]interface{}{"textDocument": doc})
+	completion := c.request(t, "textDocument/completion", map[string]interface{}{"textDocument": doc, "position": position(27, 0)})
+	c.notify(t, "textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": broken, "languageId": "nklang", "version": 1, "text": "s := \"😀\"; missing;\n"},
+	})
+	c.notify(t, "textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": broken, "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": "s := \"😀\"; s;\n"}},
+	})
+	unknown := c.request(t, "textDocument/unknown", map[string]interface{}{})
+	shutdown := c.request(t, "shutdown", nil)
+	c.notify(t, "exit", nil)
+	messages := c.run(t)
+
+	var capabilities struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	result(t, messages, initialize, &capabilities)
+	if capabilities.Capabilities["positionEncoding"] != "utf-16" {
+		t.Errorf("Expected position encoding utf-16, got %v", capabilities.Capabilities["positionEncoding"])
+	}
+
+	if published := diagnostics(t, messages, uri); len(published) != 1 || len(published[0]) != 0 {
+		t.Errorf("Expected no diagnostics for example.nk, got %v", published)
+	}
+
+	var loc Location
+	result(t, messages, definition, &loc)
+	expectedRange := Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 1, Character: 3}}
+	if loc.URI != uri || loc.Range != expectedRange {
+		t.Errorf("Expected definition of add at %v, got %v", expectedRange, loc)
+	}
+
+	var h hover
+	result(t, messages, hovered, &h)
+	if expected := "```nklang\nadd := func(a, b)\n```\n\nFunction, declared at line 2"; h.Contents.Value != expected {
+		t.Errorf("Expected hover %q, got %q", expected, h.Contents.Value)
+	}
+
+	var syms []DocumentSymbol
+	result(t, messages, symbols, &syms)
+	if len(syms) == 0 || syms[0].Name != "add" || syms[0].Kind != symbolFunction {
+		t.Errorf("Expected function add as first symbol, got %v", syms)
+	}
+
+	var items []CompletionItem
+	result(t, messages, completion, &items)
+	found := map[string]bool{}
+	for _, item := range items {
+		found[item.Label] = true
+	}
+	if !found["add"] || !found["println"] || found["isCool"] {
+		t.Errorf("Expected add and println but not isCool to complete, got %v", items)
+	}
+
+	// The emoji takes two UTF-16 code units but is a single column
+	published := diagnostics(t, messages, broken)
+	if len(published) != 2 || len(published[0]) != 1 || len(published[1]) != 0 {
+		t.Fatalf("Expected one diagnostic that is fixed by the change, got %v", published)
+	}
+	d := published[0][0]
+	expectedRange = Range{Start: Position{Line: 0, Character: 11}, End: Position{Line: 0, Character: 18}}
+	if d.Range != expectedRange || d.Message != "missing must be declared before usage" {
+		t.Errorf("Expected diagnostic %q at %v, got %q at %v", "missing must be declared before usage", expectedRange, d.Message, d.Range)
+	}
+
+	for _, m := range messages {
+		if m.ID != nil && *m.ID == unknown {
+			if m.Error == nil || m.Error.Code != methodNotFound {
+				t.Errorf("Expected unknown method to fail with %d, got %v", methodNotFound, m.Error)
+			}
+		}
+	}
+	var nothing interface{}
+	result(t, messages, shutdown, &nothing)
+}
@@ -0,0 +1,209 @@
+package lsp
+
+import (
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/semantics"
+)
+
+// children returns the statements and expressions directly contained in n,
+// in source order.
+func children(n ast.Node) []ast.Node {
+	var c []ast.Node
+	add := func(n ast.Node) {
+		c = append(c, n)
+	}
+	addStatements := func(statements []ast.Statement) {
+		for _, s := range statements {
+			add(s)
+		}
+	}
+	addExpressions := func(expressions []ast.Expression) {
+		for _, e := range expressions {
+			add(e)
+		}
+	}
+
+	switch n := n.(type) {
+	case *ast.IfStatement:
+		if n.Condition != nil {
+			add(n.Condition)
+		}
+		addStatements(n.Statements)
+		if n.ElseBranch != nil {
+			add(n.ElseBranch)
+		}
+	case *ast.WhileStatement:
+		add(n.Condition)
+		addStatements(n.Statements)
+	case *ast.ForStatement:
+		add(n.Iterable)
+		addStatements(n.Statements)
+	case *ast.ClassDeclaration:
+		if n.Superclass != nil {
+			add(n.Superclass)
+		}
+		for _, m := range n.Methods {
+			add(m)
+		}
+	case *ast.TryStatement:
+		addStatements(n.Statements)
+		if n.Catch != nil {
+			add(n.Catch)
+		}
+		addStatements(n.Finally)
+	case *ast.CatchClause:
+		addStatements(n.Statements)
+	case *ast.ExpressionStatement:
+		add(n.Expression)
+	case *ast.DeclarationStatement:
+		add(n.Value)
+	case *ast.AssignmentStatement:
+		add(n.Value)
+	case *ast.SubscriptAssignmentStatement:
+		addExpressions([]ast.Expression{n.Target, n.Index, n.Value})
+	case *ast.MemberAssignmentStatement:
+		addExpressions([]ast.Expression{n.Target, n.Value})
+	case *ast.ReturnStatement:
+		add(n.Expression)
+	case *ast.ThrowStatement:
+		add(n.Expression)
+	case *ast.IfExpression:
+		if n.Condition != nil {
+			add(n.Condition)
+		}
+		add(n.Value)
+		if n.ElseBranch != nil {
+			add(n.ElseBranch)
+		}
+	case *ast.BinaryOperationExpression:
+		addExpressions([]ast.Expression{n.A, n.B})
+	case *ast.UnaryOperationExpression:
+		add(n.A)
+	case *ast.CallExpression:
+		add(n.Callee)
+		addExpressions(n.Parameters)
+	case *ast.SubscriptExpression:
+		addExpressions([]ast.Expression{n.Target, n.Index})
+	case *ast.MemberExpression:
+		add(n.Target)
+	case *ast.MapExpression:
+		for _, e := range n.Entries {
+			addExpressions([]ast.Expression{e.Key, e.Value})
+		}
+	case *ast.ArrayExpression:
+		addExpressions(n.Items)
+	case *ast.InterpolatedString:
+		addExpressions(n.Parts)
+	case *ast.Function:
+		addStatements(n.Statements)
+	}
+	return c
+}
+
+// walk calls f for n and, as long as f returns true, for the nodes contained
+// in n.
+func walk(n ast.Node, f func(ast.Node) bool) {
+	if !f(n) {
+		return
+	}
+	for _, c := range children(n) {
+		walk(c, f)
+	}
+}
+
+// visible returns the definitions declared before the given line and column
+// in the scopes enclosing it, innermost first. Predefined names aren't
+// included.
+func visible(p *ast.Program, line, column int) []*semantics.Definition {
+	v := &visibility{line: line, column: column}
+	v.statements(p.Statements)
+	defs := make([]*semantics.Definition, len(v.defs))
+	for i, d := range v.defs {
+		defs[len(defs)-1-i] = d
+	}
+	return defs
+}
+
+type visibility struct {
+	line, column int
+	defs         []*semantics.Definition
+}
+
+func (v *visibility) declare(name string, n ast.Node) {
+	v.defs = append(v.defs, &semantics.Definition{Name: name, Node: n})
+}
+
+func (v *visibility) statements(statements []ast.Statement) {
+	for _, n := range statements {
+		s := n.Location()
+		if v.line < s.Line || v.line == s.Line && v.column < s.Column {
+			return
+		}
+		switch n := n.(type) {
+		case *ast.DeclarationStatement:
+			v.declare(n.Identifier, n)
+		case *ast.StructDeclaration:
+			v.declare(n.Name, n)
+		case *ast.ClassDeclaration:
+			v.declare(n.Name, n)
+		}
+		if contains(s, v.line, v.column) {
+			v.node(n)
+		}
+	}
+}
+
+// node adds the definitions of the scopes in n enclosing the position.
+func (v *visibility) node(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.IfStatement:
+		if n.ElseBranch != nil && contains(n.ElseBranch.Location(), v.line, v.column) {
+			v.node(n.ElseBranch)
+			return
+		}
+		v.statements(n.Statements)
+	case *ast.WhileStatement:
+		v.statements(n.Statements)
+	case *ast.ForStatement:
+		if n.IndexIdentifier != "" {
+			v.declare(n.IndexIdentifier, n)
+		}
+		v.declare(n.ValueIdentifier, n)
+		v.statements(n.Statements)
+	case *ast.ClassDeclaration:
+		for _, m := range n.Methods {
+			if contains(m.Location(), v.line, v.column) {
+				v.declare("self", n)
+				if n.Superclass != nil {
+					v.declare("super", n)
+				}
+				v.node(m)
+			}
+		}
+	case *ast.TryStatement:
+		if n.Catch != nil && contains(n.Catch.Location(), v.line, v.column) {
+			v.declare(n.Catch.Identifier, n.Catch)
+			v.statements(n.Catch.Statements)
+			return
+		}
+		if len(n.Finally) > 0 {
+			if s := n.Finally[0].Location(); v.line > s.Line || v.line == s.Line && v.column >= s.Column {
+				v.statements(n.Finally)
+				return
+			}
+		}
+		v.statements(n.Statements)
+	case *ast.Function:
+		for _, p := range n.Parameters {
+			v.declare(p, n)
+		}
+		v.statements(n.Statements)
+	default:
+		for _, c := range children(n) {
+			if contains(c.Location(), v.line, v.column) {
+				v.node(c)
+				return
+			}
+		}
+	}
+}
@@ -3,18 +3,23 @@ package parser
 import (
 	"fmt"
 
+	"github.com/niklaskorz/nklang/ast"
 	"github.com/niklaskorz/nklang/lexer"
 )
 
 type UnexpectedTokenError struct {
+	// File the token was read from
+	File     string
 	Token    *lexer.Token
 	Expected string
 }
 
 func (e UnexpectedTokenError) Error() string {
-	return fmt.Sprintf("Unexpected token at line %d, column %d: %s (expected %s)", e.Token.Line, e.Token.Column, e.Token, e.Expected)
+	position := ast.Span{File: e.File, Line: e.Token.Line, Column: e.Token.Column}.Position()
+	return fmt.Sprintf("%s: Unexpected token %s (expected %s)", position, e.Token, e.Expected)
 }
 
-func unexpectedToken(token *lexer.Token, expected string) UnexpectedTokenError {
-	return UnexpectedTokenError{Token: token, Expected: expected}
+// unexpectedToken reports the current token of s as unexpected.
+func unexpectedToken(s *lexer.Scanner, expected string) UnexpectedTokenError {
+	return UnexpectedTokenError{File: s.File, Token: s.Token, Expected: expected}
 }
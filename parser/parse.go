@@ -1,9 +1,6 @@
 package parser
 
 import (
-	"strconv"
-	"strings"
-
 	"github.com/niklaskorz/nklang/ast"
 	"github.com/niklaskorz/nklang/lexer"
 )
@@ -44,18 +41,51 @@ func parseStatement(s *lexer.Scanner) (ast.Statement, error) {
 		return n, nil
 	}
 
+	if s.Token.Type == lexer.ForKeyword {
+		n, err := parseForStatement(s)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+
+	if s.Token.Type == lexer.StructKeyword {
+		n, err := parseStructDeclaration(s)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+
+	if s.Token.Type == lexer.ClassKeyword {
+		n, err := parseClassDeclaration(s)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+
+	if s.Token.Type == lexer.TryKeyword {
+		n, err := parseTryStatement(s)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+
 	var n ast.Statement
+	start := s.Token
 
 	if s.Token.Type == lexer.ContinueKeyword {
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
-		n = &ast.ContinueStatement{}
+		n = &ast.ContinueStatement{Span: spanFrom(s, start)}
 	} else if s.Token.Type == lexer.BreakKeyword {
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
-		n = &ast.BreakStatement{}
+		n = &ast.BreakStatement{Span: spanFrom(s, start)}
 	} else if s.Token.Type == lexer.ReturnKeyword {
 		if err := s.ReadNext(); err != nil {
 			return nil, err
@@ -64,7 +94,16 @@ func parseStatement(s *lexer.Scanner) (ast.Statement, error) {
 		if err != nil {
 			return nil, err
 		}
-		n = &ast.ReturnStatement{Expression: e}
+		n = &ast.ReturnStatement{Span: spanFrom(s, start), Expression: e}
+	} else if s.Token.Type == lexer.ThrowKeyword {
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		e, err := parseExpression(s)
+		if err != nil {
+			return nil, err
+		}
+		n = &ast.ThrowStatement{Span: spanFrom(s, start), Expression: e}
 	} else if s.Token.Type == lexer.ID {
 		identifier := s.Token.Value
 		if err := s.ReadNext(); err != nil {
@@ -78,7 +117,10 @@ func parseStatement(s *lexer.Scanner) (ast.Statement, error) {
 			if err != nil {
 				return nil, err
 			}
-			n = &ast.DeclarationStatement{Identifier: identifier, Value: v}
+			if f, ok := v.(*ast.Function); ok {
+				f.Name = identifier
+			}
+			n = &ast.DeclarationStatement{Span: spanFrom(s, start), Identifier: identifier, Value: v}
 		} else if s.Token.Type == lexer.AssignmentOperator {
 			if err := s.ReadNext(); err != nil {
 				return nil, err
@@ -87,27 +129,27 @@ func parseStatement(s *lexer.Scanner) (ast.Statement, error) {
 			if err != nil {
 				return nil, err
 			}
-			n = &ast.AssignmentStatement{Identifier: identifier, Value: v}
+			n = &ast.AssignmentStatement{Span: spanFrom(s, start), Identifier: identifier, Value: v}
 		} else {
 			if err := s.Unread(); err != nil {
 				return nil, err
 			}
-			e, err := parseExpression(s)
+			e, err := parseExpressionStatement(s)
 			if err != nil {
 				return nil, err
 			}
-			n = &ast.ExpressionStatement{Expression: e}
+			n = e
 		}
 	} else {
-		e, err := parseExpression(s)
+		e, err := parseExpressionStatement(s)
 		if err != nil {
 			return nil, err
 		}
-		n = &ast.ExpressionStatement{Expression: e}
+		n = e
 	}
 
 	if s.Token.Type != lexer.Semicolon {
-		return nil, unexpectedToken(s.Token, ";")
+		return nil, unexpectedToken(s, ";")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -115,9 +157,56 @@ func parseStatement(s *lexer.Scanner) (ast.Statement, error) {
 	return n, nil
 }
 
+// parseExpressionStatement parses an expression used as statement, or an
+// assignment if the expression is followed by "=" and can be assigned to.
+func parseExpressionStatement(s *lexer.Scanner) (ast.Statement, error) {
+	e, err := parseExpression(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Token.Type != lexer.AssignmentOperator {
+		return &ast.ExpressionStatement{Span: e.Location(), Expression: e}, nil
+	}
+
+	switch target := e.(type) {
+	case *ast.SubscriptExpression:
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		v, err := parseExpression(s)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.SubscriptAssignmentStatement{
+			Span:   extendSpan(s, e.Location()),
+			Target: target.Target,
+			Index:  target.Index,
+			Value:  v,
+		}, nil
+	case *ast.MemberExpression:
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		v, err := parseExpression(s)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.MemberAssignmentStatement{
+			Span:   extendSpan(s, e.Location()),
+			Target: target.Target,
+			Name:   target.Name,
+			Value:  v,
+		}, nil
+	}
+
+	return nil, unexpectedToken(s, ";")
+}
+
 func parseIfStatement(s *lexer.Scanner) (*ast.IfStatement, error) {
+	start := s.Token
 	if s.Token.Type != lexer.IfKeyword {
-		return nil, unexpectedToken(s.Token, "if")
+		return nil, unexpectedToken(s, "if")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -133,7 +222,7 @@ func parseIfStatement(s *lexer.Scanner) (*ast.IfStatement, error) {
 		return nil, err
 	}
 
-	n := &ast.IfStatement{Condition: e, Statements: statements}
+	n := &ast.IfStatement{Span: spanFrom(s, start), Condition: e, Statements: statements}
 
 	if s.Token.Type == lexer.ElseKeyword {
 		if err := s.ReadNext(); err != nil {
@@ -147,20 +236,74 @@ func parseIfStatement(s *lexer.Scanner) (*ast.IfStatement, error) {
 			}
 			n.ElseBranch = elseBranch
 		} else if s.Token.Type == lexer.LeftBrace {
+			blockStart := s.Token
 			statements, err := parseStatementBlock(s)
 			if err != nil {
 				return nil, err
 			}
-			n.ElseBranch = &ast.IfStatement{Statements: statements}
+			n.ElseBranch = &ast.IfStatement{Span: spanFrom(s, blockStart), Statements: statements}
 		}
+		n.Span = spanFrom(s, start)
 	}
 
 	return n, nil
 }
 
 func parseWhileStatement(s *lexer.Scanner) (*ast.WhileStatement, error) {
+	start := s.Token
 	if s.Token.Type != lexer.WhileKeyword {
-		return nil, unexpectedToken(s.Token, "while")
+		return nil, unexpectedToken(s, "while")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	e, err := parseExpression(s)
+	if err != nil {
+		return nil, err
+	}
+
+	statements, err := parseStatementBlock(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.WhileStatement{Span: spanFrom(s, start), Condition: e, Statements: statements}, nil
+}
+
+func parseForStatement(s *lexer.Scanner) (*ast.ForStatement, error) {
+	start := s.Token
+	if s.Token.Type != lexer.ForKeyword {
+		return nil, unexpectedToken(s, "for")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	if s.Token.Type != lexer.ID {
+		return nil, unexpectedToken(s, "ID")
+	}
+	n := &ast.ForStatement{ValueIdentifier: s.Token.Value}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	if s.Token.Type == lexer.Comma {
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		if s.Token.Type != lexer.ID {
+			return nil, unexpectedToken(s, "ID")
+		}
+		n.IndexIdentifier = n.ValueIdentifier
+		n.ValueIdentifier = s.Token.Value
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Token.Type != lexer.InKeyword {
+		return nil, unexpectedToken(s, "in")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -170,18 +313,209 @@ func parseWhileStatement(s *lexer.Scanner) (*ast.WhileStatement, error) {
 	if err != nil {
 		return nil, err
 	}
+	n.Iterable = e
+
+	statements, err := parseStatementBlock(s)
+	if err != nil {
+		return nil, err
+	}
+	n.Statements = statements
+	n.Span = spanFrom(s, start)
+
+	return n, nil
+}
+
+func parseStructDeclaration(s *lexer.Scanner) (*ast.StructDeclaration, error) {
+	start := s.Token
+	if s.Token.Type != lexer.StructKeyword {
+		return nil, unexpectedToken(s, "struct")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	if s.Token.Type != lexer.ID {
+		return nil, unexpectedToken(s, "ID")
+	}
+	name := s.Token.Value
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	if s.Token.Type != lexer.LeftBrace {
+		return nil, unexpectedToken(s, "{")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	fields := []string{}
+
+	for s.Token.Type == lexer.ID {
+		fields = append(fields, s.Token.Value)
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+
+		if s.Token.Type != lexer.Comma {
+			break
+		}
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Token.Type != lexer.RightBrace {
+		return nil, unexpectedToken(s, "}")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	return &ast.StructDeclaration{Span: spanFrom(s, start), Name: name, Fields: fields}, nil
+}
+
+func parseClassDeclaration(s *lexer.Scanner) (*ast.ClassDeclaration, error) {
+	start := s.Token
+	if s.Token.Type != lexer.ClassKeyword {
+		return nil, unexpectedToken(s, "class")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	if s.Token.Type != lexer.ID {
+		return nil, unexpectedToken(s, "ID")
+	}
+	n := &ast.ClassDeclaration{Name: s.Token.Value}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	if s.Token.Type == lexer.Colon {
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		if s.Token.Type != lexer.ID {
+			return nil, unexpectedToken(s, "ID")
+		}
+		n.Superclass = &ast.LookupExpression{Span: tokenSpan(s, s.Token), Identifier: s.Token.Value}
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Token.Type != lexer.LeftBrace {
+		return nil, unexpectedToken(s, "{")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	n.Methods = []*ast.Function{}
+
+	for s.Token.Type == lexer.ID {
+		methodStart := s.Token
+		name := s.Token.Value
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+
+		parameters, err := parseParameters(s)
+		if err != nil {
+			return nil, err
+		}
+
+		statements, err := parseStatementBlock(s)
+		if err != nil {
+			return nil, err
+		}
+
+		n.Methods = append(n.Methods, &ast.Function{
+			Span:       spanFrom(s, methodStart),
+			Name:       name,
+			Parameters: parameters,
+			Statements: statements,
+		})
+	}
+
+	if s.Token.Type != lexer.RightBrace {
+		return nil, unexpectedToken(s, "}")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	n.Span = spanFrom(s, start)
+	return n, nil
+}
+
+func parseTryStatement(s *lexer.Scanner) (*ast.TryStatement, error) {
+	start := s.Token
+	if s.Token.Type != lexer.TryKeyword {
+		return nil, unexpectedToken(s, "try")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
 
 	statements, err := parseStatementBlock(s)
 	if err != nil {
 		return nil, err
 	}
+	n := &ast.TryStatement{Statements: statements}
 
-	return &ast.WhileStatement{Condition: e, Statements: statements}, nil
+	if s.Token.Type == lexer.CatchKeyword {
+		catchStart := s.Token
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		if s.Token.Type != lexer.LeftParen {
+			return nil, unexpectedToken(s, "(")
+		}
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		if s.Token.Type != lexer.ID {
+			return nil, unexpectedToken(s, "ID")
+		}
+		identifier := s.Token.Value
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		if s.Token.Type != lexer.RightParen {
+			return nil, unexpectedToken(s, ")")
+		}
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		statements, err := parseStatementBlock(s)
+		if err != nil {
+			return nil, err
+		}
+		n.Catch = &ast.CatchClause{Span: spanFrom(s, catchStart), Identifier: identifier, Statements: statements}
+	}
+
+	if s.Token.Type == lexer.FinallyKeyword {
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+		statements, err := parseStatementBlock(s)
+		if err != nil {
+			return nil, err
+		}
+		n.Finally = statements
+	} else if n.Catch == nil {
+		return nil, unexpectedToken(s, "catch")
+	}
+
+	n.Span = spanFrom(s, start)
+	return n, nil
 }
 
 func parseStatementBlock(s *lexer.Scanner) ([]ast.Statement, error) {
 	if s.Token.Type != lexer.LeftBrace {
-		return nil, unexpectedToken(s.Token, "{")
+		return nil, unexpectedToken(s, "{")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -214,8 +548,9 @@ func parseExpression(s *lexer.Scanner) (ast.Expression, error) {
 }
 
 func parseIfExpression(s *lexer.Scanner) (*ast.IfExpression, error) {
+	start := s.Token
 	if s.Token.Type != lexer.IfKeyword {
-		return nil, unexpectedToken(s.Token, "if")
+		return nil, unexpectedToken(s, "if")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -227,7 +562,7 @@ func parseIfExpression(s *lexer.Scanner) (*ast.IfExpression, error) {
 	}
 
 	if s.Token.Type != lexer.LeftBrace {
-		return nil, unexpectedToken(s.Token, "{")
+		return nil, unexpectedToken(s, "{")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -239,7 +574,7 @@ func parseIfExpression(s *lexer.Scanner) (*ast.IfExpression, error) {
 	}
 
 	if s.Token.Type != lexer.RightBrace {
-		return nil, unexpectedToken(s.Token, "}")
+		return nil, unexpectedToken(s, "}")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -248,7 +583,7 @@ func parseIfExpression(s *lexer.Scanner) (*ast.IfExpression, error) {
 	n := &ast.IfExpression{Condition: cond, Value: v}
 
 	if s.Token.Type != lexer.ElseKeyword {
-		return nil, unexpectedToken(s.Token, "else")
+		return nil, unexpectedToken(s, "else")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -261,6 +596,7 @@ func parseIfExpression(s *lexer.Scanner) (*ast.IfExpression, error) {
 		}
 		n.ElseBranch = elseBranch
 	} else if s.Token.Type == lexer.LeftBrace {
+		blockStart := s.Token
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
@@ -271,30 +607,46 @@ func parseIfExpression(s *lexer.Scanner) (*ast.IfExpression, error) {
 		}
 
 		if s.Token.Type != lexer.RightBrace {
-			return nil, unexpectedToken(s.Token, "}")
+			return nil, unexpectedToken(s, "}")
 		}
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
 
-		n.ElseBranch = &ast.IfExpression{Value: v}
+		n.ElseBranch = &ast.IfExpression{Span: spanFrom(s, blockStart), Value: v}
 	} else {
-		return nil, unexpectedToken(s.Token, "one of: if, {")
+		return nil, unexpectedToken(s, "one of: if, {")
 	}
 
+	n.Span = spanFrom(s, start)
 	return n, nil
 }
 
 func parseFunction(s *lexer.Scanner) (*ast.Function, error) {
+	start := s.Token
 	if s.Token.Type != lexer.FunctionKeyword {
-		return nil, unexpectedToken(s.Token, "func")
+		return nil, unexpectedToken(s, "func")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
 	}
 
+	parameters, err := parseParameters(s)
+	if err != nil {
+		return nil, err
+	}
+
+	statements, err := parseStatementBlock(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.Function{Span: spanFrom(s, start), Parameters: parameters, Statements: statements}, nil
+}
+
+func parseParameters(s *lexer.Scanner) ([]string, error) {
 	if s.Token.Type != lexer.LeftParen {
-		return nil, unexpectedToken(s.Token, "(")
+		return nil, unexpectedToken(s, "(")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -317,18 +669,13 @@ func parseFunction(s *lexer.Scanner) (*ast.Function, error) {
 	}
 
 	if s.Token.Type != lexer.RightParen {
-		return nil, unexpectedToken(s.Token, ")")
+		return nil, unexpectedToken(s, ")")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
 	}
 
-	statements, err := parseStatementBlock(s)
-	if err != nil {
-		return nil, err
-	}
-
-	return &ast.Function{Parameters: parameters, Statements: statements}, nil
+	return parameters, nil
 }
 
 func parseLogicalOr(s *lexer.Scanner) (ast.Expression, error) {
@@ -347,7 +694,7 @@ func parseLogicalOr(s *lexer.Scanner) (ast.Expression, error) {
 			return nil, err
 		}
 
-		expr = &ast.BinaryOperationExpression{Operator: ast.BinaryOperatorLor, A: expr, B: e}
+		expr = &ast.BinaryOperationExpression{Span: extendSpan(s, expr.Location()), Operator: ast.BinaryOperatorLor, A: expr, B: e}
 	}
 
 	return expr, nil
@@ -369,7 +716,7 @@ func parseLogicalAnd(s *lexer.Scanner) (ast.Expression, error) {
 			return nil, err
 		}
 
-		expr = &ast.BinaryOperationExpression{Operator: ast.BinaryOperatorLand, A: expr, B: e}
+		expr = &ast.BinaryOperationExpression{Span: extendSpan(s, expr.Location()), Operator: ast.BinaryOperatorLand, A: expr, B: e}
 	}
 
 	return expr, nil
@@ -408,6 +755,7 @@ func parseComparison(s *lexer.Scanner) (ast.Expression, error) {
 		}
 
 		return &ast.BinaryOperationExpression{
+			Span:     extendSpan(s, expr.Location()),
 			Operator: op,
 			A:        expr,
 			B:        e,
@@ -444,7 +792,7 @@ L:
 			return nil, err
 		}
 
-		expr = &ast.BinaryOperationExpression{Operator: op, A: expr, B: e}
+		expr = &ast.BinaryOperationExpression{Span: extendSpan(s, expr.Location()), Operator: op, A: expr, B: e}
 	}
 
 	return expr, nil
@@ -477,14 +825,15 @@ L:
 			return nil, err
 		}
 
-		expr = &ast.BinaryOperationExpression{Operator: op, A: expr, B: e}
+		expr = &ast.BinaryOperationExpression{Span: extendSpan(s, expr.Location()), Operator: op, A: expr, B: e}
 	}
 
 	return expr, nil
 }
 
 func parseFactor(s *lexer.Scanner) (ast.Expression, error) {
-	var prefixOp *ast.UnaryOperationExpression
+	prefixOps := []*ast.UnaryOperationExpression{}
+	prefixTokens := []*lexer.Token{}
 L:
 	for {
 		var op ast.UnaryOperator
@@ -499,15 +848,12 @@ L:
 			break L
 		}
 
+		prefixTokens = append(prefixTokens, s.Token)
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
 
-		operation := &ast.UnaryOperationExpression{Operator: op}
-		if prefixOp != nil {
-			prefixOp.A = operation
-		}
-		prefixOp = operation
+		prefixOps = append(prefixOps, &ast.UnaryOperationExpression{Operator: op})
 	}
 
 	v, err := parseValue(s)
@@ -528,14 +874,22 @@ L:
 				return nil, err
 			}
 			v = e
+		} else if s.Token.Type == lexer.Dot {
+			e, err := parseMember(v, s)
+			if err != nil {
+				return nil, err
+			}
+			v = e
 		} else {
 			break
 		}
 	}
 
-	if prefixOp != nil {
-		prefixOp.A = v
-		return prefixOp, nil
+	// Apply prefix operators from the innermost to the outermost
+	for i := len(prefixOps) - 1; i >= 0; i-- {
+		prefixOps[i].Span = spanFrom(s, prefixTokens[i])
+		prefixOps[i].A = v
+		v = prefixOps[i]
 	}
 	return v, nil
 }
@@ -551,7 +905,7 @@ func parseValue(s *lexer.Scanner) (ast.Expression, error) {
 			return nil, err
 		}
 		if s.Token.Type != lexer.RightParen {
-			return nil, unexpectedToken(s.Token, ")")
+			return nil, unexpectedToken(s, ")")
 		}
 		if err := s.ReadNext(); err != nil {
 			return nil, err
@@ -559,66 +913,103 @@ func parseValue(s *lexer.Scanner) (ast.Expression, error) {
 		return n, nil
 	case lexer.LeftBracket:
 		return parseArray(s)
+	case lexer.LeftBrace:
+		return parseMap(s)
 	case lexer.ID:
-		n := &ast.LookupExpression{Identifier: s.Token.Value}
+		n := &ast.LookupExpression{Span: tokenSpan(s, s.Token), Identifier: s.Token.Value}
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
 		return n, nil
 	case lexer.Integer:
-		value := strings.ReplaceAll(s.Token.Value, "_", "")
-		num, err := strconv.ParseInt(value, 10, 64)
+		num, err := lexer.ParseInteger(s.Token.Value)
 		if err != nil {
 			return nil, err
 		}
-		n := &ast.Integer{Value: num}
+		n := &ast.Integer{Span: tokenSpan(s, s.Token), Value: num}
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
 		return n, nil
 	case lexer.Float:
-		value := strings.ReplaceAll(s.Token.Value, "_", "")
-		num, err := strconv.ParseFloat(value, 64)
+		num, err := lexer.ParseFloat(s.Token.Value)
 		if err != nil {
 			return nil, err
 		}
-		n := &ast.Float{Value: num}
+		n := &ast.Float{Span: tokenSpan(s, s.Token), Value: num}
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
 		return n, nil
 	case lexer.String:
-		n := &ast.String{Value: s.Token.Value}
+		n := &ast.String{Span: tokenSpan(s, s.Token), Value: s.Token.Value}
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
 		return n, nil
+	case lexer.StringHead:
+		return parseInterpolatedString(s)
 	case lexer.TrueKeyword:
-		n := &ast.Boolean{Value: true}
+		n := &ast.Boolean{Span: tokenSpan(s, s.Token), Value: true}
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
 		return n, nil
 	case lexer.FalseKeyword:
-		n := &ast.Boolean{Value: false}
+		n := &ast.Boolean{Span: tokenSpan(s, s.Token), Value: false}
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
 		return n, nil
 	case lexer.NilKeyword:
-		n := &ast.Nil{}
+		n := &ast.Nil{Span: tokenSpan(s, s.Token)}
 		if err := s.ReadNext(); err != nil {
 			return nil, err
 		}
 		return n, nil
 	}
 
-	return nil, unexpectedToken(s.Token, "one of: (, ID, Integer, String, true, false")
+	return nil, unexpectedToken(s, "one of: (, [, {, ID, Integer, Float, String, true, false, nil")
+}
+
+func parseInterpolatedString(s *lexer.Scanner) (ast.Expression, error) {
+	start := s.Token
+	if s.Token.Type != lexer.StringHead {
+		return nil, unexpectedToken(s, "String")
+	}
+
+	parts := []ast.Expression{}
+	for {
+		if s.Token.Value != "" {
+			parts = append(parts, &ast.String{Span: tokenSpan(s, s.Token), Value: s.Token.Value})
+		}
+		if s.Token.Type == lexer.StringTail {
+			break
+		}
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+
+		e, err := parseExpression(s)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, e)
+
+		if s.Token.Type != lexer.StringMiddle && s.Token.Type != lexer.StringTail {
+			return nil, unexpectedToken(s, "}")
+		}
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	return &ast.InterpolatedString{Span: spanFrom(s, start), Parts: parts}, nil
 }
 
 func parseCall(callee ast.Expression, s *lexer.Scanner) (ast.Expression, error) {
 	if s.Token.Type != lexer.LeftParen {
-		return nil, unexpectedToken(s.Token, "(")
+		return nil, unexpectedToken(s, "(")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -626,7 +1017,7 @@ func parseCall(callee ast.Expression, s *lexer.Scanner) (ast.Expression, error)
 
 	parameters := []ast.Expression{}
 
-	for {
+	for s.Token.Type != lexer.RightParen {
 		e, err := parseExpression(s)
 		if err != nil {
 			return nil, err
@@ -643,18 +1034,18 @@ func parseCall(callee ast.Expression, s *lexer.Scanner) (ast.Expression, error)
 	}
 
 	if s.Token.Type != lexer.RightParen {
-		return nil, unexpectedToken(s.Token, ")")
+		return nil, unexpectedToken(s, ")")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
 	}
 
-	return &ast.CallExpression{Callee: callee, Parameters: parameters}, nil
+	return &ast.CallExpression{Span: extendSpan(s, callee.Location()), Callee: callee, Parameters: parameters}, nil
 }
 
 func parseSubscript(target ast.Expression, s *lexer.Scanner) (ast.Expression, error) {
 	if s.Token.Type != lexer.LeftBracket {
-		return nil, unexpectedToken(s.Token, "[")
+		return nil, unexpectedToken(s, "[")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -666,17 +1057,36 @@ func parseSubscript(target ast.Expression, s *lexer.Scanner) (ast.Expression, er
 	}
 
 	if s.Token.Type != lexer.RightBracket {
-		return nil, unexpectedToken(s.Token, "]")
+		return nil, unexpectedToken(s, "]")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
 	}
-	return &ast.SubscriptExpression{Target: target, Index: index}, nil
+	return &ast.SubscriptExpression{Span: extendSpan(s, target.Location()), Target: target, Index: index}, nil
+}
+
+func parseMember(target ast.Expression, s *lexer.Scanner) (ast.Expression, error) {
+	if s.Token.Type != lexer.Dot {
+		return nil, unexpectedToken(s, ".")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	if s.Token.Type != lexer.ID {
+		return nil, unexpectedToken(s, "ID")
+	}
+	name := s.Token.Value
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+	return &ast.MemberExpression{Span: extendSpan(s, target.Location()), Target: target, Name: name}, nil
 }
 
 func parseArray(s *lexer.Scanner) (ast.Expression, error) {
+	start := s.Token
 	if s.Token.Type != lexer.LeftBracket {
-		return nil, unexpectedToken(s.Token, "[")
+		return nil, unexpectedToken(s, "[")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
@@ -684,7 +1094,7 @@ func parseArray(s *lexer.Scanner) (ast.Expression, error) {
 
 	items := []ast.Expression{}
 
-	for {
+	for s.Token.Type != lexer.RightBracket {
 		e, err := parseExpression(s)
 		if err != nil {
 			return nil, err
@@ -701,16 +1111,85 @@ func parseArray(s *lexer.Scanner) (ast.Expression, error) {
 	}
 
 	if s.Token.Type != lexer.RightBracket {
-		return nil, unexpectedToken(s.Token, "]")
+		return nil, unexpectedToken(s, "]")
 	}
 	if err := s.ReadNext(); err != nil {
 		return nil, err
 	}
 
-	return &ast.ArrayExpression{Items: items}, nil
+	return &ast.ArrayExpression{Span: spanFrom(s, start), Items: items}, nil
+}
+
+func parseMap(s *lexer.Scanner) (ast.Expression, error) {
+	start := s.Token
+	if s.Token.Type != lexer.LeftBrace {
+		return nil, unexpectedToken(s, "{")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	entries := []ast.MapEntry{}
+
+	for s.Token.Type != lexer.RightBrace {
+		k, err := parseExpression(s)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.Token.Type != lexer.Colon {
+			return nil, unexpectedToken(s, ":")
+		}
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+
+		v, err := parseExpression(s)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, ast.MapEntry{Key: k, Value: v})
+
+		if s.Token.Type != lexer.Comma {
+			break
+		}
+		if err := s.ReadNext(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Token.Type != lexer.RightBrace {
+		return nil, unexpectedToken(s, "}")
+	}
+	if err := s.ReadNext(); err != nil {
+		return nil, err
+	}
+
+	return &ast.MapExpression{Span: spanFrom(s, start), Entries: entries}, nil
 }
 
 // For reuse
 func ParseExpression(s *lexer.Scanner) (ast.Expression, error) {
 	return parseExpression(s)
 }
+
+// tokenSpan returns the span covering only the token t.
+func tokenSpan(s *lexer.Scanner, t *lexer.Token) ast.Span {
+	return ast.Span{File: s.File, Line: t.Line, Column: t.Column, EndLine: t.EndLine, EndColumn: t.EndColumn}
+}
+
+// spanFrom returns the span from the start of the token t up to the end of
+// the most recently consumed token.
+func spanFrom(s *lexer.Scanner, t *lexer.Token) ast.Span {
+	return extendSpan(s, tokenSpan(s, t))
+}
+
+// extendSpan moves the end of span to the end of the most recently consumed
+// token.
+func extendSpan(s *lexer.Scanner, span ast.Span) ast.Span {
+	if t := s.Previous(); t != nil {
+		span.EndLine, span.EndColumn = t.EndLine, t.EndColumn
+	}
+	return span
+}
@@ -1,26 +1,66 @@
 package semantics
 
 import (
-	"fmt"
-
 	"github.com/niklaskorz/nklang/ast"
 )
 
 func AnalyzeLookups(p *ast.Program) error {
-	globalScope := &DefinitionScope{definitions: make(definitionSet)}
-	return AnalyzeLookupsWithScope(p, globalScope)
+	return AnalyzeLookupsWithScope(p, NewScope())
 }
 
-func AnalyzeLookupsWithScope(p *ast.Program, scope *DefinitionScope) error {
+// Option changes how AnalyzeLookupsWithScope analyzes a program.
+type Option int
+
+const (
+	// ShadowRedeclarations lets declarations at the top level of the
+	// program shadow earlier declarations of the same name in the given
+	// scope instead of failing, as suits interactive sessions. Uses
+	// analyzed before, including functions capturing the variable, keep
+	// referring to the shadowed variable.
+	ShadowRedeclarations Option = iota + 1
+)
+
+func AnalyzeLookupsWithScope(p *ast.Program, scope *DefinitionScope, options ...Option) error {
+	shadow := false
+	for _, o := range options {
+		if o == ShadowRedeclarations {
+			shadow = true
+		}
+	}
+
+	// A program failing the analysis won't run, so its declarations are
+	// undone to keep scope in line with the scopes it is run in
+	saved := scope.save()
 	for _, n := range p.Statements {
+		if name := declaredName(n); shadow && name != "" {
+			scope.shadow(name)
+		}
 		if err := analyzeStatement(scope, n); err != nil {
+			scope.restore(saved)
 			return err
 		}
 	}
 
+	if err := scope.members.check(); err != nil {
+		scope.restore(saved)
+		return err
+	}
 	return nil
 }
 
+// declaredName returns the name declared by the statement n, if any.
+func declaredName(n ast.Statement) string {
+	switch s := n.(type) {
+	case *ast.DeclarationStatement:
+		return s.Identifier
+	case *ast.StructDeclaration:
+		return s.Name
+	case *ast.ClassDeclaration:
+		return s.Name
+	}
+	return ""
+}
+
 func analyzeStatement(scope *DefinitionScope, n ast.Statement) error {
 	switch s := n.(type) {
 	case *ast.IfStatement:
@@ -50,27 +90,139 @@ func analyzeStatement(scope *DefinitionScope, n ast.Statement) error {
 				return err
 			}
 		}
+	case *ast.ForStatement:
+		if err := analyzeExpression(scope, s.Iterable); err != nil {
+			return err
+		}
+		ds := scope.newScope()
+		if s.IndexIdentifier != "" {
+			if s.IndexIdentifier == s.ValueIdentifier {
+				return newError(s, "Redeclaration of %s in same scope", s.ValueIdentifier)
+			}
+			s.IndexSlot = ds.declare(s.IndexIdentifier, s)
+		}
+		s.ValueSlot = ds.declare(s.ValueIdentifier, s)
+		for _, n := range s.Statements {
+			if err := analyzeStatement(ds, n); err != nil {
+				return err
+			}
+		}
+	case *ast.StructDeclaration:
+		if scope.definitions.has(s.Name) {
+			return newError(s, "Redeclaration of %s in same scope", s.Name)
+		}
+		fields := make(definitionSet)
+		for _, f := range s.Fields {
+			if fields.has(f) {
+				return newError(s, "Duplicate field %s in struct %s", f, s.Name)
+			}
+			fields.set(f)
+			scope.members.declared.set(f)
+		}
+		s.Slot = scope.declare(s.Name, s)
+	case *ast.ClassDeclaration:
+		if scope.definitions.has(s.Name) {
+			return newError(s, "Redeclaration of %s in same scope", s.Name)
+		}
+		if s.Superclass != nil {
+			if err := analyzeExpression(scope, s.Superclass); err != nil {
+				return err
+			}
+		}
+		s.Slot = scope.declare(s.Name, s)
+		// Methods are bound to a scope holding self and, for subclasses, super,
+		// in that order
+		ds := scope.newScope()
+		ds.declare("self", s)
+		if s.Superclass != nil {
+			ds.declare("super", s)
+		}
+		methods := make(definitionSet)
+		for _, m := range s.Methods {
+			if methods.has(m.Name) {
+				return newError(m, "Duplicate method %s in class %s", m.Name, s.Name)
+			}
+			methods.set(m.Name)
+			scope.members.declared.set(m.Name)
+			if err := analyzeExpression(ds, m); err != nil {
+				return err
+			}
+		}
 	case *ast.DeclarationStatement:
 		if scope.definitions.has(s.Identifier) {
-			return fmt.Errorf("Redeclaration of %s in same scope", s.Identifier)
+			return newError(s, "Redeclaration of %s in same scope", s.Identifier)
 		}
-		scope.declare(s.Identifier)
+		s.Slot = scope.declare(s.Identifier, s)
 		if err := analyzeExpression(scope, s.Value); err != nil {
 			return err
 		}
 	case *ast.AssignmentStatement:
-		scopeIndex := scope.lookup(s.Identifier, 0)
+		scopeIndex, slot := scope.lookup(s.Identifier, 0)
 		if scopeIndex == -1 {
-			return fmt.Errorf("%s must be declared before assignment", s.Identifier)
+			return newError(s, "%s must be declared before assignment", s.Identifier)
 		}
 		s.ScopeIndex = scopeIndex
+		s.Slot = slot
+		scope.reference(s, s.Identifier)
+		if err := analyzeExpression(scope, s.Value); err != nil {
+			return err
+		}
+	case *ast.SubscriptAssignmentStatement:
+		if err := analyzeExpression(scope, s.Target); err != nil {
+			return err
+		}
+		if err := analyzeExpression(scope, s.Index); err != nil {
+			return err
+		}
 		if err := analyzeExpression(scope, s.Value); err != nil {
 			return err
 		}
+	case *ast.MemberAssignmentStatement:
+		if err := analyzeExpression(scope, s.Target); err != nil {
+			return err
+		}
+		// Instances of classes get their fields by assignment to self inside
+		// of their methods, all other targets need the member to exist
+		if scope.isSelf(s.Target) {
+			scope.members.declared.set(s.Name)
+		} else {
+			scope.members.use(s, s.Name)
+		}
+		if err := analyzeExpression(scope, s.Value); err != nil {
+			return err
+		}
+	case *ast.TryStatement:
+		ds := scope.newScope()
+		for _, n := range s.Statements {
+			if err := analyzeStatement(ds, n); err != nil {
+				return err
+			}
+		}
+		if s.Catch != nil {
+			ds := scope.newScope()
+			s.Catch.Slot = ds.declare(s.Catch.Identifier, s.Catch)
+			for _, n := range s.Catch.Statements {
+				if err := analyzeStatement(ds, n); err != nil {
+					return err
+				}
+			}
+		}
+		if s.Finally != nil {
+			ds := scope.newScope()
+			for _, n := range s.Finally {
+				if err := analyzeStatement(ds, n); err != nil {
+					return err
+				}
+			}
+		}
 	case *ast.ReturnStatement:
 		if err := analyzeExpression(scope, s.Expression); err != nil {
 			return err
 		}
+	case *ast.ThrowStatement:
+		if err := analyzeExpression(scope, s.Expression); err != nil {
+			return err
+		}
 	case *ast.ExpressionStatement:
 		if err := analyzeExpression(scope, s.Expression); err != nil {
 			return err
@@ -103,12 +255,30 @@ func analyzeExpression(scope *DefinitionScope, n ast.Expression) error {
 		if err := analyzeExpression(scope, e.B); err != nil {
 			return err
 		}
+	case *ast.UnaryOperationExpression:
+		if err := analyzeExpression(scope, e.A); err != nil {
+			return err
+		}
+	case *ast.SubscriptExpression:
+		if err := analyzeExpression(scope, e.Target); err != nil {
+			return err
+		}
+		if err := analyzeExpression(scope, e.Index); err != nil {
+			return err
+		}
 	case *ast.LookupExpression:
-		scopeIndex := scope.lookup(e.Identifier, 0)
+		scopeIndex, slot := scope.lookup(e.Identifier, 0)
 		if scopeIndex == -1 {
-			return fmt.Errorf("%s must be declared before usage", e.Identifier)
+			return newError(e, "%s must be declared before usage", e.Identifier)
 		}
 		e.ScopeIndex = scopeIndex
+		e.Slot = slot
+		scope.reference(e, e.Identifier)
+	case *ast.MemberExpression:
+		if err := analyzeExpression(scope, e.Target); err != nil {
+			return err
+		}
+		scope.members.use(e, e.Name)
 	case *ast.CallExpression:
 		if err := analyzeExpression(scope, e.Callee); err != nil {
 			return err
@@ -119,9 +289,14 @@ func analyzeExpression(scope *DefinitionScope, n ast.Expression) error {
 			}
 		}
 	case *ast.Function:
+		e.Captures = nil
 		ds := scope.newScope()
+		ds.function = e
 		for _, p := range e.Parameters {
-			ds.declare(p)
+			if ds.definitions.has(p) {
+				return newError(e, "Duplicate parameter %s", p)
+			}
+			ds.declare(p, e)
 		}
 		scope := ds.newScope()
 		for _, s := range e.Statements {
@@ -135,11 +310,35 @@ func analyzeExpression(scope *DefinitionScope, n ast.Expression) error {
 				return err
 			}
 		}
+	case *ast.MapExpression:
+		for _, entry := range e.Entries {
+			if err := analyzeExpression(scope, entry.Key); err != nil {
+				return err
+			}
+			if err := analyzeExpression(scope, entry.Value); err != nil {
+				return err
+			}
+		}
+	case *ast.InterpolatedString:
+		for _, part := range e.Parts {
+			if err := analyzeExpression(scope, part); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
 func AnalyzeExpression(scope *DefinitionScope, n ast.Expression) error {
-	return analyzeExpression(scope, n)
+	saved := scope.save()
+	if err := analyzeExpression(scope, n); err != nil {
+		scope.restore(saved)
+		return err
+	}
+	if err := scope.members.check(); err != nil {
+		scope.restore(saved)
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,69 @@
+package semantics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+)
+
+func TestFunctionsCaptureOnlyUsedVariables(t *testing.T) {
+	src := `
+		a := 1;
+		b := 2;
+		c := 3;
+		f := func(x) {
+			y := x + c;
+			return func() { return a + y; };
+		};
+	`
+	p, err := parser.Parse(lexer.NewScanner(strings.NewReader(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AnalyzeLookups(p); err != nil {
+		t.Fatal(err)
+	}
+
+	outer := p.Statements[3].(*ast.DeclarationStatement).Value.(*ast.Function)
+	inner := outer.Statements[1].(*ast.ReturnStatement).Expression.(*ast.Function)
+	expectCaptures(t, outer, "c", "a")
+	expectCaptures(t, inner, "a", "y")
+}
+
+func expectCaptures(t *testing.T, f *ast.Function, names ...string) {
+	t.Helper()
+	var captured []string
+	for _, c := range f.Captures {
+		captured = append(captured, c.Identifier)
+	}
+	if strings.Join(captured, ",") != strings.Join(names, ",") {
+		t.Errorf("Expected captures %v, got %v", names, captured)
+	}
+}
+
+func TestMembersAreDeclaredByAssignmentToSelf(t *testing.T) {
+	for src, unknown := range map[string]string{
+		`struct P { x } p := P(1); p.z = 3;`:                                      "z",
+		`struct P { x } p := P(1); y := p.x; p.x = 2;`:                            "",
+		`class C { init() { self.count = 0; } } c := C(); c.count = c.count + 1;`: "",
+		`class C { inc() { f := func() { self.n = 1; }; } } y := C().n;`:          "",
+		`class C {} c := C(); c.size = 1;`:                                        "size",
+		`self := {}; self.size = 1;`:                                              "size",
+		`class C { m(self) { self.size = 1; } }`:                                  "size",
+	} {
+		p, err := parser.Parse(lexer.NewScanner(strings.NewReader(src)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = AnalyzeLookups(p)
+		if unknown == "" && err != nil {
+			t.Errorf("Expected %s to pass the analysis, got %s", src, err)
+		}
+		if unknown != "" && (err == nil || !strings.Contains(err.Error(), "Unknown member "+unknown)) {
+			t.Errorf("Expected member %s to be unknown in %s, got %v", unknown, src, err)
+		}
+	}
+}
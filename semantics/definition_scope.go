@@ -1,5 +1,7 @@
 package semantics
 
+import "github.com/niklaskorz/nklang/ast"
+
 type definitionSet map[string]struct{}
 
 func (s definitionSet) set(name string) {
@@ -11,36 +13,280 @@ func (s definitionSet) has(name string) bool {
 	return ok
 }
 
+// memberTable collects the member names declared anywhere in a program.
+// Member accesses are only checked against it once the whole program has
+// been analyzed, as functions may access members of structs declared later.
+type memberTable struct {
+	declared definitionSet
+	used     []memberUse
+}
+
+// memberUse is a member expression or member assignment using the member
+// name.
+type memberUse struct {
+	node ast.Node
+	name string
+}
+
+// use records that n uses the member name.
+func (t *memberTable) use(n ast.Node, name string) {
+	t.used = append(t.used, memberUse{node: n, name: name})
+}
+
+// check reports the first used member that has not been declared.
+func (t *memberTable) check() error {
+	used := t.used
+	t.used = nil
+	for _, u := range used {
+		if !t.declared.has(u.name) {
+			return newError(u.node, "Unknown member %s", u.name)
+		}
+	}
+	return nil
+}
+
+// errorMembers are the members of the error objects bound by catch clauses.
+var errorMembers = []string{"message", "kind", "position", "line", "column"}
+
+// slotMap maps the names declared in a scope to their slots, numbered in
+// order of declaration.
+type slotMap map[string]int
+
+func (m slotMap) has(name string) bool {
+	_, ok := m[name]
+	return ok
+}
+
+// Definition is the declaration of a variable.
+type Definition struct {
+	Name string
+	// Node declaring the variable: a declaration statement, function,
+	// for statement, catch clause, struct or class declaration. It is nil for
+	// predefined names.
+	Node ast.Node
+}
+
+// References maps the lookup expressions and assignment statements of
+// analyzed programs to the definitions of the variables they refer to.
+type References map[ast.Node]*Definition
+
 type DefinitionScope struct {
 	parent      *DefinitionScope
-	definitions definitionSet
+	definitions slotMap
+	// Number of slots assigned, which exceeds the number of definitions if
+	// names have been shadowed
+	slots      int
+	nodes      map[string]*Definition
+	members    *memberTable
+	references References
+	// function is set on the parameter scope of a function
+	function *ast.Function
 }
 
 func NewScope() *DefinitionScope {
-	return &DefinitionScope{definitions: make(definitionSet)}
+	members := &memberTable{declared: make(definitionSet)}
+	for _, name := range errorMembers {
+		members.declared.set(name)
+	}
+	return &DefinitionScope{
+		definitions: make(slotMap),
+		nodes:       make(map[string]*Definition),
+		members:     members,
+	}
 }
 
 func (scope *DefinitionScope) newScope() *DefinitionScope {
 	return &DefinitionScope{
 		parent:      scope,
-		definitions: make(definitionSet),
+		definitions: make(slotMap),
+		nodes:       make(map[string]*Definition),
+		members:     scope.members,
+		references:  scope.references,
 	}
 }
 
-func (scope *DefinitionScope) lookup(name string, index int) int {
-	if scope.definitions.has(name) {
-		return index
+// lookup returns the scope index and slot of name, or -1 if it is not
+// declared. Functions only see their own scopes and, above their parameter
+// scope, a scope holding the variables they capture. Looking up a variable
+// declared outside of a function adds it to the function's captures.
+func (scope *DefinitionScope) lookup(name string, index int) (int, int) {
+	if slot, ok := scope.definitions[name]; ok {
+		return index, slot
 	}
 	if scope.parent == nil {
-		return -1
+		return -1, -1
+	}
+	if scope.function != nil {
+		scopeIndex, slot := scope.parent.lookup(name, 0)
+		if scopeIndex == -1 {
+			return -1, -1
+		}
+		return index + 1, capture(scope.function, name, scopeIndex, slot)
 	}
 	return scope.parent.lookup(name, index+1)
 }
 
-func (scope *DefinitionScope) declare(name string) {
-	scope.definitions.set(name)
+// capture adds name to the captures of f unless it is already captured and
+// returns its slot in the scope of captured variables.
+func capture(f *ast.Function, name string, scopeIndex int, slot int) int {
+	for i, c := range f.Captures {
+		if c.Identifier == name {
+			return i
+		}
+	}
+	f.Captures = append(f.Captures, ast.Capture{Identifier: name, ScopeIndex: scopeIndex, Slot: slot})
+	return len(f.Captures) - 1
+}
+
+// declare returns the slot of name, assigning the next free slot if name
+// has not been declared in this scope yet. n is the node declaring name.
+func (scope *DefinitionScope) declare(name string, n ast.Node) int {
+	if slot, ok := scope.definitions[name]; ok {
+		return slot
+	}
+	slot := scope.slots
+	scope.slots++
+	scope.definitions[name] = slot
+	scope.nodes[name] = &Definition{Name: name, Node: n}
+	return slot
 }
 
+// Declare declares a predefined name. Predefined names must be declared in
+// the same order as in the evaluator's scope, so they get the same slots.
 func (scope *DefinitionScope) Declare(name string) {
-	scope.definitions.set(name)
+	scope.declare(name, nil)
+}
+
+// shadow makes name undeclared in scope, so it can be declared again in a
+// new slot. The variable in the old slot is left to the uses analyzed so
+// far.
+func (scope *DefinitionScope) shadow(name string) {
+	delete(scope.definitions, name)
+}
+
+// savedScope is the state of the declarations in a scope and of the
+// declared member names.
+type savedScope struct {
+	definitions slotMap
+	nodes       map[string]*Definition
+	slots       int
+	members     definitionSet
+}
+
+func (scope *DefinitionScope) save() savedScope {
+	saved := savedScope{
+		definitions: make(slotMap, len(scope.definitions)),
+		nodes:       make(map[string]*Definition, len(scope.nodes)),
+		slots:       scope.slots,
+		members:     make(definitionSet, len(scope.members.declared)),
+	}
+	for name, slot := range scope.definitions {
+		saved.definitions[name] = slot
+	}
+	for name, d := range scope.nodes {
+		saved.nodes[name] = d
+	}
+	for name := range scope.members.declared {
+		saved.members.set(name)
+	}
+	return saved
+}
+
+// restore undoes the declarations made since saved was saved, including
+// those of members, and forgets the members used since.
+func (scope *DefinitionScope) restore(saved savedScope) {
+	scope.definitions = saved.definitions
+	scope.nodes = saved.nodes
+	scope.slots = saved.slots
+	scope.members.declared = saved.members
+	scope.members.used = nil
+}
+
+// Snapshot is the state of the declarations in a scope at some point.
+type Snapshot struct {
+	saved savedScope
+}
+
+// Snapshot returns the current state of the declarations in scope, which
+// Rollback returns to.
+func (scope *DefinitionScope) Snapshot() Snapshot {
+	return Snapshot{saved: scope.save()}
+}
+
+// Rollback undoes the declarations made since s was taken, except for those
+// in slots for which keep returns true. It is used when an analyzed program
+// fails at runtime, so only the declarations that ran stay. Names shadowed
+// by undone declarations refer to their old slots again. The undone slots
+// stay assigned, as functions of the program may still refer to them, and
+// so do the declared member names.
+func (scope *DefinitionScope) Rollback(s Snapshot, keep func(slot int) bool) {
+	definitions, nodes, slots, members := scope.definitions, scope.nodes, scope.slots, scope.members.declared
+	scope.restore(s.saved)
+	for name, slot := range definitions {
+		if slot >= s.saved.slots && keep(slot) {
+			scope.definitions[name] = slot
+			scope.nodes[name] = nodes[name]
+		}
+	}
+	scope.slots = slots
+	scope.members.declared = members
+}
+
+// Names returns the names declared in scope, ordered by slot.
+func (scope *DefinitionScope) Names() []string {
+	bySlot := make([]string, scope.slots)
+	for name, slot := range scope.definitions {
+		bySlot[slot] = name
+	}
+	var names []string
+	for _, name := range bySlot {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// RecordReferences makes the analysis of programs in scope record the
+// definition each variable use refers to in refs. It must be called before
+// any program is analyzed.
+func (scope *DefinitionScope) RecordReferences(refs References) {
+	scope.references = refs
+}
+
+// reference records that n refers to the variable name, which must be
+// declared.
+func (scope *DefinitionScope) reference(n ast.Node, name string) {
+	if scope.references == nil {
+		return
+	}
+	if d := scope.definition(name); d != nil {
+		scope.references[n] = d
+	}
+}
+
+// definition returns the definition name refers to, or nil if name is not
+// declared.
+func (scope *DefinitionScope) definition(name string) *Definition {
+	for s := scope; s != nil; s = s.parent {
+		if s.definitions.has(name) {
+			return s.nodes[name]
+		}
+	}
+	return nil
+}
+
+// isSelf reports whether e looks up the self bound by a class to its
+// methods.
+func (scope *DefinitionScope) isSelf(e ast.Expression) bool {
+	lookup, ok := e.(*ast.LookupExpression)
+	if !ok || lookup.Identifier != "self" {
+		return false
+	}
+	d := scope.definition("self")
+	if d == nil {
+		return false
+	}
+	_, ok = d.Node.(*ast.ClassDeclaration)
+	return ok
 }
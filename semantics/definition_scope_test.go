@@ -0,0 +1,53 @@
+package semantics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+)
+
+func analyze(t *testing.T, scope *DefinitionScope, src string) (*ast.Program, error) {
+	t.Helper()
+	p, err := parser.Parse(lexer.NewScanner(strings.NewReader(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, AnalyzeLookupsWithScope(p, scope, ShadowRedeclarations)
+}
+
+func TestRollbackKeepsDeclarationsThatRan(t *testing.T) {
+	scope := NewScope()
+	if _, err := analyze(t, scope, `a := 1; b := 2;`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the declaration of c ran before the program failed
+	saved := scope.Snapshot()
+	p, err := analyze(t, scope, `c := 3; a := 4; d := 5; struct S { field }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := p.Statements[0].(*ast.DeclarationStatement).Slot
+	scope.Rollback(saved, func(slot int) bool { return slot == ran })
+
+	if _, err := analyze(t, scope, `a; b; c; x := S; y := x.field;`); err == nil || !strings.Contains(err.Error(), "S must be declared") {
+		t.Errorf("Expected S to be undeclared, got %v", err)
+	}
+	if _, err := analyze(t, scope, `d;`); err == nil || !strings.Contains(err.Error(), "d must be declared") {
+		t.Errorf("Expected d to be undeclared, got %v", err)
+	}
+	p, err = analyze(t, scope, `a; b; c; e := 6;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot := p.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.LookupExpression).Slot; slot != 0 {
+		t.Errorf("Expected a to refer to its old slot 0 again, got %d", slot)
+	}
+	// Slots of undone declarations aren't reused
+	if slot := p.Statements[3].(*ast.DeclarationStatement).Slot; slot != 6 {
+		t.Errorf("Expected e to be declared in slot 6, got %d", slot)
+	}
+}
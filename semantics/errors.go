@@ -0,0 +1,21 @@
+package semantics
+
+import (
+	"fmt"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// Error is a semantic error found at Span.
+type Error struct {
+	Span    ast.Span
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span.Position(), e.Message)
+}
+
+func newError(n ast.Node, format string, a ...interface{}) *Error {
+	return &Error{Span: n.Location(), Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,21 @@
+package transpiler
+
+import (
+	"fmt"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// Error reports a construct at Span that can't be transpiled.
+type Error struct {
+	Span    ast.Span
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Span.Position(), e.Message)
+}
+
+func newError(n ast.Node, format string, a ...interface{}) *Error {
+	return &Error{Span: n.Location(), Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,91 @@
+package rt
+
+import (
+	"fmt"
+)
+
+// Builtin returns the predefined function name, which behaves like the one
+// of the same name in package builtins.
+func (r *Runtime) Builtin(name string) Object {
+	switch name {
+	case "println":
+		return &builtin{fn: r.println}
+	case "print":
+		return &builtin{fn: r.print}
+	case "input":
+		return &builtin{fn: r.input}
+	case "range":
+		return &builtin{fn: newRange}
+	case "Error":
+		return &builtin{fn: newError}
+	}
+	panic("unknown builtin " + name)
+}
+
+func (r *Runtime) println(params []Object) (Object, error) {
+	fmt.Fprintln(r.out, formatObjects(params, nil))
+	return Nil, nil
+}
+
+func (r *Runtime) print(params []Object) (Object, error) {
+	fmt.Fprint(r.out, formatObjects(params, nil))
+	return Nil, nil
+}
+
+func (r *Runtime) input(params []Object) (Object, error) {
+	r.print(params)
+
+	text, err := r.in.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	return Str(text[:len(text)-1]), nil
+}
+
+func newRange(params []Object) (Object, error) {
+	if len(params) < 1 || len(params) > 3 {
+		return nil, fmt.Errorf("range expects 1 to 3 arguments, got %d", len(params))
+	}
+
+	bounds := []int64{}
+	for _, p := range params {
+		i, ok := p.(*integer)
+		if !ok {
+			return nil, fmt.Errorf("range expects Integer arguments, got %s", p.TypeName())
+		}
+		bounds = append(bounds, i.value)
+	}
+
+	r := &rangeObject{start: 0, end: bounds[0], step: 1}
+	switch len(bounds) {
+	case 2:
+		r.start, r.end = bounds[0], bounds[1]
+	case 3:
+		r.start, r.end, r.step = bounds[0], bounds[1], bounds[2]
+	}
+	if r.step == 0 {
+		return nil, fmt.Errorf("Range step must not be zero")
+	}
+	return r, nil
+}
+
+func newError(params []Object) (Object, error) {
+	if len(params) < 1 || len(params) > 2 {
+		return nil, fmt.Errorf("Error expects 1 or 2 arguments, got %d", len(params))
+	}
+
+	strs := []string{}
+	for _, p := range params {
+		s, ok := p.(*str)
+		if !ok {
+			return nil, fmt.Errorf("Error expects String arguments, got %s", p.TypeName())
+		}
+		strs = append(strs, s.value)
+	}
+
+	if len(strs) == 1 {
+		return &errorObject{message: strs[0], kind: "Error"}, nil
+	}
+	return &errorObject{message: strs[0], kind: strs[1]}, nil
+}
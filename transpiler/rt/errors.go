@@ -0,0 +1,115 @@
+package rt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// stackFrame describes an active call of an nklang function.
+type stackFrame struct {
+	// Name the function was declared with, empty for anonymous functions
+	name string
+	// Position of the call expression that created the frame
+	callSite ast.Span
+}
+
+// functionName returns the name of the called function or "<anonymous>".
+func (f stackFrame) functionName() string {
+	if f.name == "" {
+		return "<anonymous>"
+	}
+	return f.name
+}
+
+// runtimeError is an error that occurred while running the code at span.
+type runtimeError struct {
+	span ast.Span
+	err  error
+	// Function calls active when the error occurred, outermost first
+	trace []stackFrame
+}
+
+func (e *runtimeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.span.Position(), e.err)
+}
+
+// thrownError carries a thrown value up to the closest enclosing try
+// statement.
+type thrownError struct {
+	span  ast.Span
+	value Object
+	// Function calls active when the value was thrown, outermost first
+	trace []stackFrame
+}
+
+func (e *thrownError) Error() string {
+	return fmt.Sprintf("Uncaught %s", formatObject(e.value, nil))
+}
+
+// runtimeError converts an uncaught thrown value into a runtimeError.
+func (e *thrownError) runtimeError() *runtimeError {
+	return &runtimeError{span: e.span, err: fmt.Errorf("Uncaught %s", formatObject(e.value, nil)), trace: e.trace}
+}
+
+// indexOutOfBoundsError reports an access to an index outside of a
+// sequence.
+type indexOutOfBoundsError struct {
+	index int64
+}
+
+func (e *indexOutOfBoundsError) Error() string {
+	return fmt.Sprintf("Index %d out of bounds", e.index)
+}
+
+// operationNotSupportedError reports that operator can't be applied to
+// operands of the given types.
+type operationNotSupportedError struct {
+	operator string
+	// Type names of the operands
+	operands []string
+}
+
+func (e *operationNotSupportedError) Error() string {
+	return fmt.Sprintf("cannot apply '%s' to %s", e.operator, strings.Join(e.operands, " and "))
+}
+
+func operationNotSupported(operator string, operands ...Object) *operationNotSupportedError {
+	types := make([]string, len(operands))
+	for i, o := range operands {
+		types[i] = o.TypeName()
+	}
+	return &operationNotSupportedError{operator: operator, operands: types}
+}
+
+// newErrorObject converts a runtime error into a catchable error object.
+func newErrorObject(err *runtimeError) *errorObject {
+	return &errorObject{message: err.err.Error(), kind: errorKind(err.err), span: err.span}
+}
+
+func errorKind(err error) string {
+	switch err.(type) {
+	case *operationNotSupportedError:
+		return "TypeError"
+	case *indexOutOfBoundsError:
+		return "IndexError"
+	}
+	return "RuntimeError"
+}
+
+// printError prints err to w the way nklg reports errors of interpreted
+// programs, preceded by a traceback of the active function calls.
+func printError(w io.Writer, err *runtimeError) {
+	if len(err.trace) > 0 {
+		fmt.Fprintln(w, "Traceback (most recent call last):")
+		caller := "<main>"
+		for _, frame := range err.trace {
+			fmt.Fprintf(w, "  %s, in %s\n", frame.callSite.Position(), caller)
+			caller = frame.functionName()
+		}
+		fmt.Fprintf(w, "  %s, in %s\n", err.span.Position(), caller)
+	}
+	fmt.Fprintln(w, err)
+}
@@ -0,0 +1,111 @@
+package rt
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// formatObjects renders objects the way println prints them, separated by
+// single spaces.
+func formatObjects(objects []Object, visiting []Object) string {
+	s := ""
+	for i, o := range objects {
+		if i != 0 {
+			s += " "
+		}
+		s += formatObject(o, visiting)
+	}
+	return s
+}
+
+// formatObject renders o inside of the containers being rendered in
+// visiting. A container inside of itself is rendered without its contents,
+// like [...] for arrays.
+func formatObject(o Object, visiting []Object) string {
+	for _, v := range visiting {
+		if v == o {
+			return formatCycle(o)
+		}
+	}
+
+	switch o := o.(type) {
+	case *str:
+		return o.value
+	case *integer:
+		return strconv.FormatInt(o.value, 10)
+	case *float:
+		return strconv.FormatFloat(o.value, 'f', -1, 64)
+	case *boolean:
+		if o.value {
+			return "true"
+		}
+		return "false"
+	case *nilObject:
+		return "nil"
+	case *array:
+		return "[" + formatObjects(o.items, append(visiting, o)) + "]"
+	case *mapObject:
+		visiting = append(visiting, o)
+		s := "{"
+		for i, k := range o.keys {
+			if i != 0 {
+				s += ", "
+			}
+			s += formatObject(k, visiting) + ": " + formatObject(o.values[i], visiting)
+		}
+		return s + "}"
+	case *structType:
+		return "struct " + o.name
+	case *record:
+		visiting = append(visiting, o)
+		s := o.typ.name + "{"
+		for i, f := range o.typ.fields {
+			if i != 0 {
+				s += ", "
+			}
+			s += f + ": " + formatObject(o.values[i], visiting)
+		}
+		return s + "}"
+	case *Class:
+		return "class " + o.Name
+	case *Instance:
+		visiting = append(visiting, o)
+		s := o.Class.Name + "{"
+		for i, f := range o.fields {
+			if i != 0 {
+				s += ", "
+			}
+			s += f + ": " + formatObject(o.values[f], visiting)
+		}
+		return s + "}"
+	case *errorObject:
+		return o.kind + ": " + o.message
+	case *rangeObject:
+		return fmt.Sprintf("range(%d, %d, %d)", o.start, o.end, o.step)
+	case *Function:
+		s := "func("
+		for i, param := range o.Parameters {
+			if i != 0 {
+				s += ", "
+			}
+			s += param
+		}
+		return s + ")"
+	case *builtin:
+		return "[PredefinedFunction]"
+	}
+	return "[Object]"
+}
+
+// formatCycle renders the container o that is already being rendered.
+func formatCycle(o Object) string {
+	switch o := o.(type) {
+	case *mapObject:
+		return "{...}"
+	case *record:
+		return o.typ.name + "{...}"
+	case *Instance:
+		return o.Class.Name + "{...}"
+	}
+	return "[...]"
+}
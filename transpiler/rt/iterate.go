@@ -0,0 +1,87 @@
+package rt
+
+import "github.com/niklaskorz/nklang/ast"
+
+// Iterator steps through the elements of an object looped over with for
+// in. Next returns the index and value of the next element, ok is false once
+// all elements are visited.
+type Iterator interface {
+	Next() (index Object, value Object, ok bool)
+}
+
+// Iterate returns an iterator over o.
+func (r *Runtime) Iterate(at ast.Span, o Object) Iterator {
+	switch o := o.(type) {
+	case *array:
+		return &arrayIterator{array: o}
+	case *str:
+		return &stringIterator{runes: []rune(o.value)}
+	case *mapObject:
+		return &mapIterator{m: o}
+	case *rangeObject:
+		return &rangeIterator{r: o}
+	}
+	r.fail(at, operationNotSupported("for in", o))
+	return nil
+}
+
+// arrayIterator visits the items of an array, including those appended
+// while iterating.
+type arrayIterator struct {
+	array *array
+	i     int
+}
+
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.i >= len(it.array.items) {
+		return nil, nil, false
+	}
+	i := it.i
+	it.i++
+	return Int(int64(i)), it.array.items[i], true
+}
+
+// stringIterator visits a string rune by rune, indexed by rune position.
+type stringIterator struct {
+	runes []rune
+	i     int
+}
+
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.i >= len(it.runes) {
+		return nil, nil, false
+	}
+	i := it.i
+	it.i++
+	return Int(int64(i)), Str(string(it.runes[i])), true
+}
+
+// mapIterator visits a map in insertion order. The index is the key of each
+// entry, the value its value.
+type mapIterator struct {
+	m *mapObject
+	i int
+}
+
+func (it *mapIterator) Next() (Object, Object, bool) {
+	if it.i >= len(it.m.keys) {
+		return nil, nil, false
+	}
+	i := it.i
+	it.i++
+	return it.m.keys[i], it.m.values[i], true
+}
+
+type rangeIterator struct {
+	r *rangeObject
+	i int64
+}
+
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	if it.i >= it.r.Len() {
+		return nil, nil, false
+	}
+	i := it.i
+	it.i++
+	return Int(i), Int(it.r.start + i*it.r.step), true
+}
@@ -0,0 +1,570 @@
+package rt
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// Object is the value type of transpiled programs. Its implementations
+// mirror the objects of the evaluator.
+type Object interface {
+	// TypeName returns the name of the object's type as shown in error messages
+	TypeName() string
+	IsTrue() bool
+	Equals(other Object) bool
+}
+
+// memberAccessible is implemented by objects with members accessible
+// through the dot operator.
+type memberAccessible interface {
+	Member(name string) (Object, error)
+}
+
+// memberAssignable is implemented by objects with members that can be
+// assigned through the dot operator.
+type memberAssignable interface {
+	SetMember(name string, value Object) error
+}
+
+type nilObject struct{}
+
+// Nil is the nil value.
+var Nil Object = &nilObject{}
+
+func (o *nilObject) TypeName() string {
+	return "Nil"
+}
+
+func (o *nilObject) IsTrue() bool {
+	return false
+}
+
+func (o *nilObject) Equals(other Object) bool {
+	return other == Nil
+}
+
+type integer struct {
+	value int64
+}
+
+func Int(v int64) Object {
+	return &integer{value: v}
+}
+
+func (o *integer) TypeName() string {
+	return "Integer"
+}
+
+func (o *integer) IsTrue() bool {
+	return o.value != 0
+}
+
+func (o *integer) Equals(other Object) bool {
+	switch other := other.(type) {
+	case *integer:
+		return o.value == other.value
+	case *float:
+		return float64(o.value) == other.value
+	}
+	return false
+}
+
+type float struct {
+	value float64
+}
+
+func Float(v float64) Object {
+	return &float{value: v}
+}
+
+func (o *float) TypeName() string {
+	return "Float"
+}
+
+func (o *float) IsTrue() bool {
+	return o.value != 0
+}
+
+func (o *float) Equals(other Object) bool {
+	switch other := other.(type) {
+	case *integer:
+		return o.value == float64(other.value)
+	case *float:
+		return o.value == other.value
+	}
+	return false
+}
+
+type str struct {
+	value string
+}
+
+func Str(v string) Object {
+	return &str{value: v}
+}
+
+func (o *str) TypeName() string {
+	return "String"
+}
+
+func (o *str) IsTrue() bool {
+	return o.value != ""
+}
+
+func (o *str) Equals(other Object) bool {
+	v, ok := other.(*str)
+	return ok && o.value == v.value
+}
+
+type boolean struct {
+	value bool
+}
+
+func Bool(v bool) Object {
+	return &boolean{value: v}
+}
+
+func (o *boolean) TypeName() string {
+	return "Boolean"
+}
+
+func (o *boolean) IsTrue() bool {
+	return o.value
+}
+
+func (o *boolean) Equals(other Object) bool {
+	v, ok := other.(*boolean)
+	return ok && o.value == v.value
+}
+
+type array struct {
+	items []Object
+}
+
+// Array creates an array of items.
+func Array(items ...Object) Object {
+	return &array{items: items}
+}
+
+func (o *array) TypeName() string {
+	return "Array"
+}
+
+func (o *array) IsTrue() bool {
+	return len(o.items) > 0
+}
+
+// Equals compares the items by identity, as the evaluator does.
+func (o *array) Equals(other Object) bool {
+	v, ok := other.(*array)
+	if !ok || len(o.items) != len(v.items) {
+		return false
+	}
+	for i, item := range o.items {
+		if item != v.items[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// index resolves i, which counts from the end if negative, in a sequence of
+// length l.
+func index(i, l int64) (int64, error) {
+	j := i
+	if j < 0 {
+		j = l + j
+	}
+	if j < 0 || j >= l {
+		return 0, &indexOutOfBoundsError{index: i}
+	}
+	return j, nil
+}
+
+// hashKey identifies the value of a hashable object. Objects that are equal
+// have the same hashKey.
+type hashKey struct {
+	typ   string
+	value interface{}
+}
+
+// hashable is implemented by objects that can be used as map keys.
+type hashable interface {
+	hashKey() hashKey
+}
+
+func (o *str) hashKey() hashKey {
+	return hashKey{typ: "String", value: o.value}
+}
+
+func (o *integer) hashKey() hashKey {
+	return hashKey{typ: "Integer", value: o.value}
+}
+
+func (o *float) hashKey() hashKey {
+	// Integral floats are equal to integers, so they must hash the same
+	if o.value == math.Trunc(o.value) && o.value >= math.MinInt64 && o.value < math.MaxInt64 {
+		return hashKey{typ: "Integer", value: int64(o.value)}
+	}
+	return hashKey{typ: "Float", value: o.value}
+}
+
+func (o *boolean) hashKey() hashKey {
+	return hashKey{typ: "Boolean", value: o.value}
+}
+
+func (o *nilObject) hashKey() hashKey {
+	return hashKey{typ: "Nil"}
+}
+
+// mapObject associates hashable keys with arbitrary values. Keys are kept in
+// insertion order.
+type mapObject struct {
+	keys    []Object
+	values  []Object
+	indices map[hashKey]int
+}
+
+// Map creates a map from alternating keys, as returned by Key, and values.
+func Map(entries ...Object) Object {
+	m := &mapObject{indices: make(map[hashKey]int)}
+	for i := 0; i < len(entries); i += 2 {
+		m.set(entries[i].(hashable), entries[i+1])
+	}
+	return m
+}
+
+func (o *mapObject) TypeName() string {
+	return "Map"
+}
+
+func (o *mapObject) IsTrue() bool {
+	return len(o.keys) > 0
+}
+
+func (o *mapObject) Equals(other Object) bool {
+	v, ok := other.(*mapObject)
+	if !ok || len(o.keys) != len(v.keys) {
+		return false
+	}
+	for i, k := range o.keys {
+		value, ok := v.get(k.(hashable))
+		if !ok || !o.values[i].Equals(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *mapObject) get(key hashable) (Object, bool) {
+	i, ok := o.indices[key.hashKey()]
+	if !ok {
+		return nil, false
+	}
+	return o.values[i], true
+}
+
+func (o *mapObject) set(key hashable, value Object) {
+	h := key.hashKey()
+	if i, ok := o.indices[h]; ok {
+		o.values[i] = value
+		return
+	}
+	o.indices[h] = len(o.keys)
+	o.keys = append(o.keys, key.(Object))
+	o.values = append(o.values, value)
+}
+
+// structType is the type created by a struct declaration. Calling it
+// creates a record with the arguments as field values.
+type structType struct {
+	name         string
+	fields       []string
+	fieldIndices map[string]int
+}
+
+// Struct creates a struct type with the given fields.
+func Struct(name string, fields ...string) Object {
+	t := &structType{name: name, fields: fields, fieldIndices: make(map[string]int)}
+	for i, f := range fields {
+		t.fieldIndices[f] = i
+	}
+	return t
+}
+
+func (o *structType) TypeName() string {
+	return "Struct"
+}
+
+func (o *structType) IsTrue() bool {
+	return true
+}
+
+func (o *structType) Equals(other Object) bool {
+	return o == other
+}
+
+// record is an instance of a structType. values holds the field values in
+// the order the fields are declared in.
+type record struct {
+	typ    *structType
+	values []Object
+}
+
+func (o *record) TypeName() string {
+	return o.typ.name
+}
+
+func (o *record) IsTrue() bool {
+	return true
+}
+
+func (o *record) Equals(other Object) bool {
+	v, ok := other.(*record)
+	if !ok || o.typ != v.typ {
+		return false
+	}
+	for i, value := range o.values {
+		if !value.Equals(v.values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *record) Member(name string) (Object, error) {
+	i, ok := o.typ.fieldIndices[name]
+	if !ok {
+		return nil, fmt.Errorf("%s has no member %s", o.typ.name, name)
+	}
+	return o.values[i], nil
+}
+
+func (o *record) SetMember(name string, value Object) error {
+	i, ok := o.typ.fieldIndices[name]
+	if !ok {
+		return fmt.Errorf("%s has no member %s", o.typ.name, name)
+	}
+	o.values[i] = value
+	return nil
+}
+
+// rangeObject is a lazy sequence of integers from start up to, but not
+// including, end, advancing by step.
+type rangeObject struct {
+	start, end, step int64
+}
+
+// Len returns the number of integers in the range.
+func (o *rangeObject) Len() int64 {
+	if o.step > 0 && o.start < o.end {
+		return (o.end - o.start + o.step - 1) / o.step
+	}
+	if o.step < 0 && o.start > o.end {
+		return (o.start - o.end - o.step - 1) / -o.step
+	}
+	return 0
+}
+
+func (o *rangeObject) TypeName() string {
+	return "Range"
+}
+
+func (o *rangeObject) IsTrue() bool {
+	return o.Len() > 0
+}
+
+func (o *rangeObject) Equals(other Object) bool {
+	v, ok := other.(*rangeObject)
+	return ok && *o == *v
+}
+
+// errorObject is the object bound by a catch clause for runtime errors, and
+// can be thrown like any other object.
+type errorObject struct {
+	message string
+	kind    string
+	// Position the error occurred at, set when it is thrown if still empty
+	span ast.Span
+}
+
+func (o *errorObject) TypeName() string {
+	return "Error"
+}
+
+func (o *errorObject) IsTrue() bool {
+	return true
+}
+
+func (o *errorObject) Equals(other Object) bool {
+	return o == other
+}
+
+func (o *errorObject) Member(name string) (Object, error) {
+	switch name {
+	case "message":
+		return Str(o.message), nil
+	case "kind":
+		return Str(o.kind), nil
+	case "position":
+		return Str(o.span.Position()), nil
+	case "line":
+		return Int(int64(o.span.Line)), nil
+	case "column":
+		return Int(int64(o.span.Column)), nil
+	}
+	return nil, fmt.Errorf("Error has no member %s", name)
+}
+
+// Function is an nklang function compiled to a Go function.
+type Function struct {
+	// Name the function was declared with, empty for anonymous functions
+	Name       string
+	Parameters []string
+	fn         func(args []Object) Object
+}
+
+func NewFunction(name string, parameters []string, fn func(args []Object) Object) *Function {
+	return &Function{Name: name, Parameters: parameters, fn: fn}
+}
+
+func (o *Function) TypeName() string {
+	return "Function"
+}
+
+func (o *Function) IsTrue() bool {
+	return true
+}
+
+func (o *Function) Equals(other Object) bool {
+	return o == other
+}
+
+// builtin is a predefined function implemented in Go.
+type builtin struct {
+	fn func(args []Object) (Object, error)
+}
+
+func (o *builtin) TypeName() string {
+	return "Function"
+}
+
+func (o *builtin) IsTrue() bool {
+	return true
+}
+
+func (o *builtin) Equals(other Object) bool {
+	return o == other
+}
+
+// Method creates a method bound to self and, for subclasses, super.
+type Method func(self, super Object) *Function
+
+// Class is the object created by a class declaration. Calling it creates an
+// Instance and runs the init method, if the class or one of its ancestors
+// defines one.
+type Class struct {
+	Name    string
+	Parent  *Class
+	methods map[string]Method
+}
+
+func (o *Class) TypeName() string {
+	return "Class"
+}
+
+func (o *Class) IsTrue() bool {
+	return true
+}
+
+func (o *Class) Equals(other Object) bool {
+	return o == other
+}
+
+// lookupMethod searches the class and its ancestors for the method name and
+// returns it along with the class defining it.
+func (o *Class) lookupMethod(name string) (Method, *Class) {
+	for c := o; c != nil; c = c.Parent {
+		if m, ok := c.methods[name]; ok {
+			return m, c
+		}
+	}
+	return nil, nil
+}
+
+// bind returns the method m of class c bound to self.
+func bind(m Method, c *Class, self *Instance) *Function {
+	var super Object
+	if c.Parent != nil {
+		super = &Super{class: c.Parent, self: self}
+	}
+	return m(self, super)
+}
+
+// Instance is an object created by calling a Class. Fields are created by
+// assigning to them and kept in assignment order.
+type Instance struct {
+	Class  *Class
+	fields []string
+	values map[string]Object
+}
+
+func (o *Instance) TypeName() string {
+	return o.Class.Name
+}
+
+func (o *Instance) IsTrue() bool {
+	return true
+}
+
+func (o *Instance) Equals(other Object) bool {
+	return o == other
+}
+
+// Member returns the field name or, if there is no such field, the method
+// name bound to the instance.
+func (o *Instance) Member(name string) (Object, error) {
+	if v, ok := o.values[name]; ok {
+		return v, nil
+	}
+	if m, c := o.Class.lookupMethod(name); m != nil {
+		return bind(m, c, o), nil
+	}
+	return nil, fmt.Errorf("%s has no member %s", o.Class.Name, name)
+}
+
+func (o *Instance) SetMember(name string, value Object) error {
+	if _, ok := o.values[name]; !ok {
+		o.fields = append(o.fields, name)
+	}
+	o.values[name] = value
+	return nil
+}
+
+// Super gives methods of a subclass access to the methods of the parent
+// class, bound to the same instance.
+type Super struct {
+	class *Class
+	self  *Instance
+}
+
+func (o *Super) TypeName() string {
+	return "Super"
+}
+
+func (o *Super) IsTrue() bool {
+	return true
+}
+
+func (o *Super) Equals(other Object) bool {
+	return false
+}
+
+func (o *Super) Member(name string) (Object, error) {
+	if m, c := o.class.lookupMethod(name); m != nil {
+		return bind(m, c, o.self), nil
+	}
+	return nil, fmt.Errorf("%s has no method %s", o.class.Name, name)
+}
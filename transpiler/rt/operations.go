@@ -0,0 +1,226 @@
+package rt
+
+import (
+	"fmt"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// Truthy reports whether o counts as true in conditions.
+func Truthy(o Object) bool {
+	return o.IsTrue()
+}
+
+func (r *Runtime) Binary(at ast.Span, op ast.BinaryOperator, a, b Object) Object {
+	v, err := binary(op, a, b)
+	r.fail(at, err)
+	return v
+}
+
+func binary(op ast.BinaryOperator, a, b Object) (Object, error) {
+	switch op {
+	case ast.BinaryOperatorEq:
+		return Bool(a.Equals(b)), nil
+	case ast.BinaryOperatorNe:
+		return Bool(!a.Equals(b)), nil
+	case ast.BinaryOperatorLand:
+		if !a.IsTrue() {
+			return a, nil
+		}
+		return b, nil
+	case ast.BinaryOperatorLor:
+		if a.IsTrue() {
+			return a, nil
+		}
+		return b, nil
+	}
+
+	switch a := a.(type) {
+	case *integer:
+		switch b := b.(type) {
+		case *integer:
+			return integerOperation(op, a.value, b.value)
+		case *float:
+			return floatOperation(op, float64(a.value), b.value), nil
+		}
+	case *float:
+		switch b := b.(type) {
+		case *integer:
+			return floatOperation(op, a.value, float64(b.value)), nil
+		case *float:
+			return floatOperation(op, a.value, b.value), nil
+		}
+	case *str:
+		if b, ok := b.(*str); ok && op == ast.BinaryOperatorAdd {
+			return Str(a.value + b.value), nil
+		}
+	}
+	return nil, operationNotSupported(op.String(), a, b)
+}
+
+// integerOperation applies the comparison or arithmetic operator op to two
+// integers.
+func integerOperation(op ast.BinaryOperator, a, b int64) (Object, error) {
+	switch op {
+	case ast.BinaryOperatorLt:
+		return Bool(a < b), nil
+	case ast.BinaryOperatorLe:
+		return Bool(a <= b), nil
+	case ast.BinaryOperatorGt:
+		return Bool(a > b), nil
+	case ast.BinaryOperatorGe:
+		return Bool(a >= b), nil
+	case ast.BinaryOperatorAdd:
+		return Int(a + b), nil
+	case ast.BinaryOperatorSub:
+		return Int(a - b), nil
+	case ast.BinaryOperatorMul:
+		return Int(a * b), nil
+	}
+	if b == 0 {
+		return nil, fmt.Errorf("Division by zero")
+	}
+	return Int(a / b), nil
+}
+
+// floatOperation applies the comparison or arithmetic operator op to two
+// numbers of which at least one is a float.
+func floatOperation(op ast.BinaryOperator, a, b float64) Object {
+	switch op {
+	case ast.BinaryOperatorLt:
+		return Bool(a < b)
+	case ast.BinaryOperatorLe:
+		return Bool(a <= b)
+	case ast.BinaryOperatorGt:
+		return Bool(a > b)
+	case ast.BinaryOperatorGe:
+		return Bool(a >= b)
+	case ast.BinaryOperatorAdd:
+		return Float(a + b)
+	case ast.BinaryOperatorSub:
+		return Float(a - b)
+	case ast.BinaryOperatorMul:
+		return Float(a * b)
+	}
+	return Float(a / b)
+}
+
+func (r *Runtime) Unary(at ast.Span, op ast.UnaryOperator, a Object) Object {
+	switch op {
+	case ast.UnaryOperatorLnot:
+		return Bool(!a.IsTrue())
+	case ast.UnaryOperatorPos:
+		switch a.(type) {
+		case *integer, *float:
+			return a
+		}
+	case ast.UnaryOperatorNeg:
+		switch a := a.(type) {
+		case *integer:
+			return Int(-a.value)
+		case *float:
+			return Float(-a.value)
+		}
+	}
+	r.fail(at, operationNotSupported(op.String(), a))
+	return nil
+}
+
+// Interpolate concatenates the formatted parts of an interpolated string.
+func Interpolate(parts ...Object) Object {
+	s := ""
+	for _, p := range parts {
+		s += formatObject(p, nil)
+	}
+	return Str(s)
+}
+
+// Key checks that k can be used as key of a map literal.
+func (r *Runtime) Key(at ast.Span, k Object) Object {
+	if _, ok := k.(hashable); !ok {
+		r.fail(at, fmt.Errorf("%s can't be used as map key", k.TypeName()))
+	}
+	return k
+}
+
+func (r *Runtime) Subscript(at ast.Span, target, index Object) Object {
+	v, err := subscript(target, index)
+	r.fail(at, err)
+	return v
+}
+
+func subscript(target, i Object) (Object, error) {
+	switch o := target.(type) {
+	case *array:
+		if i, ok := i.(*integer); ok {
+			j, err := index(i.value, int64(len(o.items)))
+			if err != nil {
+				return nil, err
+			}
+			return o.items[j], nil
+		}
+	case *str:
+		if i, ok := i.(*integer); ok {
+			j, err := index(i.value, int64(len(o.value)))
+			if err != nil {
+				return nil, err
+			}
+			return Str(string(o.value[j])), nil
+		}
+	case *rangeObject:
+		if i, ok := i.(*integer); ok {
+			j, err := index(i.value, o.Len())
+			if err != nil {
+				return nil, err
+			}
+			return Int(o.start + j*o.step), nil
+		}
+	case *mapObject:
+		// Missing keys have the value nil
+		if k, ok := i.(hashable); ok {
+			if v, ok := o.get(k); ok {
+				return v, nil
+			}
+			return Nil, nil
+		}
+	default:
+		return nil, operationNotSupported("[]", target)
+	}
+	return nil, operationNotSupported("[]", target, i)
+}
+
+func (r *Runtime) SetSubscript(at ast.Span, target, i, value Object) {
+	switch o := target.(type) {
+	case *array:
+		if i, ok := i.(*integer); ok {
+			j, err := index(i.value, int64(len(o.items)))
+			r.fail(at, err)
+			o.items[j] = value
+			return
+		}
+	case *mapObject:
+		if k, ok := i.(hashable); ok {
+			o.set(k, value)
+			return
+		}
+	}
+	r.fail(at, operationNotSupported("[]=", target, i))
+}
+
+func (r *Runtime) Member(at ast.Span, target Object, name string) Object {
+	o, ok := target.(memberAccessible)
+	if !ok {
+		r.fail(at, operationNotSupported("."+name, target))
+	}
+	v, err := o.Member(name)
+	r.fail(at, err)
+	return v
+}
+
+func (r *Runtime) SetMember(at ast.Span, target Object, name string, value Object) {
+	o, ok := target.(memberAssignable)
+	if !ok {
+		r.fail(at, operationNotSupported("."+name+"=", target))
+	}
+	r.fail(at, o.SetMember(name, value))
+}
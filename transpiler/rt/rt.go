@@ -0,0 +1,188 @@
+// Package rt is the runtime of Go programs generated by the transpiler.
+// Its objects, operations and builtins mirror those of the evaluator, so
+// transpiled programs behave like interpreted ones. Errors raised at
+// runtime and thrown values unwind the Go stack as panics until they are
+// caught by Try or reach Run.
+package rt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// Runtime is the state of one run of a program: the functions currently
+// being called and the console of the builtins.
+type Runtime struct {
+	// Frames of the active calls, outermost first
+	stack []stackFrame
+	out   io.Writer
+	// Kept between calls of input, as it may have read ahead
+	in *bufio.Reader
+}
+
+// Run runs main, the top level statements of a program, on the standard
+// input and output of the process and prints the error that ended it, if
+// any.
+func Run(main func(r *Runtime)) {
+	r := &Runtime{out: os.Stdout, in: bufio.NewReader(os.Stdin)}
+	defer func() {
+		v := recover()
+		if e, ok := v.(*thrownError); ok {
+			v = e.runtimeError()
+		}
+		if v == nil {
+			return
+		}
+		e, ok := v.(*runtimeError)
+		if !ok {
+			panic(v)
+		}
+		printError(r.out, e)
+		os.Exit(1)
+	}()
+	main(r)
+}
+
+func (r *Runtime) snapshot() []stackFrame {
+	frames := make([]stackFrame, len(r.stack))
+	copy(frames, r.stack)
+	return frames
+}
+
+// fail raises err as runtime error at span, unless err is nil.
+func (r *Runtime) fail(span ast.Span, err error) {
+	if err == nil {
+		return
+	}
+	e := &runtimeError{span: span, err: err}
+	if len(r.stack) > 0 {
+		e.trace = r.snapshot()
+	}
+	panic(e)
+}
+
+// Call calls callee with args.
+func (r *Runtime) Call(at ast.Span, callee Object, args ...Object) Object {
+	switch callee := callee.(type) {
+	case *Function:
+		return r.call(at, callee, args)
+	case *builtin:
+		v, err := callee.fn(args)
+		r.fail(at, err)
+		return v
+	case *structType:
+		if len(args) != len(callee.fields) {
+			r.fail(at, fmt.Errorf("Expected %d arguments, got %d", len(callee.fields), len(args)))
+		}
+		return &record{typ: callee, values: args}
+	case *Class:
+		instance := &Instance{Class: callee, values: make(map[string]Object)}
+		init, c := callee.lookupMethod("init")
+		if init == nil {
+			if len(args) != 0 {
+				r.fail(at, fmt.Errorf("Expected 0 arguments, got %d", len(args)))
+			}
+			return instance
+		}
+		r.call(at, bind(init, c, instance), args)
+		return instance
+	}
+	r.fail(at, operationNotSupported("()", callee))
+	return nil
+}
+
+func (r *Runtime) call(at ast.Span, f *Function, args []Object) Object {
+	if len(args) != len(f.Parameters) {
+		r.fail(at, fmt.Errorf("Expected %d arguments, got %d", len(f.Parameters), len(args)))
+	}
+	r.stack = append(r.stack, stackFrame{name: f.Name, callSite: at})
+	defer func() {
+		r.stack = r.stack[:len(r.stack)-1]
+	}()
+	return f.fn(args)
+}
+
+// NewClass creates a class inheriting from parent, which is nil for classes
+// without superclass. at is the position of the superclass.
+func (r *Runtime) NewClass(at ast.Span, name string, parent Object, methods map[string]Method) *Class {
+	c := &Class{Name: name, methods: methods}
+	if parent != nil {
+		p, ok := parent.(*Class)
+		if !ok {
+			r.fail(at, fmt.Errorf("Can't inherit from %s", parent.TypeName()))
+		}
+		c.Parent = p
+	}
+	return c
+}
+
+// Throw throws v.
+func (r *Runtime) Throw(at ast.Span, v Object) {
+	if e, ok := v.(*errorObject); ok && e.span == (ast.Span{}) {
+		e.span = at
+	}
+	panic(&thrownError{span: at, value: v, trace: r.snapshot()})
+}
+
+// Control tells how the statements of a try statement were left.
+type Control int
+
+const (
+	// Normal means all statements have run
+	Normal Control = iota
+	Return
+	Break
+	Continue
+)
+
+// Block is a block of a try statement. It returns how it was left and, for
+// Return, the returned value.
+type Block func() (Control, Object)
+
+// Try runs a try statement. catch and finally are nil if the statement has
+// no such clause.
+func Try(body Block, catch func(e Object) (Control, Object), finally Block) (Control, Object) {
+	c, v, err := protect(body)
+	if catch != nil && err != nil {
+		var caught Object
+		switch e := err.(type) {
+		case *thrownError:
+			caught = e.value
+		case *runtimeError:
+			caught = newErrorObject(e)
+		}
+		c, v, err = protect(func() (Control, Object) {
+			return catch(caught)
+		})
+	}
+	if finally != nil {
+		// Errors and control flow leaving the finally block take precedence
+		if fc, fv := finally(); fc != Normal {
+			return fc, fv
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+	return c, v
+}
+
+// protect runs b, recovering from runtime errors and thrown values.
+func protect(b Block) (c Control, v Object, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case *thrownError, *runtimeError:
+				err = e.(error)
+			default:
+				panic(r)
+			}
+		}
+	}()
+	c, v = b()
+	return
+}
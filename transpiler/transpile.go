@@ -0,0 +1,693 @@
+// Package transpiler translates nklang programs to standalone Go programs.
+// The generated code keeps nklang's dynamic typing by representing all
+// values as rt.Object, so it needs the rt package at runtime.
+package transpiler
+
+import (
+	"fmt"
+	"go/format"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/niklaskorz/nklang/ast"
+)
+
+// variable is a variable of the generated Go code.
+type variable struct {
+	name  string
+	index int
+	// Set if the Go code reads the variable
+	used bool
+	// Set while the value of the variable's declaration is generated, to
+	// find declarations referring to themselves
+	declaring      bool
+	selfReferenced bool
+	// Name of the builtin held by the variable, if any
+	builtin string
+}
+
+// scope mirrors the definition scopes of the semantic analysis, so slots
+// resolve to the same variables.
+type scope struct {
+	parent *scope
+	slots  []*variable
+}
+
+func (s *scope) newScope() *scope {
+	return &scope{parent: s}
+}
+
+func (s *scope) declare(slot int, v *variable) {
+	for len(s.slots) <= slot {
+		s.slots = append(s.slots, nil)
+	}
+	s.slots[slot] = v
+}
+
+func (s *scope) lookup(index, slot int) *variable {
+	for ; index > 0; index-- {
+		s = s.parent
+	}
+	return s.slots[slot]
+}
+
+// context describes the Go function the generated statements belong to.
+type context struct {
+	// Set inside of nklang functions, where return is allowed
+	function bool
+	// Set in the Go functions generated for the blocks of try statements,
+	// which pass control flow leaving them on to rt.Try
+	try bool
+	// Number of loops open in the Go function
+	loops int
+	// Set if a loop of the same nklang function encloses the try statement
+	outerLoop bool
+}
+
+type transpiler struct {
+	out       *strings.Builder
+	ctx       context
+	variables []*variable
+	builtins  []*variable
+}
+
+// Transpile translates p to the source code of a Go program. predefined
+// lists the names declared in the global scope of the semantic analysis,
+// in order of declaration; the generated program gets them from its
+// runtime. Programs using eval can't be transpiled, as the runtime has no
+// interpreter.
+func Transpile(p *ast.Program, predefined []string) ([]byte, error) {
+	t := &transpiler{out: &strings.Builder{}}
+	global := &scope{}
+	for i, name := range predefined {
+		v := t.newVariable(name)
+		v.builtin = name
+		t.builtins = append(t.builtins, v)
+		global.declare(i, v)
+	}
+	if err := t.statements(global, p.Statements); err != nil {
+		return nil, err
+	}
+
+	file := ""
+	if len(p.Statements) > 0 {
+		file = p.Statements[0].Location().File
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by nklg transpile from %s. DO NOT EDIT.\n\n", file)
+	b.WriteString("package main\n\n")
+	b.WriteString("import (\n\"github.com/niklaskorz/nklang/ast\"\n\"github.com/niklaskorz/nklang/transpiler/rt\"\n)\n\n")
+	b.WriteString("func at(line, column int) ast.Span {\n")
+	fmt.Fprintf(&b, "return ast.Span{File: %s, Line: line, Column: column}\n}\n\n", strconv.Quote(file))
+	b.WriteString("func main() {\nrt.Run(func(r *rt.Runtime) {\n")
+	for _, v := range t.builtins {
+		if v.used {
+			fmt.Fprintf(&b, "%s := r.Builtin(%s)\n", v.name, strconv.Quote(v.builtin))
+		}
+	}
+	b.WriteString(t.removeUnusedMarkers(t.out.String()))
+	b.WriteString("})\n}\n")
+	return format.Source([]byte(b.String()))
+}
+
+func (t *transpiler) newVariable(name string) *variable {
+	v := &variable{name: fmt.Sprintf("%s_%d", name, len(t.variables)), index: len(t.variables)}
+	t.variables = append(t.variables, v)
+	return v
+}
+
+// markUnused marks the place after the declaration of v, where the
+// variable is read if the generated code doesn't read it otherwise, as Go
+// rejects unused variables.
+func (t *transpiler) markUnused(v *variable) {
+	t.printf("\x00%d\x00\n", v.index)
+}
+
+var unusedMarker = regexp.MustCompile("\x00([0-9]+)\x00\n")
+
+func (t *transpiler) removeUnusedMarkers(code string) string {
+	return unusedMarker.ReplaceAllStringFunc(code, func(m string) string {
+		i, _ := strconv.Atoi(m[1 : len(m)-2])
+		v := t.variables[i]
+		if v.used {
+			return ""
+		}
+		return "_ = " + v.name + "\n"
+	})
+}
+
+func (t *transpiler) printf(format string, a ...interface{}) {
+	fmt.Fprintf(t.out, format, a...)
+}
+
+// nested generates the statements of a nested Go function in ctx and
+// returns them.
+func (t *transpiler) nested(ctx context, generate func() error) (string, error) {
+	out, saved := t.out, t.ctx
+	t.out, t.ctx = &strings.Builder{}, ctx
+	err := generate()
+	code := t.out.String()
+	t.out, t.ctx = out, saved
+	return code, err
+}
+
+func at(n ast.Node) string {
+	s := n.Location()
+	return fmt.Sprintf("at(%d, %d)", s.Line, s.Column)
+}
+
+// statements generates statements up to the first one that always ends
+// the block, as Go reports code following it as unreachable.
+func (t *transpiler) statements(s *scope, statements []ast.Statement) error {
+	for _, n := range statements {
+		if err := t.statement(s, n); err != nil {
+			return err
+		}
+		if terminatesStatement(n) {
+			break
+		}
+	}
+	return nil
+}
+
+// terminates reports whether statements always end with a return, break or
+// continue statement.
+func terminates(statements []ast.Statement) bool {
+	for _, n := range statements {
+		if terminatesStatement(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func terminatesStatement(n ast.Statement) bool {
+	switch n := n.(type) {
+	case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		return true
+	case *ast.IfStatement:
+		for ; n != nil; n = n.ElseBranch {
+			if !terminates(n.Statements) {
+				return false
+			}
+			if n.Condition == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withReturn appends the statement ret to the code generated for
+// statements, unless they always end before reaching it.
+func withReturn(code string, statements []ast.Statement, ret string) string {
+	if terminates(statements) {
+		return code
+	}
+	return code + ret + "\n"
+}
+
+func (t *transpiler) block(s *scope, statements []ast.Statement) error {
+	t.printf(" {\n")
+	if err := t.statements(s, statements); err != nil {
+		return err
+	}
+	t.printf("}")
+	return nil
+}
+
+func (t *transpiler) statement(s *scope, n ast.Statement) error {
+	switch n := n.(type) {
+	case *ast.IfStatement:
+		if err := t.ifStatement(s, n); err != nil {
+			return err
+		}
+		t.printf("\n")
+	case *ast.WhileStatement:
+		cond, err := t.expression(s, n.Condition)
+		if err != nil {
+			return err
+		}
+		t.printf("for rt.Truthy(%s)", cond)
+		t.ctx.loops++
+		err = t.block(s.newScope(), n.Statements)
+		t.ctx.loops--
+		if err != nil {
+			return err
+		}
+		t.printf("\n")
+	case *ast.ForStatement:
+		return t.forStatement(s, n)
+	case *ast.StructDeclaration:
+		v := t.newVariable(n.Name)
+		s.declare(n.Slot, v)
+		t.printf("%s := rt.Struct(%s", v.name, strconv.Quote(n.Name))
+		for _, f := range n.Fields {
+			t.printf(", %s", strconv.Quote(f))
+		}
+		t.printf(")\n")
+		t.markUnused(v)
+	case *ast.ClassDeclaration:
+		return t.classDeclaration(s, n)
+	case *ast.DeclarationStatement:
+		v := t.newVariable(n.Identifier)
+		s.declare(n.Slot, v)
+		return t.declare(v, func() (string, error) {
+			return t.expression(s, n.Value)
+		})
+	case *ast.AssignmentStatement:
+		value, err := t.expression(s, n.Value)
+		if err != nil {
+			return err
+		}
+		t.printf("%s = %s\n", s.lookup(n.ScopeIndex, n.Slot).name, value)
+	case *ast.SubscriptAssignmentStatement:
+		target, err := t.expression(s, n.Target)
+		if err != nil {
+			return err
+		}
+		index, err := t.expression(s, n.Index)
+		if err != nil {
+			return err
+		}
+		value, err := t.expression(s, n.Value)
+		if err != nil {
+			return err
+		}
+		t.printf("r.SetSubscript(%s, %s, %s, %s)\n", at(n), target, index, value)
+	case *ast.MemberAssignmentStatement:
+		target, err := t.expression(s, n.Target)
+		if err != nil {
+			return err
+		}
+		value, err := t.expression(s, n.Value)
+		if err != nil {
+			return err
+		}
+		t.printf("r.SetMember(%s, %s, %s, %s)\n", at(n), target, strconv.Quote(n.Name), value)
+	case *ast.TryStatement:
+		return t.tryStatement(s, n)
+	case *ast.ReturnStatement:
+		if !t.ctx.function {
+			return newError(n, "Unexpected return statement")
+		}
+		value, err := t.expression(s, n.Expression)
+		if err != nil {
+			return err
+		}
+		if t.ctx.try {
+			t.printf("return rt.Return, %s\n", value)
+		} else {
+			t.printf("return %s\n", value)
+		}
+	case *ast.ThrowStatement:
+		value, err := t.expression(s, n.Expression)
+		if err != nil {
+			return err
+		}
+		t.printf("r.Throw(%s, %s)\n", at(n), value)
+	case *ast.ContinueStatement:
+		return t.loopControl(n, "continue", "rt.Continue")
+	case *ast.BreakStatement:
+		return t.loopControl(n, "break", "rt.Break")
+	case *ast.ExpressionStatement:
+		value, err := t.expression(s, n.Expression)
+		if err != nil {
+			return err
+		}
+		if _, ok := n.Expression.(*ast.CallExpression); ok {
+			t.printf("%s\n", value)
+		} else {
+			t.printf("_ = %s\n", value)
+		}
+	}
+	return nil
+}
+
+// declare declares v with the value generated by value. Declarations
+// referring to themselves, such as recursive functions, declare v first,
+// as nklang does.
+func (t *transpiler) declare(v *variable, value func() (string, error)) error {
+	v.declaring = true
+	code, err := value()
+	v.declaring = false
+	if err != nil {
+		return err
+	}
+	if v.selfReferenced {
+		t.printf("var %s rt.Object = rt.Nil\n%s = %s\n", v.name, v.name, code)
+	} else {
+		t.printf("%s := %s\n", v.name, code)
+	}
+	t.markUnused(v)
+	return nil
+}
+
+func (t *transpiler) ifStatement(s *scope, n *ast.IfStatement) error {
+	if n.Condition != nil {
+		cond, err := t.expression(s, n.Condition)
+		if err != nil {
+			return err
+		}
+		t.printf("if rt.Truthy(%s)", cond)
+	}
+	if err := t.block(s.newScope(), n.Statements); err != nil {
+		return err
+	}
+	if n.ElseBranch != nil {
+		t.printf(" else ")
+		return t.ifStatement(s, n.ElseBranch)
+	}
+	return nil
+}
+
+func (t *transpiler) forStatement(s *scope, n *ast.ForStatement) error {
+	iterable, err := t.expression(s, n.Iterable)
+	if err != nil {
+		return err
+	}
+	ds := s.newScope()
+	index := "_"
+	var indexVariable *variable
+	if n.IndexIdentifier != "" {
+		indexVariable = t.newVariable(n.IndexIdentifier)
+		ds.declare(n.IndexSlot, indexVariable)
+		index = indexVariable.name
+	}
+	value := t.newVariable(n.ValueIdentifier)
+	ds.declare(n.ValueSlot, value)
+
+	t.printf("for it := r.Iterate(%s, %s); ; {\n", at(n), iterable)
+	t.printf("%s, %s, ok := it.Next()\nif !ok {\nbreak\n}\n", index, value.name)
+	if indexVariable != nil {
+		t.markUnused(indexVariable)
+	}
+	t.markUnused(value)
+	t.ctx.loops++
+	err = t.statements(ds, n.Statements)
+	t.ctx.loops--
+	if err != nil {
+		return err
+	}
+	t.printf("}\n")
+	return nil
+}
+
+func (t *transpiler) classDeclaration(s *scope, n *ast.ClassDeclaration) error {
+	v := t.newVariable(n.Name)
+	s.declare(n.Slot, v)
+	return t.declare(v, func() (string, error) {
+		superclass, position := "nil", at(n)
+		if n.Superclass != nil {
+			var err error
+			if superclass, err = t.expression(s, n.Superclass); err != nil {
+				return "", err
+			}
+			position = at(n.Superclass)
+		}
+
+		ds := s.newScope()
+		self := t.newVariable("self")
+		ds.declare(0, self)
+		super := "_"
+		if n.Superclass != nil {
+			v := t.newVariable("super")
+			ds.declare(1, v)
+			super = v.name
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "r.NewClass(%s, %s, %s, map[string]rt.Method{\n", position, strconv.Quote(n.Name), superclass)
+		for _, m := range n.Methods {
+			f, err := t.function(ds, m)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&b, "%s: func(%s, %s rt.Object) *rt.Function {\nreturn %s\n},\n", strconv.Quote(m.Name), self.name, super, f)
+		}
+		b.WriteString("})")
+		return b.String(), nil
+	})
+}
+
+func (t *transpiler) tryStatement(s *scope, n *ast.TryStatement) error {
+	ctx := context{
+		function:  t.ctx.function,
+		try:       true,
+		outerLoop: t.ctx.loops > 0 || t.ctx.outerLoop,
+	}
+
+	body, err := t.nested(ctx, func() error {
+		return t.statements(s.newScope(), n.Statements)
+	})
+	if err != nil {
+		return err
+	}
+	blocks := []string{"func() (rt.Control, rt.Object) {\n" + withReturn(body, n.Statements, "return rt.Normal, nil") + "}"}
+
+	if n.Catch != nil {
+		ds := s.newScope()
+		v := t.newVariable(n.Catch.Identifier)
+		ds.declare(n.Catch.Slot, v)
+		catch, err := t.nested(ctx, func() error {
+			return t.statements(ds, n.Catch.Statements)
+		})
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, "func("+v.name+" rt.Object) (rt.Control, rt.Object) {\n"+withReturn(catch, n.Catch.Statements, "return rt.Normal, nil")+"}")
+	} else {
+		blocks = append(blocks, "nil")
+	}
+
+	if n.Finally != nil {
+		finally, err := t.nested(ctx, func() error {
+			return t.statements(s.newScope(), n.Finally)
+		})
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, "func() (rt.Control, rt.Object) {\n"+withReturn(finally, n.Finally, "return rt.Normal, nil")+"}")
+	} else {
+		blocks = append(blocks, "nil")
+	}
+
+	call := "rt.Try(" + strings.Join(blocks, ", ") + ")"
+
+	// Pass on control flow that left the try statement
+	var handlers []string
+	value := "_"
+	if t.ctx.try {
+		handlers = append(handlers, "return c, v")
+		value = "v"
+	} else {
+		if t.ctx.loops > 0 {
+			handlers = append(handlers, "if c == rt.Break {\nbreak\n}", "if c == rt.Continue {\ncontinue\n}")
+		}
+		if t.ctx.function {
+			handlers = append(handlers, "return v")
+			value = "v"
+		}
+	}
+	if len(handlers) == 0 {
+		t.printf("%s\n", call)
+		return nil
+	}
+	t.printf("if c, %s := %s; c != rt.Normal {\n%s\n}\n", value, call, strings.Join(handlers, "\n"))
+	return nil
+}
+
+func (t *transpiler) loopControl(n ast.Node, keyword, control string) error {
+	switch {
+	case t.ctx.loops > 0:
+		t.printf("%s\n", keyword)
+	case t.ctx.try && t.ctx.outerLoop:
+		t.printf("return %s, nil\n", control)
+	default:
+		return newError(n, "Unexpected %s statement", keyword)
+	}
+	return nil
+}
+
+// function returns an expression creating the function n, declared in s.
+func (t *transpiler) function(s *scope, n *ast.Function) (string, error) {
+	captures := &scope{}
+	for i, c := range n.Captures {
+		captures.declare(i, s.lookup(c.ScopeIndex, c.Slot))
+	}
+	parameters := captures.newScope()
+	var names []string
+	body, err := t.nested(context{function: true}, func() error {
+		for i, p := range n.Parameters {
+			names = append(names, strconv.Quote(p))
+			v := t.newVariable(p)
+			parameters.declare(i, v)
+			t.printf("%s := args[%d]\n", v.name, i)
+			t.markUnused(v)
+		}
+		return t.statements(parameters.newScope(), n.Statements)
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rt.NewFunction(%s, []string{%s}, func(args []rt.Object) rt.Object {\n%s})",
+		strconv.Quote(n.Name), strings.Join(names, ", "), withReturn(body, n.Statements, "return rt.Nil")), nil
+}
+
+var binaryOperators = map[ast.BinaryOperator]string{
+	ast.BinaryOperatorEq:   "ast.BinaryOperatorEq",
+	ast.BinaryOperatorNe:   "ast.BinaryOperatorNe",
+	ast.BinaryOperatorLt:   "ast.BinaryOperatorLt",
+	ast.BinaryOperatorLe:   "ast.BinaryOperatorLe",
+	ast.BinaryOperatorGt:   "ast.BinaryOperatorGt",
+	ast.BinaryOperatorGe:   "ast.BinaryOperatorGe",
+	ast.BinaryOperatorAdd:  "ast.BinaryOperatorAdd",
+	ast.BinaryOperatorSub:  "ast.BinaryOperatorSub",
+	ast.BinaryOperatorMul:  "ast.BinaryOperatorMul",
+	ast.BinaryOperatorDiv:  "ast.BinaryOperatorDiv",
+	ast.BinaryOperatorLand: "ast.BinaryOperatorLand",
+	ast.BinaryOperatorLor:  "ast.BinaryOperatorLor",
+}
+
+var unaryOperators = map[ast.UnaryOperator]string{
+	ast.UnaryOperatorLnot: "ast.UnaryOperatorLnot",
+	ast.UnaryOperatorPos:  "ast.UnaryOperatorPos",
+	ast.UnaryOperatorNeg:  "ast.UnaryOperatorNeg",
+}
+
+func (t *transpiler) expressions(s *scope, expressions []ast.Expression) ([]string, error) {
+	values := make([]string, len(expressions))
+	for i, e := range expressions {
+		v, err := t.expression(s, e)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func (t *transpiler) expression(s *scope, n ast.Expression) (string, error) {
+	switch n := n.(type) {
+	case *ast.Integer:
+		return fmt.Sprintf("rt.Int(%d)", n.Value), nil
+	case *ast.Float:
+		return fmt.Sprintf("rt.Float(%s)", strconv.FormatFloat(n.Value, 'g', -1, 64)), nil
+	case *ast.String:
+		return fmt.Sprintf("rt.Str(%s)", strconv.Quote(n.Value)), nil
+	case *ast.Boolean:
+		return fmt.Sprintf("rt.Bool(%t)", n.Value), nil
+	case *ast.Nil:
+		return "rt.Nil", nil
+	case *ast.LookupExpression:
+		v := s.lookup(n.ScopeIndex, n.Slot)
+		if v.builtin == "eval" {
+			return "", newError(n, "eval is not supported by transpiled programs")
+		}
+		v.used = true
+		if v.declaring {
+			v.selfReferenced = true
+		}
+		return v.name, nil
+	case *ast.InterpolatedString:
+		parts, err := t.expressions(s, n.Parts)
+		if err != nil {
+			return "", err
+		}
+		return "rt.Interpolate(" + strings.Join(parts, ", ") + ")", nil
+	case *ast.ArrayExpression:
+		items, err := t.expressions(s, n.Items)
+		if err != nil {
+			return "", err
+		}
+		return "rt.Array(" + strings.Join(items, ", ") + ")", nil
+	case *ast.MapExpression:
+		var entries []string
+		for _, e := range n.Entries {
+			k, err := t.expression(s, e.Key)
+			if err != nil {
+				return "", err
+			}
+			v, err := t.expression(s, e.Value)
+			if err != nil {
+				return "", err
+			}
+			entries = append(entries, fmt.Sprintf("r.Key(%s, %s)", at(e.Key), k), v)
+		}
+		return "rt.Map(" + strings.Join(entries, ", ") + ")", nil
+	case *ast.IfExpression:
+		code, err := t.ifExpression(s, n)
+		if err != nil {
+			return "", err
+		}
+		return "func() rt.Object {\n" + code + "}()", nil
+	case *ast.BinaryOperationExpression:
+		a, err := t.expression(s, n.A)
+		if err != nil {
+			return "", err
+		}
+		b, err := t.expression(s, n.B)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("r.Binary(%s, %s, %s, %s)", at(n), binaryOperators[n.Operator], a, b), nil
+	case *ast.UnaryOperationExpression:
+		a, err := t.expression(s, n.A)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("r.Unary(%s, %s, %s)", at(n), unaryOperators[n.Operator], a), nil
+	case *ast.CallExpression:
+		callee, err := t.expression(s, n.Callee)
+		if err != nil {
+			return "", err
+		}
+		args, err := t.expressions(s, n.Parameters)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("r.Call(%s, %s)", at(n), strings.Join(append([]string{callee}, args...), ", ")), nil
+	case *ast.SubscriptExpression:
+		target, err := t.expression(s, n.Target)
+		if err != nil {
+			return "", err
+		}
+		index, err := t.expression(s, n.Index)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("r.Subscript(%s, %s, %s)", at(n), target, index), nil
+	case *ast.MemberExpression:
+		target, err := t.expression(s, n.Target)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("r.Member(%s, %s, %s)", at(n), target, strconv.Quote(n.Name)), nil
+	case *ast.Function:
+		return t.function(s, n)
+	}
+	return "", newError(n, "Unknown expression")
+}
+
+// ifExpression returns the statements of a Go function returning the value
+// of n.
+func (t *transpiler) ifExpression(s *scope, n *ast.IfExpression) (string, error) {
+	value, err := t.expression(s, n.Value)
+	if err != nil {
+		return "", err
+	}
+	if n.Condition == nil {
+		return "return " + value + "\n", nil
+	}
+	cond, err := t.expression(s, n.Condition)
+	if err != nil {
+		return "", err
+	}
+	rest, err := t.ifExpression(s, n.ElseBranch)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("if rt.Truthy(%s) {\nreturn %s\n}\n%s", cond, value, rest), nil
+}
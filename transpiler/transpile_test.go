@@ -0,0 +1,131 @@
+package transpiler_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/builtins"
+	"github.com/niklaskorz/nklang/evaluator"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+	"github.com/niklaskorz/nklang/semantics"
+	"github.com/niklaskorz/nklang/transpiler"
+)
+
+// parse parses and analyzes the program at path with the builtins
+// predeclared.
+func parse(t *testing.T, path string) *ast.Program {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := lexer.NewScanner(f)
+	s.File = path
+	p, err := parser.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := semantics.NewScope()
+	for _, name := range builtins.Names() {
+		ds.Declare(name)
+	}
+	if err := semantics.AnalyzeLookupsWithScope(p, ds); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// interpret evaluates p and returns what it printed, followed by the error
+// it failed with as reported by nklg.
+func interpret(p *ast.Program, stdin string) string {
+	var out strings.Builder
+	scope := evaluator.NewScope()
+	for _, b := range builtins.New(&out, strings.NewReader(stdin)) {
+		scope.Declare(b.Name, b.Function)
+	}
+	if err := evaluator.EvaluateWithScope(p, scope); err != nil {
+		evaluator.PrintError(&out, err)
+	}
+	return out.String()
+}
+
+// compile transpiles p, vets the generated program and runs it, returning
+// what it printed.
+func compile(t *testing.T, p *ast.Program, stdin string) string {
+	src, err := transpiler.Transpile(p, builtins.Names())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The generated program imports the rt package, so it has to be built
+	// inside of the module
+	dir, err := ioutil.TempDir("testdata", "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pkg := "./" + filepath.ToSlash(dir)
+
+	if out, err := exec.Command("go", "vet", pkg).CombinedOutput(); err != nil {
+		t.Fatalf("go vet failed: %v\n%s", err, out)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", "run", pkg)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok || stdout.Len() == 0 {
+			t.Fatalf("go run failed: %v\n%s", err, stderr.Bytes())
+		}
+	}
+	return stdout.String()
+}
+
+// expectSameOutput runs the program at path on the evaluator and as
+// transpiled Go program and fails if their output differs.
+func expectSameOutput(t *testing.T, path, stdin string) {
+	if testing.Short() {
+		t.Skip("skipping go run in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	t.Helper()
+	p := parse(t, path)
+	expected := interpret(p, stdin)
+	if actual := compile(t, p, stdin); actual != expected {
+		t.Errorf("Output of the transpiled program differs from the evaluator\nevaluator:\n%s\ntranspiled:\n%s", expected, actual)
+	}
+}
+
+func TestEvalIsRejected(t *testing.T) {
+	p := parse(t, "../example.nk")
+	_, err := transpiler.Transpile(p, builtins.Names())
+	if err == nil || !strings.HasSuffix(err.Error(), "eval is not supported by transpiled programs") {
+		t.Errorf("Expected example.nk to be rejected for using eval, got %v", err)
+	}
+}
+
+func TestPrograms(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.nk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".nk"), func(t *testing.T) {
+			expectSameOutput(t, path, "nklang\n")
+		})
+	}
+}
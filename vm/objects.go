@@ -0,0 +1,140 @@
+package vm
+
+import (
+	"github.com/niklaskorz/nklang/compiler"
+	"github.com/niklaskorz/nklang/evaluator"
+)
+
+// Object is the value type of the virtual machine, shared with the
+// evaluator.
+type Object = evaluator.Object
+
+// Closure is a compiled function together with the variables it captures.
+type Closure struct {
+	*compiler.Function
+	// Program the function was compiled in, which may differ from the
+	// program calling it when programs share a scope
+	program *compiler.Program
+	// Scope the program runs in
+	scope    *evaluator.DefinitionScope
+	captured []*cell
+}
+
+func (o *Closure) TypeName() string {
+	return "Function"
+}
+
+func (o *Closure) IsTrue() bool {
+	return true
+}
+
+func (o *Closure) Equals(other Object) (*evaluator.Boolean, error) {
+	return &evaluator.Boolean{Value: o == other}, nil
+}
+
+func (o *Closure) FormatObject() string {
+	s := "func("
+	for i, param := range o.Parameters {
+		if i != 0 {
+			s += ", "
+		}
+		s += param
+	}
+	return s + ")"
+}
+
+// method implements a class method by a compiled function. It captures
+// the variables of the scope the class is declared in along with the class,
+// and self and super once it is bound.
+type method struct {
+	*compiler.Function
+	program  *compiler.Program
+	scope    *evaluator.DefinitionScope
+	captured []*cell
+}
+
+func (m method) Bind(scope *evaluator.DefinitionScope) Object {
+	captured := make([]*cell, len(m.captured))
+	copy(captured, m.captured)
+	for i, c := range m.Captures {
+		if c.Source == compiler.CaptureBinding {
+			v, _ := scope.Lookup(0, c.Index)
+			captured[i] = &cell{value: v}
+		}
+	}
+	return &Closure{Function: m.Function, program: m.program, scope: m.scope, captured: captured}
+}
+
+// newClass creates the class of the compiled class declaration c, declared
+// in f.
+func (m *machine) newClass(f *frame, c *compiler.Class, parent *evaluator.Class) *evaluator.Class {
+	methods := make(map[string]evaluator.Method)
+	for _, i := range c.Methods {
+		fn := f.program.Functions[i]
+		methods[fn.Name] = method{Function: fn, program: f.program, scope: f.scope, captured: m.capture(f, fn.Captures)}
+	}
+	return evaluator.NewClassWithMethods(c.ClassDeclaration, parent, methods, f.scope)
+}
+
+// cell holds a local variable captured by closures. It replaces the
+// variable on the stack of the call declaring it, so the call and the
+// closures share it.
+type cell struct {
+	value Object
+}
+
+// set assigns the variable, which must have been declared.
+func (o *cell) set(v Object) error {
+	if o.value == nil {
+		return errUndeclaredVariable
+	}
+	o.value = v
+	return nil
+}
+
+func (o *cell) TypeName() string {
+	return "Cell"
+}
+
+func (o *cell) IsTrue() bool {
+	return true
+}
+
+func (o *cell) Equals(other Object) (*evaluator.Boolean, error) {
+	return &evaluator.Boolean{Value: o == other}, nil
+}
+
+// iterator is kept on the stack while a for in loop runs.
+type iterator struct {
+	evaluator.Iterator
+}
+
+func (o *iterator) TypeName() string {
+	return "Iterator"
+}
+
+func (o *iterator) IsTrue() bool {
+	return true
+}
+
+func (o *iterator) Equals(other Object) (*evaluator.Boolean, error) {
+	return &evaluator.Boolean{Value: o == other}, nil
+}
+
+// pendingError is pushed by an error handler and either bound by a catch
+// clause or raised again after the finally statements have run.
+type pendingError struct {
+	err error
+}
+
+func (o *pendingError) TypeName() string {
+	return "Error"
+}
+
+func (o *pendingError) IsTrue() bool {
+	return true
+}
+
+func (o *pendingError) Equals(other Object) (*evaluator.Boolean, error) {
+	return &evaluator.Boolean{Value: o == other}, nil
+}
@@ -0,0 +1,408 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/compiler"
+	"github.com/niklaskorz/nklang/evaluator"
+)
+
+// handler is an error handler installed by OpTry.
+type handler struct {
+	pc     int
+	height int
+}
+
+// frame is an active call of a compiled function.
+type frame struct {
+	function *compiler.Function
+	// Program the function was compiled in, whose tables its code refers to
+	program *compiler.Program
+	pc      int
+	// Scope the program runs in
+	scope *evaluator.DefinitionScope
+	// Variables captured by the called closure
+	captured []*cell
+	// Stack height before the callee and its arguments were pushed
+	base int
+	// Stack index of the first local variable
+	locals   int
+	handlers []handler
+	// Call expression that created the frame, unused for the main frame
+	callSite ast.Span
+	// Set for calls of init, which return the new instance
+	instance *evaluator.Instance
+}
+
+// errUndeclaredVariable reports the use of a variable whose declaration
+// hasn't run.
+var errUndeclaredVariable = errors.New("Variable has not been declared")
+
+type machine struct {
+	stack []Object
+	// Frames are kept by value to reuse them between calls
+	frames []frame
+}
+
+// Run executes p with the top level statements running in scope.
+func Run(p *compiler.Program, scope *evaluator.DefinitionScope) error {
+	m := &machine{
+		stack:  make([]Object, p.Main.Locals),
+		frames: []frame{{function: p.Main, program: p, scope: scope}},
+	}
+	return m.run()
+}
+
+func (m *machine) push(o Object) {
+	m.stack = append(m.stack, o)
+}
+
+func (m *machine) pop() Object {
+	o := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return o
+}
+
+// popN removes and returns the n topmost values.
+func (m *machine) popN(n int) []Object {
+	values := make([]Object, n)
+	copy(values, m.stack[len(m.stack)-n:])
+	m.stack = m.stack[:len(m.stack)-n]
+	return values
+}
+
+func (m *machine) run() error {
+	for {
+		f := &m.frames[len(m.frames)-1]
+		pc := f.pc
+		i := f.function.Code[pc]
+		f.pc++
+
+		var err error
+		switch i.Op {
+		case compiler.OpConstant:
+			m.push(f.program.Constants[i.A])
+		case compiler.OpNil:
+			m.push(evaluator.NilObject)
+		case compiler.OpPop:
+			m.pop()
+		case compiler.OpLoad:
+			if v, ok := f.scope.Lookup(i.A, i.B); ok {
+				m.push(v)
+			} else {
+				err = errUndeclaredVariable
+			}
+		case compiler.OpStore:
+			if !f.scope.Assign(i.A, i.B, m.pop()) {
+				err = errUndeclaredVariable
+			}
+		case compiler.OpDeclare:
+			f.scope.DeclareAt(i.A, f.program.Names[i.B], m.pop())
+		case compiler.OpPreDeclare:
+			f.scope.DeclarePending(i.A, f.program.Names[i.B])
+		case compiler.OpLoadLocal:
+			v := m.stack[f.locals+i.A]
+			if c, ok := v.(*cell); ok {
+				v = c.value
+			}
+			if v != nil {
+				m.push(v)
+			} else {
+				err = errUndeclaredVariable
+			}
+		case compiler.OpStoreLocal:
+			v := m.pop()
+			switch local := m.stack[f.locals+i.A].(type) {
+			case nil:
+				err = errUndeclaredVariable
+			case *cell:
+				err = local.set(v)
+			default:
+				m.stack[f.locals+i.A] = v
+			}
+		case compiler.OpDeclareLocal:
+			// Closures that captured the local before keep its cell
+			m.stack[f.locals+i.A] = m.pop()
+		case compiler.OpLoadCaptured:
+			if v := f.captured[i.A].value; v != nil {
+				m.push(v)
+			} else {
+				err = errUndeclaredVariable
+			}
+		case compiler.OpStoreCaptured:
+			err = f.captured[i.A].set(m.pop())
+		case compiler.OpJump:
+			f.pc = i.A
+		case compiler.OpJumpIfFalse:
+			if !m.pop().IsTrue() {
+				f.pc = i.A
+			}
+		case compiler.OpBinary:
+			b := m.pop()
+			a := m.pop()
+			var v Object
+			v, err = evaluator.EvaluateBinaryOperation(ast.BinaryOperator(i.A), a, b)
+			if err == nil {
+				m.push(v)
+			}
+		case compiler.OpUnary:
+			var v Object
+			v, err = evaluator.EvaluateUnaryOperation(ast.UnaryOperator(i.A), m.pop())
+			if err == nil {
+				m.push(v)
+			}
+		case compiler.OpArray:
+			m.push(&evaluator.Array{Items: m.popN(i.A)})
+		case compiler.OpMap:
+			m.push(evaluator.NewMap())
+		case compiler.OpMapEntry:
+			v := m.pop()
+			var k evaluator.Hashable
+			k, err = evaluator.MapKey(m.pop())
+			if err == nil {
+				m.stack[len(m.stack)-1].(*evaluator.Map).Set(k, v)
+			}
+		case compiler.OpInterpolate:
+			str := ""
+			for _, v := range m.popN(i.A) {
+				str += evaluator.FormatObject(v)
+			}
+			m.push(&evaluator.String{Value: str})
+		case compiler.OpSubscript:
+			index := m.pop()
+			var v Object
+			v, err = evaluator.Subscript(m.pop(), index)
+			if err == nil {
+				m.push(v)
+			}
+		case compiler.OpSetSubscript:
+			value := m.pop()
+			index := m.pop()
+			err = evaluator.SetSubscript(m.pop(), index, value)
+		case compiler.OpMember:
+			var v Object
+			v, err = evaluator.Member(m.pop(), f.program.Names[i.A])
+			if err == nil {
+				m.push(v)
+			}
+		case compiler.OpSetMember:
+			value := m.pop()
+			err = evaluator.SetMember(m.pop(), f.program.Names[i.A], value)
+		case compiler.OpClosure:
+			fn := f.program.Functions[i.A]
+			m.push(&Closure{Function: fn, program: f.program, scope: f.scope, captured: m.capture(f, fn.Captures)})
+		case compiler.OpStruct:
+			m.push(evaluator.NewStructType(f.program.Structs[i.A]))
+		case compiler.OpClass:
+			c := f.program.Classes[i.A]
+			var parent *evaluator.Class
+			if c.Superclass != nil {
+				v := m.pop()
+				p, ok := v.(*evaluator.Class)
+				if !ok {
+					err = fmt.Errorf("Can't inherit from %s", v.TypeName())
+					break
+				}
+				parent = p
+			}
+			m.push(m.newClass(f, c, parent))
+		case compiler.OpCall:
+			err = m.call(i.A, f.function.Spans[pc])
+		case compiler.OpReturn:
+			v := m.pop()
+			if f.instance != nil {
+				v = f.instance
+			}
+			m.stack = m.stack[:f.base]
+			m.frames = m.frames[:len(m.frames)-1]
+			if len(m.frames) == 0 {
+				return nil
+			}
+			m.push(v)
+		case compiler.OpIterate:
+			var it evaluator.Iterator
+			it, err = evaluator.Iterate(m.pop())
+			if err == nil {
+				m.push(&iterator{Iterator: it})
+			}
+		case compiler.OpNext:
+			it := m.stack[len(m.stack)-1].(*iterator)
+			index, value, ok := it.Next()
+			if !ok {
+				m.pop()
+				f.pc = i.A
+				break
+			}
+			m.push(index)
+			m.push(value)
+		case compiler.OpThrow:
+			v := m.pop()
+			span := f.function.Spans[pc]
+			if e, ok := v.(*evaluator.Error); ok && e.Span == (ast.Span{}) {
+				e.Span = span
+			}
+			err = &evaluator.ThrowError{Span: span, Value: v, Trace: m.trace()}
+		case compiler.OpTry:
+			f.handlers = append(f.handlers, handler{pc: i.A, height: len(m.stack)})
+		case compiler.OpEndTry:
+			f.handlers = f.handlers[:len(f.handlers)-1]
+		case compiler.OpCatch:
+			switch e := m.pop().(*pendingError).err.(type) {
+			case *evaluator.ThrowError:
+				m.push(e.Value)
+			case *evaluator.RuntimeError:
+				m.push(evaluator.NewRuntimeErrorObject(e))
+			default:
+				// Like the evaluator, catch blocks skip errors that
+				// can't be caught, but finally blocks still run
+				err = e
+			}
+		case compiler.OpRethrow:
+			err = m.pop().(*pendingError).err
+		}
+
+		if err != nil {
+			if err := m.raise(evaluator.Positioned(f.function.Spans[pc], err)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// call calls the callee below the argc topmost values. Closures get a new
+// frame, all other callees are called directly.
+func (m *machine) call(argc int, span ast.Span) error {
+	if c, ok := m.stack[len(m.stack)-argc-1].(*Closure); ok {
+		return m.callClosure(c, argc, span, nil)
+	}
+
+	args := m.popN(argc)
+	switch callee := m.pop().(type) {
+	case *evaluator.PredefinedFunction:
+		v, err := callee.Call(args)
+		if err != nil {
+			return err
+		}
+		m.push(v)
+		return nil
+	case *evaluator.Function:
+		// Functions created by eval are run by the evaluator
+		v, err := callee.Call(args)
+		if err != nil {
+			return err
+		}
+		m.push(v)
+		return nil
+	case *evaluator.StructType:
+		r, err := callee.New(args)
+		if err != nil {
+			return err
+		}
+		m.push(r)
+		return nil
+	case *evaluator.Class:
+		instance := evaluator.NewInstance(callee)
+		init := instance.Init()
+		if init == nil {
+			if argc != 0 {
+				return fmt.Errorf("Expected 0 arguments, got %d", argc)
+			}
+			m.push(instance)
+			return nil
+		}
+		// Arguments are passed on the stack, in place of the class
+		m.push(nil)
+		for _, v := range args {
+			m.push(v)
+		}
+		return m.callClosure(init.(*Closure), argc, span, instance)
+	default:
+		return &evaluator.OperationNotSupportedError{Operator: "()", Operands: []string{callee.TypeName()}}
+	}
+}
+
+// callClosure enters c with the argc topmost values as arguments, removing
+// them and the closure below from the stack.
+func (m *machine) callClosure(c *Closure, argc int, span ast.Span, instance *evaluator.Instance) error {
+	if argc != len(c.Parameters) {
+		return fmt.Errorf("Expected %d arguments, got %d", len(c.Parameters), argc)
+	}
+
+	// The arguments become the first locals, the closure stays below them
+	base := len(m.stack) - argc - 1
+	for n := argc; n < c.Locals; n++ {
+		m.push(nil)
+	}
+
+	m.frames = append(m.frames, frame{
+		function: c.Function,
+		program:  c.program,
+		scope:    c.scope,
+		captured: c.captured,
+		base:     base,
+		locals:   base + 1,
+		callSite: span,
+		instance: instance,
+	})
+	return nil
+}
+
+// capture returns the variables captured by a closure created in f.
+// Captured locals are moved into cells, which the closure shares with f.
+// Variables of the scope binding a method are captured once the method is
+// bound, their cells are left nil.
+func (m *machine) capture(f *frame, captures []compiler.Capture) []*cell {
+	cells := make([]*cell, len(captures))
+	for i, c := range captures {
+		switch c.Source {
+		case compiler.CaptureLocal:
+			local := &m.stack[f.locals+c.Index]
+			v, ok := (*local).(*cell)
+			if !ok {
+				v = &cell{value: *local}
+				*local = v
+			}
+			cells[i] = v
+		case compiler.CaptureCaptured:
+			cells[i] = f.captured[c.Index]
+		}
+	}
+	return cells
+}
+
+// trace returns the active calls, outermost first.
+func (m *machine) trace() []evaluator.StackFrame {
+	frames := make([]evaluator.StackFrame, 0, len(m.frames)-1)
+	for _, f := range m.frames[1:] {
+		frames = append(frames, evaluator.StackFrame{Name: f.function.Name, CallSite: f.callSite})
+	}
+	return frames
+}
+
+// raise continues at the innermost error handler, leaving the frames of
+// calls without one. If there is no handler at all, the error is returned.
+func (m *machine) raise(err error) error {
+	if e, ok := err.(*evaluator.RuntimeError); ok && e.Trace == nil && len(m.frames) > 1 {
+		e.Trace = m.trace()
+	}
+
+	for i := len(m.frames) - 1; i >= 0; i-- {
+		f := &m.frames[i]
+		if n := len(f.handlers); n > 0 {
+			h := f.handlers[n-1]
+			f.handlers = f.handlers[:n-1]
+			m.frames = m.frames[:i+1]
+			m.stack = m.stack[:h.height]
+			f.pc = h.pc
+			m.push(&pendingError{err: err})
+			return nil
+		}
+	}
+
+	if e, ok := err.(*evaluator.ThrowError); ok {
+		return e.RuntimeError()
+	}
+	return err
+}
@@ -0,0 +1,326 @@
+package vm_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/niklaskorz/nklang/ast"
+	"github.com/niklaskorz/nklang/builtins"
+	"github.com/niklaskorz/nklang/compiler"
+	"github.com/niklaskorz/nklang/evaluator"
+	"github.com/niklaskorz/nklang/lexer"
+	"github.com/niklaskorz/nklang/parser"
+	"github.com/niklaskorz/nklang/semantics"
+	"github.com/niklaskorz/nklang/vm"
+)
+
+// parse parses and analyzes src, declaring the builtins first.
+func parse(t testing.TB, src string) *ast.Program {
+	s := lexer.NewScanner(strings.NewReader(src))
+	s.File = "test.nk"
+	p, err := parser.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := semantics.NewScope()
+	for _, name := range builtins.Names() {
+		ds.Declare(name)
+	}
+	if err := semantics.AnalyzeLookupsWithScope(p, ds); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// newScope returns a scope declaring the given builtins.
+func newScope(predefined []builtins.Builtin) *evaluator.DefinitionScope {
+	scope := evaluator.NewScope()
+	for _, b := range predefined {
+		scope.Declare(b.Name, b.Function)
+	}
+	return scope
+}
+
+// run runs src on the virtual machine if useVM is set and on the evaluator
+// otherwise, and returns what it printed followed by the error it failed
+// with, if any, as reported by nklg. stdin is the input read by the
+// program.
+func run(t *testing.T, src, stdin string, useVM bool) string {
+	p := parse(t, src)
+	var out strings.Builder
+	scope := newScope(builtins.New(&out, strings.NewReader(stdin)))
+	var err error
+	if useVM {
+		program, cerr := compiler.Compile(p)
+		if cerr != nil {
+			t.Fatal(cerr)
+		}
+		err = vm.Run(program, scope)
+	} else {
+		err = evaluator.EvaluateWithScope(p, scope)
+	}
+	if err != nil {
+		evaluator.PrintError(&out, err)
+	}
+	return out.String()
+}
+
+// expectSameOutput runs src on the evaluator and on the virtual machine and
+// fails if their output differs.
+func expectSameOutput(t *testing.T, src, stdin string) {
+	t.Helper()
+	expected := run(t, src, stdin, false)
+	if actual := run(t, src, stdin, true); actual != expected {
+		t.Errorf("Output of the virtual machine differs from the evaluator\nevaluator:\n%s\nvm:\n%s", expected, actual)
+	}
+}
+
+func TestExample(t *testing.T) {
+	src, err := ioutil.ReadFile("../example.nk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectSameOutput(t, string(src), "nklang\n")
+}
+
+var programs = map[string]string{
+	"closures": `
+		counter := func() {
+			n := 0;
+			return func() {
+				n = n + 1;
+				return n;
+			};
+		};
+		c := counter();
+		c();
+		println(c(), counter()());
+
+		fs := [nil, nil, nil];
+		for i, v in ["a", "b", "c"] {
+			fs[i] = func() { return "${i}${v}"; };
+		}
+		println(fs[0](), fs[1](), fs[2]());
+
+		fib := func(n) {
+			if n < 2 {
+				return n;
+			}
+			return fib(n - 1) + fib(n - 2);
+		};
+		println(fib(15));
+	`,
+	"try finally": `
+		f := func(x) {
+			try {
+				if x == 0 {
+					throw Error("zero", "ValueError");
+				}
+				return 10 / x;
+			} catch (e) {
+				println("caught", e.kind, e.message, e.line);
+				return -1;
+			} finally {
+				println("finally", x);
+			}
+		};
+		println(f(2), f(0));
+
+		try {
+			[1, 2][5];
+		} catch (e) {
+			println(e.kind, e.position);
+		}
+
+		g := func() {
+			try {
+				throw "inner";
+			} finally {
+				println("cleanup");
+			}
+		};
+		try {
+			g();
+		} catch (e) {
+			println("rethrown", e);
+		}
+
+		i := 0;
+		while i < 3 {
+			i = i + 1;
+			try {
+				if i == 2 {
+					continue;
+				}
+				println("body", i);
+			} finally {
+				println("finally", i);
+			}
+		}
+	`,
+	"classes": `
+		class Animal {
+			init(name) {
+				self.name = name;
+			}
+			speak() {
+				return "${self.name} makes a sound";
+			}
+		}
+		class Dog : Animal {
+			speak() {
+				return super.speak() + ", woof";
+			}
+		}
+		d := Dog("Rex");
+		println(d.speak());
+		println(d, Animal, d.name);
+		speak := d.speak;
+		d.name = "Max";
+		println(speak());
+
+		class Empty {}
+		println(Empty());
+		Empty(1);
+	`,
+	"locals": `
+		f := func() {
+			a := 1;
+			for i in [1, 2, 3] {
+				b := i * 100;
+				try {
+					c := b + a;
+					if i == 2 { continue; }
+					if i == 3 { break; }
+					println("body", c);
+				} finally {
+					d := b + 1;
+					g := func() { return d + a; };
+					println("finally", g());
+				}
+				e := 7;
+				println("after", e, b);
+			}
+			z := 9;
+			return z + a;
+		};
+		println(f());
+		class Base {
+			init(x) { self.x = x; }
+			get() { return self.x; }
+		}
+		make := func(k) {
+			m := k * 2;
+			class Derived : Base {
+				get() {
+					h := func() { return super.get() + m + k; };
+					return h();
+				}
+				set(v) { m = v; }
+			}
+			return Derived;
+		};
+		D := make(5);
+		o := D(1);
+		println(o.get());
+		o.set(100);
+		println(o.get(), D(2).get());
+		counter := func() {
+			n := 0;
+			inc := func() { n = n + 1; return n; };
+			get := func() { return func() { return n; }; };
+			return [inc, get()];
+		};
+		cs := counter();
+		cs[0](); cs[0]();
+		println(cs[1]());
+		r := func(n) {
+			try {
+				if n == 0 { throw "bottom"; }
+				return r(n - 1);
+			} catch (e) {
+				x := "caught ${e} at ${n}";
+				return x;
+			} finally {
+				y := n;
+			}
+		};
+		println(r(3));
+		w := func() {
+			i := 0;
+			fs := [nil, nil];
+			while i < 2 {
+				j := i;
+				fs[i] = func() { j = j + 10; return j; };
+				i = i + 1;
+			}
+			return [fs[0](), fs[0](), fs[1]()];
+		};
+		println(w());
+`,
+	"uncatchable": `
+		h := eval("func() { break; }");
+		try {
+			h();
+		} catch (e) {
+			println("caught", e);
+		} finally {
+			println("finally");
+		}
+	`,
+	"uncaught": `
+		f := func(x) {
+			return x + "a";
+		};
+		g := func() {
+			return f(1);
+		};
+		g();
+	`,
+}
+
+func TestPrograms(t *testing.T) {
+	for name, src := range programs {
+		t.Run(name, func(t *testing.T) {
+			expectSameOutput(t, src, "")
+		})
+	}
+}
+
+const facultySource = `
+faculty := func(n) {
+    if n == 0 {
+        return 1;
+    }
+    return n * faculty(n - 1);
+};
+i := 0;
+while i < 1000 {
+    faculty(20);
+    i = i + 1;
+}
+`
+
+// BenchmarkFaculty compares the virtual machine to the evaluator.
+func BenchmarkFaculty(b *testing.B) {
+	p := parse(b, facultySource)
+	program, err := compiler.Compile(p)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("evaluator", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := evaluator.EvaluateWithScope(p, newScope(builtins.Predefined)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("vm", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := vm.Run(program, newScope(builtins.Predefined)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}